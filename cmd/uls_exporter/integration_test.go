@@ -0,0 +1,159 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const leases = `[
+	{"floatingLeaseId":1,"token":"00000000-0000-0000-0000-000000000001","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["group"]},
+	{"floatingLeaseId":2,"token":"00000000-0000-0000-0000-000000000002","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["group"]},
+	{"floatingLeaseId":3,"token":"00000000-0000-0000-0000-000000000003","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["group"]}
+]`
+
+// ulsURI returns ULS_INTEGRATION_URI, or the URL of a mock ULS serving three
+// leases if it is unset.
+func ulsURI(t *testing.T) (uri string, mock bool) {
+	if uri := os.Getenv("ULS_INTEGRATION_URI"); uri != "" {
+		return uri, false
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/admin/lease", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, leases)
+	})
+	mux.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"licensing":"ok"}`)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s.URL, true
+}
+
+func buildExporter(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "uls_exporter")
+	out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %s\n%s", err, out)
+	}
+	return bin
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// scrape polls url until the exporter answers or ctx is done.
+func scrape(ctx context.Context, t *testing.T, url string) map[string]*dto.MetricFamily {
+	t.Helper()
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		families, err := fetchMetrics(ctx, url)
+		if err == nil {
+			return families
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("scraping %s: %s", url, err)
+		case <-tick.C:
+		}
+	}
+}
+
+func fetchMetrics(ctx context.Context, url string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", res.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(res.Body)
+}
+
+func gaugeValue(t *testing.T, families map[string]*dto.MetricFamily, name string) float64 {
+	t.Helper()
+	mf, ok := families[name]
+	if !ok || len(mf.Metric) != 1 {
+		t.Fatalf("%s: want exactly one sample", name)
+	}
+	return mf.Metric[0].GetGauge().GetValue()
+}
+
+func TestExporterBinary(t *testing.T) {
+	uri, mock := ulsURI(t)
+	bin := buildExporter(t)
+	addr := freeAddr(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "-uri", uri, "-listen", addr, "-path", "/prom", "-instance-label", "integration")
+	cmd.Env = []string{"ULS_SCRAPE_TIMEOUT=5s"}
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if t.Failed() {
+			t.Logf("exporter output:\n%s", output.String())
+		}
+	}()
+
+	families := scrape(ctx, t, "http://"+addr+"/prom")
+
+	if got := gaugeValue(t, families, "uls_up"); got != 1 {
+		t.Errorf("uls_up = %v, want 1", got)
+	}
+	var instance string
+	for _, l := range families["uls_up"].Metric[0].Label {
+		if l.GetName() == "instance" {
+			instance = l.GetValue()
+		}
+	}
+	if instance != "integration" {
+		t.Errorf("instance label = %q, want integration", instance)
+	}
+	if !mock {
+		return
+	}
+	if got := gaugeValue(t, families, "uls_leases"); got != 3 {
+		t.Errorf("uls_leases = %v, want 3", got)
+	}
+	if got := gaugeValue(t, families, "uls_health_licensing_up"); got != 1 {
+		t.Errorf("uls_health_licensing_up = %v, want 1", got)
+	}
+}
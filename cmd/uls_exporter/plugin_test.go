@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"uls_exporter/uls"
+)
+
+// The plugin test lives here rather than in package uls: a plugin only
+// loads into a binary built from the same packages, and the uls test binary
+// builds uls together with its test files.
+func TestPluginDir(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		t.Skipf("plugins are not supported on %s", runtime.GOOS)
+	}
+	out, err := exec.Command("go", "env", "CGO_ENABLED").Output()
+	if err != nil {
+		t.Skipf("go env: %s", err)
+	}
+	if strings.TrimSpace(string(out)) != "1" {
+		t.Skip("plugins need cgo")
+	}
+	dir := t.TempDir()
+	args := []string{"build", "-buildmode=plugin", "-o", filepath.Join(dir, "test.so")}
+	if raceEnabled {
+		args = append(args, "-race")
+	}
+	out, err = exec.Command("go", append(args, "../../uls/testdata/plugin")...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("building the test plugin: %s\n%s", err, out)
+	}
+
+	ulsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"floatingLeaseId":1,"token":"00000000-0000-0000-0000-000000000001"},{"floatingLeaseId":2,"token":"00000000-0000-0000-0000-000000000002"}]`)
+	}))
+	defer ulsServer.Close()
+	app := &uls.App{Args: []string{"-listen=127.0.0.1:0", "-skip-health-scrape", "-uri=" + ulsServer.URL, "-plugin-dir=" + dir}}
+	err = app.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		app.Stop(ctx)
+	}()
+
+	res, err := http.Get("http://" + app.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`\nuls_test_plugin_leases\{[^}]*\} 2\n`).Match(b) {
+		t.Errorf("the plugin's metric is not exported:\n%s", b)
+	}
+}
@@ -0,0 +1,46 @@
+// Command gen writes METRICS.md, the list of metrics the exporter exports. It
+// is run by go generate in the uls package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"uls_exporter/uls"
+)
+
+// help escapes the characters in help strings that Markdown tables would
+// otherwise interpret.
+var help = strings.NewReplacer("|", `\|`, "<", "&lt;")
+
+func render(w io.Writer, metrics []uls.MetricInfo) {
+	fmt.Fprintln(w, "# Metrics")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "<!-- Generated by go generate ./uls; do not edit. -->")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Name | Type | Labels | Help |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- |")
+	for _, m := range metrics {
+		labels := make([]string, len(m.Labels))
+		for i, l := range m.Labels {
+			labels[i] = "`" + l + "`"
+		}
+		fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", m.Name, m.Type, strings.Join(labels, ", "), help.Replace(m.Help))
+	}
+}
+
+func main() {
+	out := flag.String("o", "METRICS.md", "file to write")
+	flag.Parse()
+	var buf bytes.Buffer
+	render(&buf, uls.Metrics())
+	err := ioutil.WriteFile(*out, buf.Bytes(), 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
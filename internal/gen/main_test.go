@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"uls_exporter/uls"
+)
+
+func TestMetricsDocUpToDate(t *testing.T) {
+	committed, err := ioutil.ReadFile("../../METRICS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	render(&buf, uls.Metrics())
+	if !bytes.Equal(buf.Bytes(), committed) {
+		t.Error("METRICS.md is out of date; run go generate ./uls")
+	}
+}
+
+func TestRenderEscapesHelp(t *testing.T) {
+	var buf bytes.Buffer
+	render(&buf, []uls.MetricInfo{{Name: "uls_x", Type: "gauge", Help: "a | <b>", Labels: []string{"l"}}})
+	want := "| `uls_x` | gauge | `l` | a \\| &lt;b> |\n"
+	if !bytes.HasSuffix(buf.Bytes(), []byte(want)) {
+		t.Errorf("got\n%s\nwant last line %q", buf.String(), want)
+	}
+}
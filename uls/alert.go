@@ -0,0 +1,116 @@
+package uls
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+const leaseLimitAlert = "ULSLeaseLimitReached"
+
+type alertmanagerWebhook struct {
+	Status string `json:"status"`
+	Alerts []struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+	} `json:"alerts"`
+}
+
+func (w alertmanagerWebhook) firing(name string) bool {
+	for _, a := range w.Alerts {
+		if a.Status == "firing" && a.Labels["alertname"] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ULSExporter) RevokeLease(ctx context.Context, token uuid.UUID) error {
+	leaseURL, err := e.paths.URL(e.BaseURL, "/v1/admin/lease/"+token.String())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, leaseURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := e.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%d %s", res.StatusCode, res.Status)
+	}
+	return nil
+}
+
+func oldestLease(leases []ULSLease) (ULSLease, bool) {
+	var oldest ULSLease
+	found := false
+	for _, l := range leases {
+		if l.IsRevoked {
+			continue
+		}
+		if !found || l.CreatedTimeUTC.Time().Before(oldest.CreatedTimeUTC.Time()) {
+			oldest, found = l, true
+		}
+	}
+	return oldest, found
+}
+
+// AlertHandler receives Alertmanager webhooks and revokes the oldest lease
+// while the ULSLeaseLimitReached alert fires. Requests must carry the admin
+// token as a bearer token.
+func (e *ULSExporter) AlertHandler(adminToken *fileCredential) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		want := "Bearer " + adminToken.Get()
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var webhook alertmanagerWebhook
+		err := json.NewDecoder(r.Body).Decode(&webhook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !webhook.firing(leaseLimitAlert) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		leases, err := e.GetLeasesContext(r.Context())
+		if err != nil {
+			log.Printf("auto revocation: %s", err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		l, ok := oldestLease(leases)
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		err = e.RevokeLease(r.Context(), l.Token)
+		if err != nil {
+			log.Printf("auto revocation of lease %s: %s", l.Token, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		atomic.AddUint64(&e.autoRevocations, 1)
+		log.Printf("%s firing: revoked lease %s held by %s@%s since %s", leaseLimitAlert, l.Token,
+			l.ClientEntitlementContext.EnvironmentUser, l.ClientEntitlementContext.EnvironmentHostname,
+			l.CreatedTimeUTC.Time().Format(TimeUTCFormat))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
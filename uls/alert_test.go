@@ -0,0 +1,112 @@
+package uls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type revocationServer struct {
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (s *revocationServer) handler(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/admin/lease":
+		w.Write([]byte(`[
+			{"token":"6ba7b810-9dad-11d1-80b4-00c04fd430c1","createdTimeUtc":"2021-01-02T00:00:00Z","isRevoked":false},
+			{"token":"6ba7b810-9dad-11d1-80b4-00c04fd430c2","createdTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false},
+			{"token":"6ba7b810-9dad-11d1-80b4-00c04fd430c3","createdTimeUtc":"2020-12-01T00:00:00Z","isRevoked":true}
+		]`))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1/admin/lease/"):
+		s.mu.Lock()
+		s.revoked = append(s.revoked, strings.TrimPrefix(r.URL.Path, "/v1/admin/lease/"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *revocationServer) Revoked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.revoked...)
+}
+
+const firingWebhook = `{"version":"4","status":"firing","alerts":[{"status":"firing","labels":{"alertname":"ULSLeaseLimitReached","severity":"critical"}}]}`
+
+func postAlert(t *testing.T, e *ULSExporter, token string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "admin-token")
+	writeSecret(t, path, "admin-secret\n")
+	adminToken, err := newFileCredential(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.AlertHandler(adminToken).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAlertRevokesOldestLease(t *testing.T) {
+	var uls revocationServer
+	s := newCountingServer(t, uls.handler)
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	rec := postAlert(t, e, "admin-secret", firingWebhook)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c2"}
+	if got := uls.Revoked(); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("revoked %v, want %v", got, want)
+	}
+	if got := metricValue(t, gather(t, e), "uls_auto_revocations_total"); got != 1 {
+		t.Errorf("uls_auto_revocations_total = %v, want 1", got)
+	}
+}
+
+func TestAlertRequiresAdminToken(t *testing.T) {
+	var uls revocationServer
+	s := newCountingServer(t, uls.handler)
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	for _, token := range []string{"", "wrong"} {
+		rec := postAlert(t, e, token, firingWebhook)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d, want 401", token, rec.Code)
+		}
+	}
+	if got := uls.Revoked(); len(got) != 0 {
+		t.Errorf("revoked %v without the admin token", got)
+	}
+}
+
+func TestAlertIgnoresOtherAlerts(t *testing.T) {
+	var uls revocationServer
+	s := newCountingServer(t, uls.handler)
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	for _, body := range []string{
+		`{"status":"resolved","alerts":[{"status":"resolved","labels":{"alertname":"ULSLeaseLimitReached"}}]}`,
+		`{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"ULSDown"}}]}`,
+	} {
+		rec := postAlert(t, e, "admin-secret", body)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if got := uls.Revoked(); len(got) != 0 {
+		t.Errorf("revoked %v for alerts other than %s", got, leaseLimitAlert)
+	}
+}
@@ -0,0 +1,27 @@
+package uls
+
+import (
+	"embed"
+	"io"
+	"io/ioutil"
+)
+
+//go:embed alerts/*.yaml
+var alertFiles embed.FS
+
+// alertRules is the Prometheus rule file with the alerting rules for the
+// exporter's metrics.
+const alertRules = "alerts/uls.yaml"
+
+// writeAlerts writes the alerting rules to path, or to w if path is "-".
+func writeAlerts(w io.Writer, path string) error {
+	b, err := alertFiles.ReadFile(alertRules)
+	if err != nil {
+		return err
+	}
+	if path != "-" {
+		return ioutil.WriteFile(path, b, 0o644)
+	}
+	_, err = w.Write(b)
+	return err
+}
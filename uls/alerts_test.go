@@ -0,0 +1,119 @@
+package uls
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+)
+
+type alertRuleFile struct {
+	Groups []struct {
+		Name  string `yaml:"name"`
+		Rules []struct {
+			Alert       string            `yaml:"alert"`
+			Expr        string            `yaml:"expr"`
+			For         string            `yaml:"for"`
+			Labels      map[string]string `yaml:"labels"`
+			Annotations map[string]string `yaml:"annotations"`
+		} `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+// metricName returns the exporter metric a series name refers to, such as
+// the histogram for its _bucket series.
+func metricName(name string, known map[string]bool) string {
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base := strings.TrimSuffix(name, suffix); base != name && known[base] {
+			return base
+		}
+	}
+	return name
+}
+
+func TestAlerts(t *testing.T) {
+	var b bytes.Buffer
+	err := writeAlerts(&b, "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := yaml.NewDecoder(&b)
+	dec.KnownFields(true)
+	var file alertRuleFile
+	err = dec.Decode(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := map[string]bool{}
+	for _, m := range Metrics() {
+		known[m.Name] = true
+	}
+	alerts := map[string]bool{}
+	for _, g := range file.Groups {
+		for _, r := range g.Rules {
+			alerts[r.Alert] = true
+			if r.Labels["severity"] == "" || r.Annotations["summary"] == "" {
+				t.Errorf("alert %s has no severity or summary", r.Alert)
+			}
+			if r.For != "" {
+				_, err := time.ParseDuration(r.For)
+				if err != nil {
+					t.Errorf("alert %s: %v", r.Alert, err)
+				}
+			}
+			expr, err := parser.ParseExpr(r.Expr)
+			if err != nil {
+				t.Errorf("alert %s: %v", r.Alert, err)
+				continue
+			}
+			parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+				vs, ok := node.(*parser.VectorSelector)
+				if ok && !known[metricName(vs.Name, known)] {
+					t.Errorf("alert %s refers to %s, which the exporter does not export", r.Alert, vs.Name)
+				}
+				return nil
+			})
+		}
+	}
+	for _, name := range []string{"ULSDown", "ULSHighLeaseUtilization"} {
+		if !alerts[name] {
+			t.Errorf("alert %s is missing", name)
+		}
+	}
+
+	// Prometheus loads the file, annotation templates included.
+	raw, err := alertFiles.ReadFile(alertRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := rulefmt.Parse(raw)
+	for _, err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestWriteAlertsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uls.yaml")
+	err := writeAlerts(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := alertFiles.ReadFile(alertRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("wrote %q, want the embedded alerts", got)
+	}
+}
@@ -0,0 +1,29 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCollectAllocsBudget(t *testing.T) {
+	const budget = 4 << 20
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(100))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	families := gather(t, e)
+
+	mf, ok := families["uls_collect_allocs_bytes"]
+	if !ok || len(mf.Metric) != 1 {
+		t.Fatal("uls_collect_allocs_bytes not found")
+	}
+	h := mf.Metric[0].Histogram
+	if h.GetSampleCount() != 1 {
+		t.Fatalf("got %d observations, want 1", h.GetSampleCount())
+	}
+	if sum := h.GetSampleSum(); sum <= 0 || sum > budget {
+		t.Errorf("Collect allocated %.0f bytes, budget is %d", sum, budget)
+	}
+}
@@ -0,0 +1,38 @@
+package uls
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// basicAuth requires the username and password on requests to next.
+func basicAuth(next http.Handler, username, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		// Compare both so a wrong username takes as long as a wrong password.
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(username))
+		passOK := subtle.ConstantTimeCompare([]byte(p), []byte(password))
+		if !ok || userOK&passOK != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiKeyAuth requires key in the X-Api-Key header on requests to next, or,
+// if viaQuery is set, in the api_key query parameter.
+func apiKeyAuth(next http.Handler, key string, viaQuery bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("X-Api-Key")
+		if got == "" && viaQuery {
+			got = r.URL.Query().Get("api_key")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
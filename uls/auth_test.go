@@ -0,0 +1,174 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// protectedPaths are the paths serving metrics or lease data, which the
+// metrics authentication applies to.
+var protectedPaths = []string{"/metrics", "/recorded", "/api/v1/read", "/ws/metrics", "/metrics/cardinality", "/lease/count", "/events"}
+
+// startProtectedApp starts an App serving every path in protectedPaths,
+// with args.
+func startProtectedApp(t *testing.T, args ...string) *App {
+	t.Helper()
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(config, []byte(`
+recording_rules:
+  - record: uls_leases_doubled
+    expr: uls_leases * 2
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := startApp(t, append([]string{"-uri=" + uls.URL, "-config=" + config, "-remote-read"}, args...)...)
+	t.Cleanup(func() { app.Stop(context.Background()) })
+	return app
+}
+
+// appStatus returns the status code of a GET of path from app, with the
+// request modified by set.
+func appStatus(t *testing.T, app *App, path string, set func(*http.Request)) int {
+	t.Helper()
+	// Streaming paths such as /events do not end the response.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+app.Addr().String()+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set(req)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestMetricsBasicAuthPaths(t *testing.T) {
+	app := startProtectedApp(t, "-metrics-auth-username=prometheus", "-metrics-auth-password=secret")
+	for _, path := range protectedPaths {
+		if got := appStatus(t, app, path, func(*http.Request) {}); got != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: got status %d, want 401", path, got)
+		}
+		wrong := func(r *http.Request) { r.SetBasicAuth("prometheus", "guess") }
+		if got := appStatus(t, app, path, wrong); got != http.StatusUnauthorized {
+			t.Errorf("%s with a wrong password: got status %d, want 401", path, got)
+		}
+		right := func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") }
+		if got := appStatus(t, app, path, right); got == http.StatusUnauthorized {
+			t.Errorf("%s with credentials: got status 401", path)
+		}
+	}
+	// Paths without lease data stay open.
+	for _, path := range []string{"/healthz", "/version"} {
+		if got := appStatus(t, app, path, func(*http.Request) {}); got != http.StatusOK {
+			t.Errorf("%s without credentials: got status %d, want 200", path, got)
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := basicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "prometheus", "secret")
+
+	for _, tc := range []struct {
+		name     string
+		set      bool
+		user     string
+		password string
+		want     int
+	}{
+		{"correct", true, "prometheus", "secret", http.StatusOK},
+		{"wrong password", true, "prometheus", "guess", http.StatusUnauthorized},
+		{"wrong username", true, "admin", "secret", http.StatusUnauthorized},
+		{"missing", false, "", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.set {
+				r.SetBasicAuth(tc.user, tc.password)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("got status %d, want %d", w.Code, tc.want)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tc.want == http.StatusUnauthorized && challenge != `Basic realm="metrics"` {
+				t.Errorf("got WWW-Authenticate %q", challenge)
+			}
+			if tc.want == http.StatusOK && challenge != "" {
+				t.Errorf("got WWW-Authenticate %q on success", challenge)
+			}
+		})
+	}
+}
+
+func TestMetricsAPIKeyPaths(t *testing.T) {
+	app := startProtectedApp(t, "-metrics-api-key=secret", "-metrics-api-key-via-query")
+	for _, path := range protectedPaths {
+		if got := appStatus(t, app, path, func(*http.Request) {}); got != http.StatusUnauthorized {
+			t.Errorf("%s without the key: got status %d, want 401", path, got)
+		}
+		wrong := func(r *http.Request) { r.Header.Set("X-Api-Key", "guess") }
+		if got := appStatus(t, app, path, wrong); got != http.StatusUnauthorized {
+			t.Errorf("%s with a wrong key: got status %d, want 401", path, got)
+		}
+		header := func(r *http.Request) { r.Header.Set("X-Api-Key", "secret") }
+		if got := appStatus(t, app, path, header); got == http.StatusUnauthorized {
+			t.Errorf("%s with the key header: got status 401", path)
+		}
+		query := func(r *http.Request) { r.URL.RawQuery = "api_key=secret" }
+		if got := appStatus(t, app, path, query); got == http.StatusUnauthorized {
+			t.Errorf("%s with the key query parameter: got status 401", path)
+		}
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		viaQuery bool
+		target   string
+		header   string
+		want     int
+	}{
+		{"header", false, "/metrics", "secret", http.StatusOK},
+		{"wrong header", false, "/metrics", "guess", http.StatusUnauthorized},
+		{"missing", false, "/metrics", "", http.StatusUnauthorized},
+		{"query disabled", false, "/metrics?api_key=secret", "", http.StatusUnauthorized},
+		{"query", true, "/metrics?api_key=secret", "", http.StatusOK},
+		{"wrong query", true, "/metrics?api_key=guess", "", http.StatusUnauthorized},
+		{"header with query enabled", true, "/metrics", "secret", http.StatusOK},
+		{"missing with query enabled", true, "/metrics", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.header != "" {
+				r.Header.Set("X-Api-Key", tc.header)
+			}
+			w := httptest.NewRecorder()
+			apiKeyAuth(ok, "secret", tc.viaQuery).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("got status %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package uls
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultMaxResponseSize = 10 << 20
+
+// responseBytesBuckets span 1 KiB to 1 MiB.
+var responseBytesBuckets = []float64{1 << 10, 10 << 10, 100 << 10, 1 << 20}
+
+// acceptGzip asks for a gzip-compressed response. Setting the header
+// ourselves stops http.Transport from decompressing transparently, so
+// readBody does it instead.
+func acceptGzip(req *http.Request) {
+	req.Header.Set("Accept-Encoding", "gzip")
+}
+
+// readBody reads a ULS response body, decompressing it if needed, and fails
+// rather than reading on if it is larger than the configured maximum. The
+// limit applies to the decompressed size.
+func (e *ULSExporter) readBody(res *http.Response) ([]byte, error) {
+	r, err := decompressedBody(res)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(r, e.maxResponseSize+1))
+	if err != nil {
+		return nil, &ULSNetworkError{Err: err}
+	}
+	e.responseBytes.Observe(float64(len(b)))
+	if int64(len(b)) > e.maxResponseSize {
+		return nil, e.tooLarge()
+	}
+	return b, nil
+}
+
+func (e *ULSExporter) tooLarge() error {
+	atomic.AddUint64(&e.truncated, 1)
+	return fmt.Errorf("response body exceeds %d bytes", e.maxResponseSize)
+}
+
+// decompressedBody returns the body of res, decompressed if needed.
+func decompressedBody(res *http.Response) (io.ReadCloser, error) {
+	if !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return ioutil.NopCloser(res.Body), nil
+	}
+	return gzip.NewReader(res.Body)
+}
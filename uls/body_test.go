@@ -0,0 +1,118 @@
+package uls
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetLeasesResponseTooLarge(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(100))
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{MaxResponseSize: 1024})
+
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "response body exceeds 1024 bytes") {
+		t.Fatalf("got error %v, want the response size limit", err)
+	}
+	// gather fetches the leases again and hits the limit a second time.
+	if got := metricValue(t, gather(t, e), "uls_response_truncated_total"); got != 2 {
+		t.Errorf("uls_response_truncated_total = %v, want 2", got)
+	}
+}
+
+func TestGetLeasesResponseAtLimit(t *testing.T) {
+	body := nLeasesJSON(3)
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{MaxResponseSize: int64(len(body))})
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 3 {
+		t.Errorf("got %d leases, want 3", len(leases))
+	}
+	if got := metricValue(t, gather(t, e), "uls_response_truncated_total"); got != 0 {
+		t.Errorf("uls_response_truncated_total = %v, want 0", got)
+	}
+}
+
+func gzipServer(t *testing.T, body string) *countingServer {
+	t.Helper()
+	return newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			fmt.Fprint(w, body)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		fmt.Fprint(zw, body)
+		zw.Close()
+	})
+}
+
+func TestGetLeasesGzip(t *testing.T) {
+	s := gzipServer(t, nLeasesJSON(4))
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 4 {
+		t.Errorf("got %d leases, want 4", len(leases))
+	}
+}
+
+func TestGetLeasesGzipLimitsDecompressedSize(t *testing.T) {
+	s := gzipServer(t, nLeasesJSON(100))
+	e := newTestExporter(t, s.URL, ExporterOptions{MaxResponseSize: 1024})
+
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "response body exceeds 1024 bytes") {
+		t.Fatalf("got error %v, want the response size limit", err)
+	}
+}
+
+func TestAPIResponseBytes(t *testing.T) {
+	var body string
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	// Bodies of 2 bytes, 5 KiB and 500 KiB, each a valid empty lease list.
+	sizes := []int{2, 5 << 10, 500 << 10}
+	for _, n := range sizes {
+		body = "[" + strings.Repeat(" ", n-2) + "]"
+		_, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mf, ok := gather(t, e)["uls_api_response_bytes"]
+	if !ok || len(mf.Metric) != 1 {
+		t.Fatal("uls_api_response_bytes not found")
+	}
+	h := mf.Metric[0].Histogram
+	// gather scrapes once more with the last body.
+	if h.GetSampleCount() != 4 {
+		t.Fatalf("got %d samples, want 4", h.GetSampleCount())
+	}
+	want := map[float64]uint64{1 << 10: 1, 10 << 10: 2, 100 << 10: 2, 1 << 20: 4}
+	for _, b := range h.Bucket {
+		if got := b.GetCumulativeCount(); got != want[b.GetUpperBound()] {
+			t.Errorf("bucket le=%v: got %d, want %d", b.GetUpperBound(), got, want[b.GetUpperBound()])
+		}
+	}
+	if got, want := h.GetSampleSum(), float64(2+5<<10+2*500<<10); got != want {
+		t.Errorf("got sum %v, want %v", got, want)
+	}
+}
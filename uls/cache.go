@@ -0,0 +1,140 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+const leaseCacheSize = 16
+
+type leaseCacheKey struct {
+	TargetURL string
+	Timestamp int64
+}
+
+type leaseCache struct {
+	window       time.Duration
+	errorTTL     time.Duration
+	fetchTimeout time.Duration
+	// fetches is the context of fetches, cancelled by Close.
+	fetches      context.Context
+	cancel       context.CancelFunc
+	entries      *lru.Cache[leaseCacheKey, []ULSLease]
+	group        singleflight.Group
+	deduped      uint64
+	negativeHits uint64
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	lastErr  error
+	errUntil time.Time
+}
+
+// newLeaseCache returns a cache of leases for window, and of fetch errors
+// for errorTTL. Fetches are limited to fetchTimeout, unless it is 0, and
+// run until Close otherwise.
+func newLeaseCache(window, errorTTL, fetchTimeout time.Duration) (*leaseCache, error) {
+	entries, err := lru.New[leaseCacheKey, []ULSLease](leaseCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &leaseCache{window: window, errorTTL: errorTTL, fetchTimeout: fetchTimeout, entries: entries, now: time.Now}
+	c.fetches, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Close cancels the fetches in progress.
+func (c *leaseCache) Close() {
+	c.cancel()
+}
+
+// Get returns the cached leases of targetURL or fetches them, sharing the
+// fetch with concurrent callers. The fetch is not cancelled with ctx, which
+// only ends the wait of this caller, so that one cancelled scrape does not
+// fail the others.
+func (c *leaseCache) Get(ctx context.Context, targetURL string, fetch func(context.Context) ([]ULSLease, error)) ([]ULSLease, error) {
+	key := leaseCacheKey{
+		TargetURL: targetURL,
+		Timestamp: c.now().Truncate(c.window).UnixNano(),
+	}
+	if err := c.cachedError(); err != nil {
+		atomic.AddUint64(&c.negativeHits, 1)
+		return nil, err
+	}
+	fetched := false
+	results := c.group.DoChan(targetURL, func() (interface{}, error) {
+		if err := c.cachedError(); err != nil {
+			return nil, err
+		}
+		if leases, ok := c.entries.Get(key); ok {
+			return leases, nil
+		}
+		fetched = true
+		fetchCtx, cancel := c.fetchContext()
+		defer cancel()
+		leases, err := fetch(fetchCtx)
+		if err != nil {
+			// A timed out or cancelled fetch says nothing about the ULS API.
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+				c.cacheError(err)
+			}
+			return nil, err
+		}
+		c.entries.Add(key, leases)
+		return leases, nil
+	})
+	var r singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r = <-results:
+	}
+	if r.Err != nil {
+		if !fetched {
+			atomic.AddUint64(&c.negativeHits, 1)
+		}
+		return nil, r.Err
+	}
+	if !fetched {
+		atomic.AddUint64(&c.deduped, 1)
+	}
+	return r.Val.([]ULSLease), nil
+}
+
+func (c *leaseCache) fetchContext() (context.Context, context.CancelFunc) {
+	if c.fetchTimeout > 0 {
+		return context.WithTimeout(c.fetches, c.fetchTimeout)
+	}
+	return context.WithCancel(c.fetches)
+}
+
+func (c *leaseCache) Deduped() uint64 {
+	return atomic.LoadUint64(&c.deduped)
+}
+
+func (c *leaseCache) NegativeHits() uint64 {
+	return atomic.LoadUint64(&c.negativeHits)
+}
+
+func (c *leaseCache) cachedError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastErr != nil && c.now().Before(c.errUntil) {
+		return c.lastErr
+	}
+	return nil
+}
+
+func (c *leaseCache) cacheError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+	c.errUntil = c.now().Add(c.errorTTL)
+}
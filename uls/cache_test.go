@@ -0,0 +1,145 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func collectConcurrently(e *ULSExporter, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch := make(chan prometheus.Metric)
+			go func() {
+				for range ch {
+				}
+			}()
+			e.Collect(ch)
+			close(ch)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCacheDeduplicatesConcurrentCollect(t *testing.T) {
+	srv := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(leasesJSON(leaseJSON(1, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"))))
+	})
+	e := newTestExporter(t, srv.URL, ExporterOptions{CacheWindow: time.Hour})
+
+	collectConcurrently(e, 10)
+
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("got %d backend requests, want 1", n)
+	}
+	if n := e.cache.Deduped(); n != 9 {
+		t.Errorf("got %d deduped fetches, want 9", n)
+	}
+	families := gather(t, e)
+	if v := metricValue(t, families, "uls_singleflight_deduped_total"); v != 10 {
+		t.Errorf("got uls_singleflight_deduped_total %v, want 10", v)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	srv := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	})
+	e := newTestExporter(t, srv.URL, ExporterOptions{ErrorCacheTTL: 5 * time.Second, DisableRetryOn503: true})
+	now := time.Now()
+	e.cache.now = func() time.Time { return now }
+
+	collectConcurrently(e, 10)
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("got %d backend requests within TTL, want 1", n)
+	}
+	if n := e.cache.NegativeHits(); n != 9 {
+		t.Errorf("got %d negative cache hits, want 9", n)
+	}
+	if n := e.cache.Deduped(); n != 0 {
+		t.Errorf("got %d deduped fetches, want 0", n)
+	}
+
+	now = now.Add(5 * time.Second)
+	collectConcurrently(e, 10)
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("got %d backend requests after TTL, want 2", n)
+	}
+	if n := e.cache.NegativeHits(); n != 18 {
+		t.Errorf("got %d negative cache hits, want 18", n)
+	}
+}
+
+func TestCacheCancelledCaller(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var requests int32
+	srv := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-release
+		}
+		w.Write([]byte(nLeasesJSON(2)))
+	})
+	e := newTestExporter(t, srv.URL, ExporterOptions{ErrorCacheTTL: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := e.cache.Get(ctx, e.BaseURL.String(), e.fetchLeases)
+		errs <- err
+	}()
+	<-started
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v from the cancelled caller, want %v", err, context.Canceled)
+	}
+	close(release)
+
+	leases, err := e.cache.Get(context.Background(), e.BaseURL.String(), e.fetchLeases)
+	if err != nil {
+		t.Fatalf("got error %v after a cancelled caller, want none", err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+	if n := e.cache.NegativeHits(); n != 0 {
+		t.Errorf("got %d negative cache hits, want 0", n)
+	}
+}
+
+func TestCacheContextErrorNotCached(t *testing.T) {
+	c, err := newLeaseCache(time.Hour, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.Get(context.Background(), "http://uls", func(context.Context) ([]ULSLease, error) {
+		return nil, context.DeadlineExceeded
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	leases, err := c.Get(context.Background(), "http://uls", func(context.Context) ([]ULSLease, error) {
+		return []ULSLease{{}}, nil
+	})
+	if err != nil {
+		t.Fatalf("got error %v after a timed out fetch, want none", err)
+	}
+	if len(leases) != 1 {
+		t.Errorf("got %d leases, want 1", len(leases))
+	}
+	if n := c.NegativeHits(); n != 0 {
+		t.Errorf("got %d negative cache hits, want 0", n)
+	}
+}
@@ -0,0 +1,44 @@
+package uls
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type FamilyCardinality struct {
+	Name        string `json:"name"`
+	Cardinality int    `json:"cardinality"`
+}
+
+type CardinalityReport struct {
+	Families []FamilyCardinality `json:"families"`
+}
+
+// CardinalityHandler reports the number of label combinations of every
+// metric family gathered from g and the exporter, highest first.
+func (e *ULSExporter) CardinalityHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrape, err := e.Gatherer(r.Context(), g)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mfs, err := scrape.Gather()
+		if err != nil && len(mfs) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report := CardinalityReport{Families: make([]FamilyCardinality, 0, len(mfs))}
+		for _, mf := range mfs {
+			report.Families = append(report.Families, FamilyCardinality{Name: mf.GetName(), Cardinality: len(mf.Metric)})
+		}
+		sort.SliceStable(report.Families, func(i, j int) bool {
+			return report.Families[i].Cardinality > report.Families[j].Cardinality
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+}
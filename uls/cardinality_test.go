@@ -0,0 +1,49 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCardinalityHandler(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"token":"6ba7b810-9dad-11d1-80b4-00c04fd430c1","createdTimeUtc":"2021-01-01T00:00:00Z","entitlementGroupIds":["a","b","c","d","e"]}
+		]`)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "other_total", Help: "Other."}))
+
+	rec := httptest.NewRecorder()
+	e.CardinalityHandler(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/cardinality", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report CardinalityReport
+	err := json.Unmarshal(rec.Body.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int{}
+	for i, f := range report.Families {
+		got[f.Name] = f.Cardinality
+		if i > 0 && f.Cardinality > report.Families[i-1].Cardinality {
+			t.Errorf("%s (%d) sorted after %s (%d)", f.Name, f.Cardinality, report.Families[i-1].Name, report.Families[i-1].Cardinality)
+		}
+	}
+	for name, want := range map[string]int{"uls_up": 1, "uls_leases": 1, "uls_lease_age_seconds_by_group": 5, "uls_entitlement_group_lease_fraction": 5, "other_total": 1} {
+		if got[name] != want {
+			t.Errorf("%s: cardinality %d, want %d", name, got[name], want)
+		}
+	}
+	if report.Families[0].Cardinality != 5 {
+		t.Errorf("highest cardinality family is %s with %d", report.Families[0].Name, report.Families[0].Cardinality)
+	}
+}
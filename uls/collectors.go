@@ -0,0 +1,30 @@
+package uls
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// runtimeCollectors registers or unregisters the process and Go runtime
+// collectors on r. The default registry starts with both registered.
+func runtimeCollectors(r prometheus.Registerer, process, goRuntime bool) error {
+	for _, c := range []struct {
+		collector prometheus.Collector
+		enabled   bool
+	}{
+		{prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}), process},
+		{prometheus.NewGoCollector(), goRuntime},
+	} {
+		if !c.enabled {
+			r.Unregister(c.collector)
+			continue
+		}
+		err := r.Register(c.collector)
+		var registered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &registered) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package uls
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func gatheredPrefixes(t *testing.T, g prometheus.Gatherer) map[string]bool {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixes := map[string]bool{}
+	for _, mf := range families {
+		prefixes[strings.SplitN(mf.GetName(), "_", 2)[0]] = true
+	}
+	return prefixes
+}
+
+func TestRuntimeCollectors(t *testing.T) {
+	for _, tc := range []struct {
+		process, goRuntime bool
+	}{
+		{true, true},
+		{true, false},
+		{false, true},
+		{false, false},
+	} {
+		// Start like the default registry, with both collectors registered.
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}), prometheus.NewGoCollector())
+		err := runtimeCollectors(reg, tc.process, tc.goRuntime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefixes := gatheredPrefixes(t, reg)
+		if prefixes["process"] != tc.process {
+			t.Errorf("process=%v go=%v: process metrics gathered = %v", tc.process, tc.goRuntime, prefixes["process"])
+		}
+		if prefixes["go"] != tc.goRuntime {
+			t.Errorf("process=%v go=%v: go metrics gathered = %v", tc.process, tc.goRuntime, prefixes["go"])
+		}
+	}
+}
+
+func TestRuntimeCollectorsRegisters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	err := runtimeCollectors(reg, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefixes := gatheredPrefixes(t, reg)
+	if !prefixes["process"] || !prefixes["go"] {
+		t.Errorf("got metric prefixes %v, want process and go", prefixes)
+	}
+}
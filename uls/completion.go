@@ -0,0 +1,125 @@
+package uls
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// completionFlag is what the completion scripts know about a flag.
+type completionFlag struct {
+	Name   string
+	Usage  string
+	Bool   bool
+	File   bool
+	Values []string
+}
+
+// pathUsage matches the usage of flags that take a path.
+var pathUsage = regexp.MustCompile(`(?i)\b(file|directory|socket)\b`)
+
+// completionFlags lists the flags of fs sorted by name. Flags taking a path
+// complete paths, and those with a fixed set of values in the config schema
+// complete them.
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		c := completionFlag{Name: f.Name, Usage: f.Usage}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			c.Bool = true
+		}
+		c.File = pathUsage.MatchString(f.Usage)
+		if enum, ok := schemaRules[f.Name]["enum"].([]string); ok {
+			c.Values = enum
+		}
+		flags = append(flags, c)
+	})
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+var completionFuncs = template.FuncMap{
+	"join": strings.Join,
+	// single quotes s for sh and fish.
+	"single": func(s string) string {
+		return strings.ReplaceAll(s, "'", `'\''`)
+	},
+	// zsh escapes the characters _arguments gives a meaning to.
+	"zsh": func(s string) string {
+		return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+	},
+}
+
+// The bash script fills COMPREPLY with read rather than an array
+// assignment, so that it also parses as POSIX sh.
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for uls_exporter
+_uls_exporter_reply() {
+	local IFS='
+'
+	read -r -d '' -a COMPREPLY || true
+}
+
+_uls_exporter() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local prev="${COMP_WORDS[COMP_CWORD-1]}"
+	case "$prev" in
+{{- range .}}{{if .Values}}
+	-{{.Name}}|--{{.Name}})
+		_uls_exporter_reply <<EOF
+$(compgen -W '{{join .Values " "}}' -- "$cur")
+EOF
+		return
+		;;
+{{- end}}{{end}}
+	{{range $i, $f := .}}{{if and $f.File (not $f.Values)}}-{{$f.Name}}|--{{$f.Name}}|{{end}}{{end}}-__file)
+		_uls_exporter_reply <<EOF
+$(compgen -f -- "$cur")
+EOF
+		return
+		;;
+	{{range $i, $f := .}}{{if not (or $f.Bool $f.File $f.Values)}}-{{$f.Name}}|--{{$f.Name}}|{{end}}{{end}}-__value)
+		return
+		;;
+	esac
+	_uls_exporter_reply <<EOF
+$(compgen -W '{{range .}}-{{.Name}} {{end}}' -- "$cur")
+EOF
+}
+
+complete -F _uls_exporter uls_exporter
+`,
+	"zsh": `#compdef uls_exporter
+
+_arguments \
+{{- range .}}
+	'-{{.Name}}[{{zsh .Usage}}]{{if .Values}}:{{.Name}}:({{join .Values " "}}){{else if .File}}:{{.Name}}:_files{{else if not .Bool}}:{{.Name}}:{{end}}' \
+{{- end}}
+	&& return 0
+`,
+	"fish": `# fish completion for uls_exporter
+{{- range .}}
+complete -c uls_exporter -o '{{.Name}}' -d '{{single .Usage}}'{{if .Values}} -x -a '{{join .Values " "}}'{{else if .File}} -r -F{{else if not .Bool}} -x{{end}}
+{{- end}}
+`,
+}
+
+// writeCompletion writes a completion script for the flags of fs for shell,
+// which is bash, zsh or fish.
+func writeCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	text, ok := completionTemplates[shell]
+	if !ok {
+		return fmt.Errorf("completion shell %q must be bash, zsh or fish", shell)
+	}
+	t, err := template.New(shell).Funcs(completionFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, completionFlags(fs))
+}
@@ -0,0 +1,120 @@
+package uls
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func completionFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("uls_exporter", flag.ContinueOnError)
+	(&App{}).flags(fs)
+	return fs
+}
+
+func completion(t *testing.T, shell string) string {
+	t.Helper()
+	var b bytes.Buffer
+	err := writeCompletion(&b, shell, completionFlagSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestCompletionBashSyntax(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not installed")
+	}
+	script := filepath.Join(t.TempDir(), "uls_exporter.bash")
+	err = os.WriteFile(script, []byte(completion(t, "bash")), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(sh, "-n", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sh -n: %v\n%s", err, out)
+	}
+}
+
+func TestCompletionBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	script := filepath.Join(t.TempDir(), "uls_exporter.bash")
+	err = os.WriteFile(script, []byte(completion(t, "bash")), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"uls_exporter", "-list-metrics-f"}, "-list-metrics-format"},
+		{[]string{"uls_exporter", "-generate-completion", "z"}, "zsh"},
+		{[]string{"uls_exporter", "-min-tls-version", ""}, "1.0 1.1 1.2 1.3"},
+		{[]string{"uls_exporter", "-wal-dir", filepath.Join(filepath.Dir(script), "uls_")}, script},
+		{[]string{"uls_exporter", "-path", ""}, ""},
+	} {
+		cmd := exec.Command(bash, "-c", `source "$0"; COMP_WORDS=("$@"); COMP_CWORD=$(($# - 1)); _uls_exporter; echo "${COMPREPLY[*]}"`, script)
+		cmd.Args = append(cmd.Args, tc.words...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("completing %q: %v\n%s", tc.words, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("completing %q got %q, want %q", tc.words, got, tc.want)
+		}
+	}
+}
+
+func TestCompletionZsh(t *testing.T) {
+	script := completion(t, "zsh")
+	if !strings.HasPrefix(script, "#compdef uls_exporter\n") {
+		t.Errorf("zsh completion does not start with #compdef:\n%s", script)
+	}
+	for _, want := range []string{
+		`'-generate-completion[print a completion script for this shell, bash, zsh or fish, and exit]:generate-completion:(bash zsh fish)' \`,
+		`'-wal-dir[directory to write lease change events to]:wal-dir:_files' \`,
+		`'-version[print version information and exit]' \`,
+		`'-scrape-timeout[timeout for requests to the ULS API]:scrape-timeout:' \`,
+	} {
+		if !strings.Contains(script, want+"\n") {
+			t.Errorf("zsh completion does not contain %s", want)
+		}
+	}
+}
+
+func TestCompletionFish(t *testing.T) {
+	script := completion(t, "fish")
+	for _, want := range []string{
+		`complete -c uls_exporter -o 'generate-completion' -d 'print a completion script for this shell, bash, zsh or fish, and exit' -x -a 'bash zsh fish'`,
+		`complete -c uls_exporter -o 'wal-dir' -d 'directory to write lease change events to' -r -F`,
+		`complete -c uls_exporter -o 'version' -d 'print version information and exit'`,
+		`complete -c uls_exporter -o 'scrape-timeout' -d 'timeout for requests to the ULS API' -x`,
+	} {
+		if !strings.Contains(script, want+"\n") {
+			t.Errorf("fish completion does not contain %s", want)
+		}
+	}
+	// Every flag is completed.
+	lines := strings.Count(script, "\ncomplete -c uls_exporter ")
+	n := 0
+	completionFlagSet().VisitAll(func(*flag.Flag) { n++ })
+	if lines != n {
+		t.Errorf("fish completion completes %d flags, want %d", lines, n)
+	}
+}
+
+func TestCompletionUnknownShell(t *testing.T) {
+	err := writeCompletion(&bytes.Buffer{}, "csh", completionFlagSet())
+	if err == nil || !strings.Contains(err.Error(), `"csh"`) {
+		t.Errorf("got error %v for an unknown shell", err)
+	}
+}
@@ -0,0 +1,131 @@
+package uls
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+)
+
+type RecordingRule struct {
+	Record string            `yaml:"record"`
+	Expr   string            `yaml:"expr"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+//go:embed default_config.yaml
+var defaultConfig []byte
+
+type Config struct {
+	RecordingRules []RecordingRule `yaml:"recording_rules"`
+	LabelRenames   []LabelRename   `yaml:"label_rename"`
+	// FieldMapping maps JSON field names of leases to ULSLease fields.
+	FieldMapping map[string]string `yaml:"field_mapping"`
+
+	// Options holds flag values by flag name.
+	Options map[string]string `yaml:",inline"`
+}
+
+// loadConfig loads a YAML or TOML config file, by its extension.
+func loadConfig(path string) (*Config, error) {
+	parse := parseConfig
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	case ".toml":
+		parse = parseTOMLConfig
+	default:
+		return nil, fmt.Errorf("%s: config file extension %q must be .yaml, .yml or .toml", path, ext)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func parseConfig(b []byte) (*Config, error) {
+	var config Config
+	err := yaml.Unmarshal(b, &config)
+	if err != nil {
+		return nil, err
+	}
+	err = config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// parseTOMLConfig parses a TOML config by converting it to YAML, so that
+// Config is decoded the same way from both and options of any TOML type
+// become strings.
+func parseTOMLConfig(b []byte) (*Config, error) {
+	var v map[string]interface{}
+	err := toml.Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	y, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(y)
+}
+
+// apply sets the flags named in the options, except those for which skip
+// returns true.
+func (c *Config) apply(fs *flag.FlagSet, skip func(name string) bool) error {
+	names := make([]string, 0, len(c.Options))
+	for name := range c.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("unknown option %q", name)
+		}
+		if skip(name) {
+			continue
+		}
+		err := f.Value.Set(c.Options[name])
+		if err != nil {
+			return fmt.Errorf("option %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	for i, rule := range c.RecordingRules {
+		if !model.IsValidMetricName(model.LabelValue(rule.Record)) {
+			return fmt.Errorf("recording rule %d: invalid metric name %q", i, rule.Record)
+		}
+		_, err := parser.ParseExpr(rule.Expr)
+		if err != nil {
+			return fmt.Errorf("recording rule %s: %w", rule.Record, err)
+		}
+		for name := range rule.Labels {
+			if !model.LabelName(name).IsValid() {
+				return fmt.Errorf("recording rule %s: invalid label name %q", rule.Record, name)
+			}
+		}
+	}
+	_, err := newFieldMap(c.FieldMapping)
+	if err != nil {
+		return err
+	}
+	return validateLabelRenames(c.LabelRenames)
+}
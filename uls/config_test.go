@@ -0,0 +1,229 @@
+package uls
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+recording_rules:
+  - record: uls_lease_growth_rate
+    expr: rate(uls_leases[5m])
+    labels:
+      source: recorded
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.RecordingRules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(config.RecordingRules))
+	}
+	rule := config.RecordingRules[0]
+	if rule.Record != "uls_lease_growth_rate" || rule.Expr != "rate(uls_leases[5m])" || rule.Labels["source"] != "recorded" {
+		t.Errorf("got %+v", rule)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	for name, config := range map[string]Config{
+		"metric name": {RecordingRules: []RecordingRule{{Record: "bad name", Expr: "up"}}},
+		"expression":  {RecordingRules: []RecordingRule{{Record: "ok", Expr: "rate(up["}}},
+		"label name":  {RecordingRules: []RecordingRule{{Record: "ok", Expr: "up", Labels: map[string]string{"bad-label": "x"}}}},
+	} {
+		if config.validate() == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
+
+func TestDefaultConfigCoversAllFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	(&App{}).flags(fs)
+	config, err := parseConfig(defaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := config.Options[f.Name]; !ok && f.Name != "config" && f.Name != "version" && !strings.HasPrefix(f.Name, "list-metrics") && !strings.HasPrefix(f.Name, "generate-") {
+			t.Errorf("default config has no value for -%s", f.Name)
+		}
+	})
+	for name, value := range config.Options {
+		f := fs.Lookup(name)
+		if f == nil {
+			t.Errorf("default config option %q is not a flag", name)
+			continue
+		}
+		err := f.Value.Set(value)
+		if err != nil {
+			t.Errorf("-%s: %s", name, err)
+		}
+	}
+}
+
+func TestConfigureAppliesDefaultConfig(t *testing.T) {
+	app := &App{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	app.flags(fs)
+	// Zero the flag defaults so only the embedded config can set the values.
+	*app = App{}
+	config, err := parseConfig(defaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.apply(fs, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.Listen != ":9101" || app.Path != "/metrics" || app.URI != "http://localhost:8080" {
+		t.Errorf("got listen %q path %q uri %q", app.Listen, app.Path, app.URI)
+	}
+	if app.ScrapeTimeout != 10*time.Second || app.PluginTimeout != 5*time.Second || app.TLSReloadInterval != 5*time.Minute {
+		t.Errorf("got scrape timeout %s plugin timeout %s tls reload interval %s", app.ScrapeTimeout, app.PluginTimeout, app.TLSReloadInterval)
+	}
+}
+
+func TestConfigurePrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+listen: ":9200"
+path: /from-file
+scrape-timeout: 3s
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ULS_SCRAPE_TIMEOUT", "4s")
+
+	app := &App{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err = app.configure(fs, []string{"-config", path, "-path", "/from-flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if app.Listen != ":9200" {
+		t.Errorf("listen = %q, want the config file value", app.Listen)
+	}
+	if app.Path != "/from-flag" {
+		t.Errorf("path = %q, want the flag value", app.Path)
+	}
+	if app.ScrapeTimeout != 4*time.Second {
+		t.Errorf("scrape timeout = %s, want the environment value", app.ScrapeTimeout)
+	}
+	if app.URI != "http://localhost:8080" {
+		t.Errorf("uri = %q, want the default", app.URI)
+	}
+}
+
+func TestConfigureTOMLMatchesYAML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+listen: ":9200"
+scrape-timeout: 3s
+max-leases: 100
+sample-fraction: 0.5
+stream-response: true
+recording_rules:
+  - record: uls_lease_growth_rate
+    expr: rate(uls_leases[5m])
+    labels:
+      source: recorded
+label_rename:
+  - from: entitlement_group_id
+    to: group
+`,
+		"config.toml": `
+listen = ":9200"
+scrape-timeout = "3s"
+max-leases = 100
+sample-fraction = 0.5
+stream-response = true
+
+[[recording_rules]]
+record = "uls_lease_growth_rate"
+expr = "rate(uls_leases[5m])"
+labels = { source = "recorded" }
+
+[[label_rename]]
+from = "entitlement_group_id"
+to = "group"
+`,
+	}
+	apps := map[string]*App{}
+	configs := map[string]*Config{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := &App{}
+		config, err := app.configure(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path})
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		app.ConfigFile = ""
+		apps[name], configs[name] = app, config
+	}
+
+	if app := apps["config.toml"]; app.Listen != ":9200" || app.ScrapeTimeout != 3*time.Second || app.MaxLeases != 100 || app.SampleFraction != 0.5 || !app.StreamResponse {
+		t.Errorf("TOML options not applied: %+v", app)
+	}
+	if !reflect.DeepEqual(apps["config.toml"], apps["config.yaml"]) {
+		t.Errorf("TOML config gives\n%+v\nYAML config gives\n%+v", apps["config.toml"], apps["config.yaml"])
+	}
+	toml, yaml := configs["config.toml"], configs["config.yaml"]
+	if !reflect.DeepEqual(toml.RecordingRules, yaml.RecordingRules) || !reflect.DeepEqual(toml.LabelRenames, yaml.LabelRenames) || len(toml.RecordingRules) != 1 || len(toml.LabelRenames) != 1 {
+		t.Errorf("TOML config gives rules %+v and renames %+v, YAML config gives %+v and %+v", toml.RecordingRules, toml.LabelRenames, yaml.RecordingRules, yaml.LabelRenames)
+	}
+}
+
+func TestLoadConfigExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `extension ".json" must be .yaml, .yml or .toml`) {
+		t.Errorf("got error %v for a .json config file", err)
+	}
+}
+
+func TestConfigureUnixSocketEnv(t *testing.T) {
+	// The flag -uls-unix-socket is set by ULS_UNIX_SOCKET, not
+	// ULS_ULS_UNIX_SOCKET, so the default config must not override it.
+	socket := newUnixSocketServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	t.Setenv("ULS_UNIX_SOCKET", socket)
+
+	app := startApp(t, "-uri=http://localhost")
+	t.Cleanup(func() { app.Stop(context.Background()) })
+	if app.ULSUnixSocket != socket {
+		t.Fatalf("-uls-unix-socket = %q, want ULS_UNIX_SOCKET %q", app.ULSUnixSocket, socket)
+	}
+	out := scrapeApp(t, http.DefaultClient, app)
+	if !strings.Contains(out, "uls_leases{instance=") || !strings.Contains(out, "} 3\n") {
+		t.Errorf("leases not scraped through the socket:\n%s", out)
+	}
+}
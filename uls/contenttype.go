@@ -0,0 +1,28 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkContentType returns a ULSParseError unless res is JSON, so that the
+// HTML error pages of proxies are reported as such rather than as a syntax
+// error. Streamed responses may also be multipart, with JSON parts, and
+// NDJSON responses may be application/x-ndjson.
+func (e *ULSExporter) checkContentType(res *http.Response) error {
+	if e.skipContentTypeCheck {
+		return nil
+	}
+	contentType := res.Header.Get("Content-Type")
+	mediaType := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(mediaType, "application/json"):
+		return nil
+	case e.streamResponse && strings.HasPrefix(mediaType, "multipart/"):
+		return nil
+	case e.responseNDJSON && strings.Contains(mediaType, "ndjson"):
+		return nil
+	}
+	return &ULSParseError{Err: fmt.Errorf("response Content-Type is %q, want application/json", contentType)}
+}
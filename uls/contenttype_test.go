@@ -0,0 +1,69 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestContentTypeHTML(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>Gateway login</body></html>")
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("expected an error for an HTML response")
+	}
+	if !strings.Contains(err.Error(), `Content-Type is "text/html; charset=utf-8", want application/json`) {
+		t.Errorf("error does not name the Content-Type: %s", err)
+	}
+	if reason := scrapeErrorReason(err); reason != "parse" {
+		t.Errorf("got reason %q, want parse", reason)
+	}
+}
+
+func TestContentTypeAccepted(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		opts        ExporterOptions
+		ok          bool
+	}{
+		{"application/json", ExporterOptions{}, true},
+		{"application/json; charset=utf-8", ExporterOptions{}, true},
+		{"Application/JSON", ExporterOptions{}, true},
+		{"text/plain", ExporterOptions{}, false},
+		{"", ExporterOptions{}, false},
+		{"text/plain", ExporterOptions{SkipContentTypeCheck: true}, true},
+		{"application/x-ndjson", ExporterOptions{ResponseNDJSON: true}, true},
+		{"application/x-ndjson", ExporterOptions{}, false},
+		{"application/json", ExporterOptions{ResponseNDJSON: true}, true},
+		{"application/json", ExporterOptions{StreamResponse: true}, true},
+	} {
+		body := nLeasesJSON(2)
+		if tc.opts.ResponseNDJSON {
+			body = ndjsonLeases(2)
+		}
+		uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if tc.contentType == "" {
+				// Keep the server from sniffing one.
+				w.Header()["Content-Type"] = nil
+			} else {
+				w.Header().Set("Content-Type", tc.contentType)
+			}
+			fmt.Fprint(w, body)
+		})
+		e := newTestExporter(t, uls.URL, tc.opts)
+		leases, err := e.GetLeases()
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("%q %+v: %s", tc.contentType, tc.opts, err)
+		case tc.ok:
+			checkLeaseIDs(t, leases, 2)
+		case err == nil:
+			t.Errorf("%q %+v: expected an error", tc.contentType, tc.opts)
+		}
+	}
+}
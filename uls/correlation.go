@@ -0,0 +1,12 @@
+package uls
+
+import "fmt"
+
+const correlationIDHeader = "X-Correlation-ID"
+
+func correlationIDs(id string, response string) string {
+	if response == "" {
+		return "correlation id " + id
+	}
+	return fmt.Sprintf("correlation id %s, response correlation id %s", id, response)
+}
@@ -0,0 +1,65 @@
+package uls
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	log.SetOutput(buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
+
+func TestCorrelationID(t *testing.T) {
+	logs := captureLog(t)
+	var rec headerRecorder
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		rec.values = append(rec.values, r.Header.Get(correlationIDHeader))
+		rec.mu.Unlock()
+		w.Header().Set(correlationIDHeader, "uls-side-id")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	families := gather(t, e)
+
+	id := rec.last()
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("ULS received correlation id %q: %s", id, err)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "correlation id "+id) || !strings.Contains(out, "response correlation id uls-side-id") {
+		t.Errorf("log %q does not contain both correlation ids", out)
+	}
+	if got := metricValue(t, families, "uls_requests_with_correlation_id_total"); got != 1 {
+		t.Errorf("uls_requests_with_correlation_id_total = %v, want 1", got)
+	}
+}
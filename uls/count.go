@@ -0,0 +1,77 @@
+package uls
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var errNoScrape = errors.New("no scrape yet")
+
+type lastScrape struct {
+	mu     sync.Mutex
+	leases []ULSLease
+	err    error
+	ok     bool
+}
+
+func (s *lastScrape) Set(leases []ULSLease, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leases, s.err, s.ok = leases, err, true
+}
+
+func (s *lastScrape) Get() ([]ULSLease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ok {
+		return nil, errNoScrape
+	}
+	return s.leases, s.err
+}
+
+func activeLeases(leases []ULSLease, group string) int {
+	n := 0
+	for _, l := range leases {
+		if l.IsRevoked {
+			continue
+		}
+		if group != "" && !hasGroup(l, group) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func hasGroup(l ULSLease, group string) bool {
+	for _, id := range l.EntitlementGroupIDs {
+		if id == group {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaseCountHandler serves the number of active leases from the last scrape
+// as a plain integer, or as {"count": N} when JSON is accepted.
+func (e *ULSExporter) LeaseCountHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leases, err := e.last.Get()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		n := activeLeases(leases, r.URL.Query().Get("group"))
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]int{"count": n})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, n)
+	})
+}
@@ -0,0 +1,93 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func getLeaseCount(t *testing.T, e *ULSExporter, target string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	e.LeaseCountHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func leasesWithGroups() string {
+	return `[
+		{"floatingLeaseId":1,"token":"00000000-0000-0000-0000-000000000001","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["a"]},
+		{"floatingLeaseId":2,"token":"00000000-0000-0000-0000-000000000002","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["a","b"]},
+		{"floatingLeaseId":3,"token":"00000000-0000-0000-0000-000000000003","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["b"]},
+		{"floatingLeaseId":4,"token":"00000000-0000-0000-0000-000000000004","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":true,"clientEntitlementContext":{},"entitlementGroupIds":["a"]}
+	]`
+}
+
+func TestLeaseCount(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, leasesWithGroups())
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	gather(t, e)
+
+	rec := getLeaseCount(t, e, "/lease/count", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "3\n" {
+		t.Errorf("got %d %q, want 200 \"3\\n\"", rec.Code, rec.Body.String())
+	}
+
+	rec = getLeaseCount(t, e, "/lease/count", "application/json")
+	var body struct{ Count int }
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 3 {
+		t.Errorf("got count %d, want 3", body.Count)
+	}
+	if s.Requests() != 1 {
+		t.Errorf("got %d ULS requests, want 1", s.Requests())
+	}
+}
+
+func TestLeaseCountGroup(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, leasesWithGroups())
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	gather(t, e)
+
+	for group, want := range map[string]string{"a": "2\n", "b": "2\n", "c": "0\n"} {
+		rec := getLeaseCount(t, e, "/lease/count?group="+group, "")
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("group %s: got %d %q, want 200 %q", group, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestLeaseCountUnavailable(t *testing.T) {
+	var fail int32
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, leasesWithGroups())
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	if rec := getLeaseCount(t, e, "/lease/count", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("before any scrape: got %d, want 503", rec.Code)
+	}
+	gather(t, e)
+	atomic.StoreInt32(&fail, 1)
+	gather(t, e)
+	if rec := getLeaseCount(t, e, "/lease/count", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("after a failed scrape: got %d, want 503", rec.Code)
+	}
+}
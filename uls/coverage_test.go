@@ -0,0 +1,164 @@
+package uls
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// minCoverage is the statement coverage the package's tests must reach.
+const minCoverage = 0.8
+
+// TestCoverageEnforcement only runs when coverage is collected, as with
+// go test -cover or -coverprofile. It runs the package's other tests again in
+// a child process with its own profile, so the result does not depend on
+// -run or on the order tests run in.
+func TestCoverageEnforcement(t *testing.T) {
+	if testing.CoverMode() == "" {
+		t.Skip("coverage is not being collected")
+	}
+	if os.Getenv("ULS_COVERAGE_CHILD") == "1" {
+		t.Skip("running as the coverage child")
+	}
+	profile := filepath.Join(t.TempDir(), "cover.out")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.coverprofile="+profile)
+	cmd.Env = append(os.Environ(), "ULS_COVERAGE_CHILD=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("tests failed: %s\n%s", err, out)
+	}
+	coverage, err := profileCoverage(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("statement coverage %.1f%%", 100*coverage)
+	if coverage < minCoverage {
+		t.Errorf("statement coverage %.1f%% is below %.0f%%", 100*coverage, 100*minCoverage)
+	}
+}
+
+// profileCoverage returns the fraction of statements covered in a
+// -coverprofile file. A block listed more than once counts as covered if any
+// of its entries is.
+func profileCoverage(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	type block struct {
+		stmts   int
+		covered bool
+	}
+	blocks := map[string]*block{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "mode:") || line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("invalid profile line %q", line)
+		}
+		stmts, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid profile line %q", line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid profile line %q", line)
+		}
+		b, ok := blocks[fields[0]]
+		if !ok {
+			b = &block{stmts: stmts}
+			blocks[fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	var total, covered int
+	for _, b := range blocks {
+		total += b.stmts
+		if b.covered {
+			covered += b.stmts
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("%s has no statements", path)
+	}
+	return float64(covered) / float64(total), nil
+}
+
+func TestProfileCoverage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cover.out")
+	profile := "mode: atomic\n" +
+		"uls_exporter/uls/a.go:1.1,2.2 3 1\n" +
+		"uls_exporter/uls/a.go:3.1,4.2 1 0\n" +
+		"uls_exporter/uls/a.go:3.1,4.2 1 2\n" +
+		"uls_exporter/uls/a.go:5.1,6.2 4 0\n"
+	err := os.WriteFile(path, []byte(profile), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := profileCoverage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0.5 {
+		t.Errorf("got coverage %v, want 0.5", got)
+	}
+}
+
+// TestCollectDescribed checks GetLeases, Collect and Describe together with
+// the optional metrics enabled: a pedantic registry fails to gather metrics
+// that were not described.
+func TestCollectDescribed(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{
+		LeaseWarningThreshold:  1,
+		LeaseCriticalThreshold: 2,
+		LeaseCountAsCounter:    true,
+		NativeHistograms:       true,
+		WALDir:                 t.TempDir(),
+	})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 3 {
+		t.Fatalf("got %d leases, want 3", len(leases))
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, mf := range families {
+		names[mf.GetName()] = true
+	}
+	for _, name := range []string{"uls_up", "uls_leases_total", "uls_lease_threshold_exceeded", "uls_scrape_duration_seconds", "uls_lease_age_seconds"} {
+		if !names[name] {
+			t.Errorf("%s not collected", name)
+		}
+	}
+}
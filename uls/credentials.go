@@ -0,0 +1,127 @@
+package uls
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fileCredential struct {
+	path     string
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	value  string
+	loaded time.Time
+}
+
+func newFileCredential(path string, interval time.Duration) (*fileCredential, error) {
+	c := &fileCredential{path: path, interval: interval, now: time.Now}
+	value, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	c.value, c.loaded = value, c.now()
+	return c, nil
+}
+
+func (c *fileCredential) Get() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if now.Sub(c.loaded) < c.interval {
+		return c.value
+	}
+	c.loaded = now
+	value, err := c.read()
+	if err != nil {
+		log.Printf("reloading credential: %v", err)
+		return c.value
+	}
+	c.value = value
+	return c.value
+}
+
+func (c *fileCredential) read() (string, error) {
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(b))
+	if value == "" {
+		return "", errors.New(c.path + ": empty credential")
+	}
+	return value, nil
+}
+
+// credential is a secret that may change, such as a fileCredential.
+type credential interface {
+	Get() string
+}
+
+type authTransport struct {
+	base     http.RoundTripper
+	token    credential
+	username string
+	password credential
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	switch {
+	case t.token != nil:
+		req.Header.Set("Authorization", "Bearer "+t.token.Get())
+	case t.password != nil:
+		req.SetBasicAuth(t.username, t.password.Get())
+	}
+	return t.base.RoundTrip(req)
+}
+
+func newAuthTransport(base http.RoundTripper, baseURL *url.URL, paths *pathRewrite, opts ExporterOptions) (http.RoundTripper, error) {
+	n := 0
+	token := opts.AuthToken != "" || opts.AuthTokenFile != ""
+	password := opts.BasicAuthPassword != "" || opts.BasicAuthPasswordFile != ""
+	for _, set := range []bool{token, password, opts.OIDCTokenURL != "", opts.SAMLIdPURL != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, errors.New("auth token, basic auth password, OIDC and SAML are mutually exclusive")
+	}
+	if opts.OIDCTokenURL != "" {
+		return newOIDCTransport(base, opts), nil
+	}
+	if opts.SAMLIdPURL != "" {
+		return newSAMLTransport(base, baseURL, paths, opts)
+	}
+	if n == 0 {
+		return base, nil
+	}
+	t := &authTransport{base: base, username: opts.BasicAuthUsername}
+	switch {
+	case opts.AuthToken != "":
+		t.token = staticCredential(opts.AuthToken)
+	case opts.BasicAuthPassword != "":
+		t.password = staticCredential(opts.BasicAuthPassword)
+	case token:
+		c, err := newFileCredential(opts.AuthTokenFile, opts.CredentialRefreshInterval)
+		if err != nil {
+			return nil, err
+		}
+		t.token = c
+	default:
+		c, err := newFileCredential(opts.BasicAuthPasswordFile, opts.CredentialRefreshInterval)
+		if err != nil {
+			return nil, err
+		}
+		t.password = c
+	}
+	return t, nil
+}
@@ -0,0 +1,116 @@
+package uls
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type headerRecorder struct {
+	mu     sync.Mutex
+	values []string
+}
+
+func (h *headerRecorder) handler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.values = append(h.values, r.Header.Get(name))
+		h.mu.Unlock()
+		w.Write([]byte(leasesJSON()))
+	}
+}
+
+func (h *headerRecorder) last() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.values) == 0 {
+		return ""
+	}
+	return h.values[len(h.values)-1]
+}
+
+func writeSecret(t *testing.T, path string, value string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(value), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthTokenFileRefresh(t *testing.T) {
+	secrets := t.TempDir()
+	tokenFile := filepath.Join(secrets, "token")
+	writeSecret(t, tokenFile, "first\n")
+	var rec headerRecorder
+	uls := newCountingServer(t, rec.handler("Authorization"))
+	e := newTestExporter(t, uls.URL, ExporterOptions{
+		AuthTokenFile:             tokenFile,
+		CredentialRefreshInterval: time.Minute,
+	})
+	token := e.client.Transport.(*authTransport).token.(*fileCredential)
+	now := time.Now()
+	token.now = func() time.Time { return now }
+
+	gather(t, e)
+	if got := rec.last(); got != "Bearer first" {
+		t.Errorf("got %q, want Bearer first", got)
+	}
+
+	writeSecret(t, tokenFile, "second\n")
+	gather(t, e)
+	if got := rec.last(); got != "Bearer first" {
+		t.Errorf("within refresh interval: got %q, want Bearer first", got)
+	}
+
+	now = now.Add(time.Minute)
+	gather(t, e)
+	if got := rec.last(); got != "Bearer second" {
+		t.Errorf("after refresh interval: got %q, want Bearer second", got)
+	}
+
+	os.Remove(tokenFile)
+	now = now.Add(time.Minute)
+	gather(t, e)
+	if got := rec.last(); got != "Bearer second" {
+		t.Errorf("after failed refresh: got %q, want last good Bearer second", got)
+	}
+}
+
+func TestBasicAuthPasswordFile(t *testing.T) {
+	secrets := t.TempDir()
+	passwordFile := filepath.Join(secrets, "password")
+	writeSecret(t, passwordFile, "s3cret")
+	var rec headerRecorder
+	uls := newCountingServer(t, rec.handler("Authorization"))
+	e := newTestExporter(t, uls.URL, ExporterOptions{
+		BasicAuthUsername:     "admin",
+		BasicAuthPasswordFile: passwordFile,
+	})
+
+	gather(t, e)
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	if got, want := rec.last(), req.Header.Get("Authorization"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCredentialFileErrors(t *testing.T) {
+	secrets := t.TempDir()
+	empty := filepath.Join(secrets, "empty")
+	writeSecret(t, empty, "\n")
+	for name, opts := range map[string]ExporterOptions{
+		"missing": {AuthTokenFile: filepath.Join(secrets, "missing")},
+		"empty":   {AuthTokenFile: empty},
+		"both":    {AuthTokenFile: empty, BasicAuthPasswordFile: empty},
+	} {
+		_, err := NewULSExporter("http://localhost", opts)
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package uls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// runCron gathers the metrics every -cron-interval until ctx is done,
+// writing each gather to w as a line of MetricsSnapshot JSON, instead of
+// serving them over HTTP.
+func (app *App) runCron(ctx context.Context, w io.Writer) error {
+	if app.CronInterval <= 0 {
+		return errors.New("cron interval must be positive")
+	}
+	_, stop, err := app.start(app.config)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	app.logBanner(app.config)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(app.CronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		mfs, err := app.gather(ctx)
+		if err != nil {
+			log.Printf("cron: %s", err)
+			if mfs == nil {
+				continue
+			}
+		}
+		err = enc.Encode(MetricsSnapshot{Time: time.Now().UTC(), Metrics: metricSamples(mfs)})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package uls
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	app := &App{}
+	config, err := app.configure(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"-uri=" + uls.URL, "-skip-health-scrape", "-instance-label=cron", "-cron-interval=1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.config = config
+
+	r, w := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- app.runCron(ctx, w)
+		w.Close()
+	}()
+	snapshots := make(chan MetricsSnapshot)
+	go func() {
+		defer close(snapshots)
+		dec := json.NewDecoder(r)
+		for {
+			var s MetricsSnapshot
+			if dec.Decode(&s) != nil {
+				return
+			}
+			snapshots <- s
+		}
+	}()
+
+	timeout := time.After(3 * time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-snapshots:
+			leases := false
+			for _, m := range s.Metrics {
+				if m.Name == "uls_leases" {
+					leases = true
+					if m.Value != 2 || m.Labels["instance"] != "cron" {
+						t.Errorf("output %d: got uls_leases %v %v, want 2 with instance cron", i+1, m.Value, m.Labels)
+					}
+				}
+			}
+			if !leases {
+				t.Errorf("output %d has no uls_leases: %+v", i+1, s)
+			}
+		case <-timeout:
+			t.Fatalf("got %d outputs within 3s, want 2", i)
+		}
+	}
+	if app.httpServer != nil {
+		t.Error("cron mode started the HTTP server")
+	}
+
+	cancel()
+	go func() {
+		for range snapshots {
+		}
+	}()
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCronIntervalInvalid(t *testing.T) {
+	err := (&App{CronInterval: -time.Second}).runCron(context.Background(), ioutil.Discard)
+	if err == nil {
+		t.Error("expected an error for a negative cron interval")
+	}
+}
@@ -0,0 +1,26 @@
+package uls
+
+import (
+	_ "embed"
+	"io"
+	"net/http"
+)
+
+// dashboard is a Grafana dashboard of the exporter's metrics.
+//
+//go:embed dashboards/uls.json
+var dashboard []byte
+
+func writeDashboard(w io.Writer) error {
+	_, err := w.Write(dashboard)
+	return err
+}
+
+// DashboardHandler serves the Grafana dashboard, for importing it into
+// Grafana.
+func DashboardHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(dashboard)
+	})
+}
@@ -0,0 +1,125 @@
+package uls
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type dashboardPanel struct {
+	Title      string `json:"title"`
+	Type       string `json:"type"`
+	Datasource struct {
+		Type string `json:"type"`
+		UID  string `json:"uid"`
+	} `json:"datasource"`
+	Targets []struct {
+		Expr string `json:"expr"`
+	} `json:"targets"`
+}
+
+func TestDashboard(t *testing.T) {
+	var doc struct {
+		UID        string           `json:"uid"`
+		Panels     []dashboardPanel `json:"panels"`
+		Templating struct {
+			List []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"list"`
+		} `json:"templating"`
+	}
+	err := json.Unmarshal(dashboard, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variables := map[string]string{}
+	for _, v := range doc.Templating.List {
+		variables[v.Name] = v.Type
+	}
+	if variables["datasource"] != "datasource" {
+		t.Errorf("dashboard has no datasource variable: %v", variables)
+	}
+
+	known := map[string]bool{}
+	for _, m := range Metrics() {
+		known[m.Name] = true
+	}
+	referenced := map[string]bool{}
+	// panels holds the titles of the panels using each metric.
+	panels := map[string][]string{}
+	for _, p := range doc.Panels {
+		if p.Type == "row" {
+			continue
+		}
+		if p.Datasource.Type != "prometheus" || p.Datasource.UID != "${datasource}" {
+			t.Errorf("panel %q has data source %+v, want the datasource variable", p.Title, p.Datasource)
+		}
+		if len(p.Targets) == 0 {
+			t.Errorf("panel %q has no queries", p.Title)
+		}
+		for _, target := range p.Targets {
+			// Grafana replaces $__rate_interval before querying.
+			expr, err := parser.ParseExpr(strings.ReplaceAll(target.Expr, "$__rate_interval", "5m"))
+			if err != nil {
+				t.Errorf("panel %q: %v", p.Title, err)
+				continue
+			}
+			parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+				vs, ok := node.(*parser.VectorSelector)
+				if !ok {
+					return nil
+				}
+				if vs.Name != "" {
+					name := metricName(vs.Name, known)
+					if !known[name] {
+						t.Errorf("panel %q refers to %s, which the exporter does not export", p.Title, vs.Name)
+					}
+					referenced[name] = true
+					panels[name] = append(panels[name], p.Title)
+					return nil
+				}
+				for _, m := range vs.LabelMatchers {
+					if m.Name != labels.MetricName || m.Type != labels.MatchRegexp {
+						continue
+					}
+					for name := range known {
+						if m.Matches(strings.ReplaceAll(name, "<component>", "database")) {
+							referenced[name] = true
+						}
+					}
+				}
+				return nil
+			})
+		}
+	}
+	for name := range known {
+		if !referenced[name] {
+			t.Errorf("no panel shows %s", name)
+		}
+	}
+	for _, name := range []string{"uls_up", "uls_leases", "uls_scrape_duration_seconds"} {
+		if len(panels[name]) == 0 {
+			t.Errorf("no panel queries %s directly", name)
+		}
+	}
+}
+
+func TestDashboardHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	DashboardHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if !json.Valid(rec.Body.Bytes()) || rec.Body.String() != string(dashboard) {
+		t.Errorf("/dashboard does not serve the dashboard")
+	}
+}
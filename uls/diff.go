@@ -0,0 +1,55 @@
+package uls
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LeaseEvent struct {
+	Time                time.Time `json:"time"`
+	Event               string    `json:"event"`
+	FloatingLeaseID     int       `json:"floatingLeaseId"`
+	Token               uuid.UUID `json:"token"`
+	EnvironmentHostname string    `json:"environmentHostname"`
+	EnvironmentUser     string    `json:"environmentUser"`
+	EntitlementGroupIDs []string  `json:"entitlementGroupIds"`
+}
+
+func newLeaseEvent(t time.Time, event string, l ULSLease) LeaseEvent {
+	return LeaseEvent{
+		Time:                t,
+		Event:               event,
+		FloatingLeaseID:     l.FloatingLeaseID,
+		Token:               l.Token,
+		EnvironmentHostname: l.ClientEntitlementContext.EnvironmentHostname,
+		EnvironmentUser:     l.ClientEntitlementContext.EnvironmentUser,
+		EntitlementGroupIDs: l.EntitlementGroupIDs,
+	}
+}
+
+func diffLeases(t time.Time, previous []ULSLease, current []ULSLease) []LeaseEvent {
+	prev := make(map[uuid.UUID]ULSLease, len(previous))
+	for _, p := range previous {
+		prev[p.Token] = p
+	}
+	cur := make(map[uuid.UUID]struct{}, len(current))
+	var events []LeaseEvent
+	for _, l := range current {
+		cur[l.Token] = struct{}{}
+		p, ok := prev[l.Token]
+		switch {
+		case !ok && !l.IsRevoked:
+			events = append(events, newLeaseEvent(t, "created", l))
+		case ok && !p.IsRevoked && l.IsRevoked:
+			events = append(events, newLeaseEvent(t, "revoked", l))
+		}
+	}
+	for _, p := range previous {
+		_, ok := cur[p.Token]
+		if !ok {
+			events = append(events, newLeaseEvent(t, "removed", p))
+		}
+	}
+	return events
+}
@@ -0,0 +1,45 @@
+package uls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDiffLeases(t *testing.T) {
+	kept := ULSLease{FloatingLeaseID: 1, Token: uuid.New()}
+	revoked := ULSLease{FloatingLeaseID: 2, Token: uuid.New()}
+	var removed []ULSLease
+	for i := 3; i < 8; i++ {
+		removed = append(removed, ULSLease{FloatingLeaseID: i, Token: uuid.New()})
+	}
+	created := ULSLease{FloatingLeaseID: 8, Token: uuid.New()}
+	previous := append([]ULSLease{kept, revoked}, removed...)
+	nowRevoked := revoked
+	nowRevoked.IsRevoked = true
+	current := []ULSLease{created, kept, nowRevoked}
+
+	events := diffLeases(time.Now(), previous, current)
+
+	want := []struct {
+		event string
+		id    int
+	}{
+		{"created", 8},
+		{"revoked", 2},
+		{"removed", 3},
+		{"removed", 4},
+		{"removed", 5},
+		{"removed", 6},
+		{"removed", 7},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Event != w.event || events[i].FloatingLeaseID != w.id {
+			t.Errorf("event %d: got %s for lease %d, want %s for lease %d", i, events[i].Event, events[i].FloatingLeaseID, w.event, w.id)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package uls
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultEnrichmentCacheTTL = 5 * time.Minute
+
+// UserInfo is the metadata an enrichment service returns for a user.
+type UserInfo struct {
+	Department string `json:"department"`
+	CostCenter string `json:"cost_center"`
+}
+
+type cachedUserInfo struct {
+	info    UserInfo
+	expires time.Time
+}
+
+// enricher looks up users with an enrichment service, which is POSTed a
+// JSON array of user names and answers with a JSON object of UserInfo by
+// user name. Users it leaves out have no metadata. Answers are cached for
+// ttl, and on errors the cached metadata, possibly expired, is used.
+type enricher struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+	errors uint64
+
+	mu    sync.Mutex
+	users map[string]cachedUserInfo
+}
+
+func newEnricher(url string, ttl time.Duration) *enricher {
+	return &enricher{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{},
+		now:    time.Now,
+		users:  map[string]cachedUserInfo{},
+	}
+}
+
+// Lookup returns the metadata of users, asking the enrichment service for
+// the ones not cached.
+func (en *enricher) Lookup(ctx context.Context, users []string) (map[string]UserInfo, error) {
+	now := en.now()
+	var missing []string
+	infos := map[string]UserInfo{}
+	en.mu.Lock()
+	for _, u := range users {
+		c, ok := en.users[u]
+		if ok {
+			infos[u] = c.info
+		}
+		if !ok || !now.Before(c.expires) {
+			missing = append(missing, u)
+		}
+	}
+	en.mu.Unlock()
+	if len(missing) == 0 {
+		return infos, nil
+	}
+	sort.Strings(missing)
+	fetched, err := en.fetch(ctx, missing)
+	if err != nil {
+		atomic.AddUint64(&en.errors, 1)
+		return infos, err
+	}
+	en.mu.Lock()
+	defer en.mu.Unlock()
+	for _, u := range missing {
+		info := fetched[u]
+		en.users[u] = cachedUserInfo{info: info, expires: now.Add(en.ttl)}
+		infos[u] = info
+	}
+	return infos, nil
+}
+
+func (en *enricher) fetch(ctx context.Context, users []string) (map[string]UserInfo, error) {
+	body, err := json.Marshal(users)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, en.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := en.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("enrichment: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enrichment: %s", res.Status)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("enrichment: %w", err)
+	}
+	var infos map[string]UserInfo
+	err = json.Unmarshal(b, &infos)
+	if err != nil {
+		return nil, fmt.Errorf("enrichment: %w", err)
+	}
+	return infos, nil
+}
+
+// Errors returns the number of failed lookups.
+func (en *enricher) Errors() uint64 {
+	return atomic.LoadUint64(&en.errors)
+}
+
+// countByUser counts leases by the user that holds them.
+func countByUser(leases []ULSLease) map[string]int {
+	users := map[string]int{}
+	for _, l := range leases {
+		users[l.ClientEntitlementContext.EnvironmentUser]++
+	}
+	return users
+}
@@ -0,0 +1,172 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func userLeasesJSON(users ...string) string {
+	leases := make([]string, len(users))
+	for i, u := range users {
+		leases[i] = fmt.Sprintf(`{"floatingLeaseId":%d,"token":"00000000-0000-0000-0000-%012d","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","clientEntitlementContext":{"EnvironmentUser":%q},"entitlementGroupIds":["group"]}`, i, i, u)
+	}
+	return leasesJSON(leases...)
+}
+
+// userLeases returns uls_leases_by_user as user/department/cost_center
+// keys.
+func userLeases(t *testing.T, families map[string]*dto.MetricFamily) map[string]float64 {
+	t.Helper()
+	values := map[string]float64{}
+	mf, ok := families["uls_leases_by_user"]
+	if !ok {
+		return values
+	}
+	for _, m := range mf.Metric {
+		labels := map[string]string{}
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		values[labels["user"]+"/"+labels["department"]+"/"+labels["cost_center"]] = m.Gauge.GetValue()
+	}
+	return values
+}
+
+type enrichmentServer struct {
+	*countingServer
+	fail int32
+
+	mu       sync.Mutex
+	requests [][]string
+}
+
+func newEnrichmentServer(t *testing.T, infos map[string]UserInfo) *enrichmentServer {
+	t.Helper()
+	s := &enrichmentServer{}
+	s.countingServer = newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var users []string
+		err := json.NewDecoder(r.Body).Decode(&users)
+		if r.Method != http.MethodPost || err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, users)
+		s.mu.Unlock()
+		if atomic.LoadInt32(&s.fail) != 0 {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		answer := map[string]UserInfo{}
+		for _, u := range users {
+			if info, ok := infos[u]; ok {
+				answer[u] = info
+			}
+		}
+		json.NewEncoder(w).Encode(answer)
+	})
+	return s
+}
+
+func (s *enrichmentServer) lastRequest() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return nil
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+func TestEnrichment(t *testing.T) {
+	logs := captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, userLeasesJSON("alice", "bob", "alice", "carol"))
+	})
+	enrichment := newEnrichmentServer(t, map[string]UserInfo{
+		"alice": {Department: "engineering", CostCenter: "cc-100"},
+		"bob":   {Department: "sales", CostCenter: "cc-200"},
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{EnrichmentURL: enrichment.URL, EnrichmentCacheTTL: time.Minute})
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	e.enricher.now = func() time.Time { return now }
+
+	want := map[string]float64{
+		"alice/engineering/cc-100": 2,
+		"bob/sales/cc-200":         1,
+		"carol//":                  1,
+	}
+	families := gather(t, e)
+	if got := userLeases(t, families); !reflect.DeepEqual(got, want) {
+		t.Errorf("got uls_leases_by_user %v, want %v", got, want)
+	}
+	if got, want := enrichment.lastRequest(), []string{"alice", "bob", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("looked up users %v, want %v", got, want)
+	}
+
+	// Cached: the enrichment service is not asked again within the TTL.
+	gather(t, e)
+	if n := atomic.LoadInt32(&enrichment.countingServer.requests); n != 1 {
+		t.Errorf("got %d enrichment requests within the cache TTL, want 1", n)
+	}
+
+	// After the TTL, a failing enrichment service does not fail the scrape,
+	// and the expired metadata is still used.
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&enrichment.fail, 1)
+	families = gather(t, e)
+	if n := atomic.LoadInt32(&enrichment.countingServer.requests); n != 2 {
+		t.Errorf("got %d enrichment requests after the cache TTL, want 2", n)
+	}
+	if got := metricValue(t, families, "uls_up"); got != 1 {
+		t.Errorf("uls_up = %v with a failing enrichment service, want 1", got)
+	}
+	if got := userLeases(t, families); !reflect.DeepEqual(got, want) {
+		t.Errorf("got uls_leases_by_user %v with a failing enrichment service, want %v", got, want)
+	}
+	if got := metricValue(t, families, "uls_enrichment_errors_total"); got != 1 {
+		t.Errorf("uls_enrichment_errors_total = %v, want 1", got)
+	}
+	if !strings.Contains(logs.String(), "enrichment: 500 Internal Server Error") {
+		t.Errorf("log does not mention the enrichment error:\n%s", logs.String())
+	}
+}
+
+func TestEnrichmentUnreachable(t *testing.T) {
+	captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, userLeasesJSON("alice"))
+	})
+	enrichment := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	enrichment.Close()
+	e := newTestExporter(t, uls.URL, ExporterOptions{EnrichmentURL: enrichment.URL})
+
+	families := gather(t, e)
+	if got, want := userLeases(t, families), map[string]float64{"alice//": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got uls_leases_by_user %v, want %v", got, want)
+	}
+	if got := metricValue(t, families, "uls_enrichment_errors_total"); got != 1 {
+		t.Errorf("uls_enrichment_errors_total = %v, want 1", got)
+	}
+}
+
+func TestEnrichmentDisabled(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, userLeasesJSON("alice"))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	families := gather(t, e)
+	for _, name := range []string{"uls_leases_by_user", "uls_enrichment_errors_total"} {
+		if _, ok := families[name]; ok {
+			t.Errorf("%s is exported without -enrichment-url", name)
+		}
+	}
+}
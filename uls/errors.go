@@ -0,0 +1,122 @@
+package uls
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// ULSNetworkError is returned when the ULS API could not be reached or the
+// connection failed while reading the response.
+type ULSNetworkError struct {
+	Err error
+}
+
+func (e *ULSNetworkError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ULSNetworkError) Unwrap() error {
+	return e.Err
+}
+
+// ULSHTTPError is returned when the ULS API answers with a status code other
+// than success. Body holds the start of the response body.
+type ULSHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ULSHTTPError) Error() string {
+	msg := fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// ULSParseError is returned when the lease response is not valid JSON or
+// does not match the lease schema. Offset is the byte offset in the response
+// where decoding failed, if known.
+type ULSParseError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *ULSParseError) Error() string {
+	return fmt.Sprintf("parsing leases at offset %d: %s", e.Offset, e.Err)
+}
+
+func (e *ULSParseError) Unwrap() error {
+	return e.Err
+}
+
+func newParseError(err error) *ULSParseError {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		return &ULSParseError{Offset: syntax.Offset, Err: err}
+	case errors.As(err, &typ):
+		return &ULSParseError{Offset: typ.Offset, Err: err}
+	}
+	return &ULSParseError{Err: err}
+}
+
+// maxErrorBody is how much of an error response body ULSHTTPError keeps.
+const maxErrorBody = 512
+
+func newHTTPError(res *http.Response) *ULSHTTPError {
+	var r io.Reader = res.Body
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return &ULSHTTPError{StatusCode: res.StatusCode}
+		}
+		defer zr.Close()
+		r = zr
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(r, maxErrorBody))
+	return &ULSHTTPError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(b))}
+}
+
+var scrapeErrorReasons = []string{"network", "http", "parse", "other"}
+
+// scrapeErrorReason is the reason label of uls_scrape_errors_total for err.
+func scrapeErrorReason(err error) string {
+	var network *ULSNetworkError
+	var status *ULSHTTPError
+	var parse *ULSParseError
+	switch {
+	case errors.As(err, &network):
+		return "network"
+	case errors.As(err, &status):
+		return "http"
+	case errors.As(err, &parse):
+		return "parse"
+	}
+	return "other"
+}
+
+type scrapeErrorCounts map[string]*uint64
+
+func newScrapeErrorCounts() scrapeErrorCounts {
+	c := scrapeErrorCounts{}
+	for _, reason := range scrapeErrorReasons {
+		c[reason] = new(uint64)
+	}
+	return c
+}
+
+// observe counts err and returns its reason.
+func (c scrapeErrorCounts) observe(err error) string {
+	reason := scrapeErrorReason(err)
+	atomic.AddUint64(c[reason], 1)
+	return reason
+}
@@ -0,0 +1,97 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeErrorTypes(t *testing.T) {
+	closed := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	closedURL := closed.URL
+	closed.Close()
+
+	for _, tc := range []struct {
+		reason string
+		url    string
+		log    string
+		check  func(t *testing.T, err error)
+	}{
+		{
+			reason: "network",
+			url:    closedURL,
+			log:    "network error: Get ",
+			check: func(t *testing.T, err error) {
+				var network *ULSNetworkError
+				if !errors.As(err, &network) {
+					t.Errorf("%v is not a ULSNetworkError", err)
+				}
+			},
+		},
+		{
+			reason: "http",
+			url: newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "database unavailable", http.StatusInternalServerError)
+			}).URL,
+			log: "http error: HTTP 500 Internal Server Error: database unavailable",
+			check: func(t *testing.T, err error) {
+				var status *ULSHTTPError
+				if !errors.As(err, &status) || status.StatusCode != http.StatusInternalServerError || status.Body != "database unavailable" {
+					t.Errorf("got %#v, want a ULSHTTPError with status 500 and the body", err)
+				}
+			},
+		},
+		{
+			reason: "parse",
+			url: newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `[{"token": oops}]`)
+			}).URL,
+			log: "parse error: parsing leases at offset 12: ",
+			check: func(t *testing.T, err error) {
+				var parse *ULSParseError
+				if !errors.As(err, &parse) || parse.Offset != 12 {
+					t.Errorf("got %#v, want a ULSParseError at offset 12", err)
+				}
+			},
+		},
+	} {
+		t.Run(tc.reason, func(t *testing.T) {
+			e := newTestExporter(t, tc.url, ExporterOptions{DisableRetryOn503: true})
+			_, err := e.GetLeases()
+			tc.check(t, err)
+
+			logs := captureLog(t)
+			got := labeledValues(t, gather(t, e), "uls_scrape_errors_total", "reason")
+			want := map[string]float64{"network": 0, "http": 0, "parse": 0, "other": 0}
+			want[tc.reason] = 1
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got uls_scrape_errors_total %v, want %v", got, want)
+			}
+			if !strings.Contains(logs.String(), tc.log) {
+				t.Errorf("log %q does not contain %q", logs.String(), tc.log)
+			}
+		})
+	}
+}
+
+func TestHTTPErrorAfterRetries(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	e.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	_, err := e.GetLeases()
+	var status *ULSHTTPError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusTooManyRequests || status.Body != "slow down" {
+		t.Errorf("got %v, want a ULSHTTPError with status 429", err)
+	}
+	if scrapeErrorReason(err) != "http" {
+		t.Errorf("got reason %s, want http", scrapeErrorReason(err))
+	}
+}
@@ -0,0 +1,48 @@
+package uls
+
+import (
+	"net/http"
+	"sync"
+)
+
+// etagCache holds the leases from the last response that carried an ETag, so
+// a 304 Not Modified can be answered without the body.
+type etagCache struct {
+	mu     sync.Mutex
+	etag   string
+	leases []ULSLease
+	hits   uint64
+}
+
+// setHeader adds If-None-Match to req if an earlier response had an ETag.
+func (c *etagCache) setHeader(req *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.etag != "" {
+		req.Header.Set("If-None-Match", c.etag)
+	}
+}
+
+// notModified returns a copy of the cached leases for a 304 response.
+func (c *etagCache) notModified() ([]ULSLease, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.etag == "" {
+		return nil, false
+	}
+	c.hits++
+	return append([]ULSLease(nil), c.leases...), true
+}
+
+func (c *etagCache) store(etag string, leases []ULSLease) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.etag = etag
+	c.leases = append([]ULSLease(nil), leases...)
+}
+
+func (c *etagCache) Hits() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
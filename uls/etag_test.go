@@ -0,0 +1,79 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestGetLeasesNotModified(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		etag  = `"v1"`
+		body  = nLeasesJSON(2)
+		sent  []string
+		bodyN int
+	)
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		bodyN++
+		fmt.Fprint(w, body)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	for i := 0; i < 3; i++ {
+		leases, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 2 {
+			t.Fatalf("request %d: got %d leases, want 2", i, len(leases))
+		}
+	}
+	mu.Lock()
+	etag, body = `"v2"`, nLeasesJSON(5)
+	mu.Unlock()
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 5 {
+		t.Errorf("after the ETag changed: got %d leases, want 5", len(leases))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"", `"v1"`, `"v1"`, `"v1"`}
+	if fmt.Sprint(sent) != fmt.Sprint(want) {
+		t.Errorf("sent If-None-Match %q, want %q", sent, want)
+	}
+	if bodyN != 2 {
+		t.Errorf("server sent %d bodies, want 2", bodyN)
+	}
+	if got := e.etags.Hits(); got != 2 {
+		t.Errorf("got %d ETag cache hits, want 2", got)
+	}
+}
+
+func TestGetLeasesNotModifiedWithoutETag(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("got no error for a 304 without a cached response")
+	}
+	if got := metricValue(t, gather(t, e), "uls_etag_cache_hits_total"); got != 0 {
+		t.Errorf("uls_etag_cache_hits_total = %v, want 0", got)
+	}
+}
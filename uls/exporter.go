@@ -0,0 +1,1728 @@
+package uls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type TimeUTC time.Time
+
+const TimeUTCFormat = "2006-01-02T15:04:05.999999Z07:00"
+
+func (t *TimeUTC) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.Parse(TimeUTCFormat, s)
+	if err != nil {
+		return err
+	}
+	*t = TimeUTC(parsed)
+	return nil
+}
+
+func (t TimeUTC) Time() time.Time {
+	return time.Time(t)
+}
+
+const (
+	namespace = "uls"
+)
+
+var (
+	up = newDesc(
+		prometheus.GaugeValue, "up",
+		"ULS is up and running",
+	)
+	lease = newDesc(
+		prometheus.GaugeValue, "leases",
+		"Number of active ULS leases",
+	)
+	singleflightDeduped = newDesc(
+		prometheus.CounterValue, "singleflight_deduped_total",
+		"Number of lease fetches served by an in-flight or cached request",
+	)
+	negativeCacheHits = newDesc(
+		prometheus.CounterValue, "negative_cache_hits_total",
+		"Number of lease fetches answered with a cached ULS error",
+	)
+	walEvents = newDesc(
+		prometheus.CounterValue, "wal_events_total",
+		"Number of lease change events written to the WAL",
+		"event",
+	)
+	sseClients = newDesc(
+		prometheus.GaugeValue, "sse_connected_clients",
+		"Number of clients connected to the lease event stream",
+	)
+	httpConnectionsActive = newDesc(
+		prometheus.GaugeValue, "http_connections_active",
+		"Number of in-flight HTTP requests to ULS",
+	)
+	httpConnectionsTotal = newDesc(
+		prometheus.CounterValue, "http_connections_total",
+		"Number of HTTP requests made to ULS",
+	)
+	leaseThresholdExceeded = newDesc(
+		prometheus.GaugeValue, "lease_threshold_exceeded",
+		"Whether the number of leases is at or above the configured threshold",
+		"level",
+	)
+	websocketClients = newDesc(
+		prometheus.GaugeValue, "websocket_clients",
+		"Number of clients connected to the metrics WebSocket",
+	)
+	apiRateLimited = newDesc(
+		prometheus.CounterValue, "api_rate_limited_total",
+		"Number of ULS API responses with 429 Too Many Requests",
+	)
+	leasesTotal = newDesc(
+		prometheus.CounterValue, "leases_total",
+		"Lease-seconds observed, the lease count integrated over the time between scrapes",
+	)
+	correlatedRequests = newDesc(
+		prometheus.CounterValue, "requests_with_correlation_id_total",
+		"Number of ULS API requests sent with an X-Correlation-ID header",
+	)
+	autoRevocations = newDesc(
+		prometheus.CounterValue, "auto_revocations_total",
+		"Number of leases revoked in response to the ULSLeaseLimitReached alert",
+	)
+	uniqueTokens = newDesc(
+		prometheus.CounterValue, "unique_tokens_lifetime_total",
+		"Number of distinct lease tokens seen since the exporter started",
+	)
+	leasesByUser = newDesc(
+		prometheus.GaugeValue, "leases_by_user",
+		"Number of active ULS leases by user, with metadata from -enrichment-url",
+		"user", "department", "cost_center",
+	)
+	enrichmentErrors = newDesc(
+		prometheus.CounterValue, "enrichment_errors_total",
+		"Number of failed lookups of user metadata from -enrichment-url",
+	)
+	leasesRollingAvg = newDesc(
+		prometheus.GaugeValue, "leases_rolling_avg",
+		"Average number of active ULS leases over the last -rolling-avg-window successful scrapes",
+	)
+	floatingLeaseLastSeen = newDesc(
+		prometheus.GaugeValue, "floating_lease_last_seen_timestamp_seconds",
+		"Unix time of the last successful scrape in which the floating lease ID was held by an active lease",
+		"floating_lease_id",
+	)
+	newLeasesRate = newDesc(
+		prometheus.GaugeValue, "new_leases_rate",
+		"Estimated new ULS leases per minute, from the lease tokens not in the previous successful scrape",
+	)
+	groupsObserved = newDesc(
+		prometheus.GaugeValue, "entitlement_groups_observed",
+		"Number of distinct entitlement group IDs in the current leases",
+	)
+	groupsLifetime = newDesc(
+		prometheus.CounterValue, "entitlement_groups_lifetime_total",
+		"Number of distinct entitlement group IDs seen since the exporter started",
+	)
+	groupLeaseFraction = newDesc(
+		prometheus.GaugeValue, "entitlement_group_lease_fraction",
+		"Fraction of active ULS leases in the entitlement group",
+		"entitlement_group_id",
+	)
+	leasesByGroupAndDomain = newDesc(
+		prometheus.GaugeValue, "leases_by_group_and_domain",
+		"Number of ULS leases by entitlement group and environment domain",
+		"entitlement_group_id", "environment_domain",
+	)
+	groupDomainSeriesDropped = newDesc(
+		prometheus.GaugeValue, "leases_by_group_and_domain_dropped_series",
+		"Number of entitlement group and environment domain pairs left out of uls_leases_by_group_and_domain by -max-group-domain-series",
+	)
+	leasesTruncated = newDesc(
+		prometheus.GaugeValue, "leases_truncated",
+		"Whether the leases in this scrape were truncated to -max-leases",
+	)
+	sampleFraction = newDesc(
+		prometheus.GaugeValue, "sample_fraction",
+		"Fraction of leases sampled for per-lease metrics",
+	)
+	etagCacheHits = newDesc(
+		prometheus.CounterValue, "etag_cache_hits_total",
+		"Number of ULS API requests answered with 304 Not Modified",
+	)
+	responseTruncated = newDesc(
+		prometheus.CounterValue, "response_truncated_total",
+		"Number of ULS API responses rejected for exceeding the maximum response size",
+	)
+	authFailures = newDesc(
+		prometheus.CounterValue, "auth_failures_total",
+		"Number of ULS API lease requests answered with 401 Unauthorized or 403 Forbidden",
+	)
+	lastAuthFailure = newDesc(
+		prometheus.GaugeValue, "last_auth_failure_timestamp_seconds",
+		"Unix time of the last ULS API lease request answered with 401 Unauthorized or 403 Forbidden",
+	)
+	scrapeTimeout = newDesc(
+		prometheus.GaugeValue, "scrape_timeout_seconds",
+		"Scrape timeout last received from Prometheus",
+	)
+	exporterGoroutines = newDesc(
+		prometheus.GaugeValue, "exporter_goroutines",
+		"Number of running goroutines started by the exporter, such as for plugin collection and WebSocket clients",
+	)
+	logSampledDropped = newDesc(
+		prometheus.CounterValue, "log_sampled_dropped_total",
+		"Number of error log lines dropped by log sampling",
+	)
+	scrapeErrors = newDesc(
+		prometheus.CounterValue, "scrape_errors_total",
+		"Number of failed scrapes of the ULS API by reason",
+		"reason",
+	)
+)
+
+type ULSClientEntitlementContext struct {
+	EnvironmentDomain     string `json:"EnvironmentDomain"`
+	EnvironmentHostname   string `json:"EnvironmentHostname"`
+	EnvironmentUser       string `json:"EnvironmentUser"`
+	LegacyMachineBinding1 string `json:"Legacy.MachineBinding1"`
+	LegacyMachineBinding2 string `json:"Legacy.MachineBinding2"`
+	LegacyMachineBinding5 string `json:"Legacy.MachineBinding5"`
+}
+
+type ULSLease struct {
+	FloatingLeaseID          int                         `json:"floatingLeaseId"`
+	Token                    uuid.UUID                   `json:"token"`
+	CreatedTimeUTC           TimeUTC                     `json:"createdTimeUtc"`
+	LastRenewalTimeUTC       TimeUTC                     `json:"lastRenewalTimeUtc"`
+	IsRevoked                bool                        `json:"isRevoked"`
+	ClientEntitlementContext ULSClientEntitlementContext `json:"clientEntitlementContext"`
+	EntitlementGroupIDs      []string                    `json:"entitlementGroupIds"`
+}
+
+type ExporterOptions struct {
+	ScrapeTimeout time.Duration
+	CacheWindow   time.Duration
+	ErrorCacheTTL time.Duration
+	WALDir        string
+	WSIdleTimeout time.Duration
+
+	AuthTokenFile             string
+	BasicAuthUsername         string
+	BasicAuthPasswordFile     string
+	CredentialRefreshInterval time.Duration
+	// AuthToken and BasicAuthPassword are used instead of AuthTokenFile and
+	// BasicAuthPasswordFile when set.
+	AuthToken         string
+	BasicAuthPassword string
+
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCTokenURL     string
+
+	SAMLIdPURL string
+	SAMLSPCert string
+	SAMLSPKey  string
+
+	ProxyUsername string
+	ProxyPassword string
+
+	MinTLSVersion string
+	CipherSuites  string
+	// TLSServerName is the name the ULS certificate is verified against,
+	// the base URL's host if empty.
+	TLSServerName string
+
+	// UnixSocket is the socket every connection goes to. A unix:// base URL
+	// sets it to the URL's path.
+	UnixSocket        string
+	KeepAliveInterval time.Duration
+	// IdleConnTimeout defaults to 90s when zero.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout limits connecting to ULS, within ScrapeTimeout, and
+	// defaults to 5s when zero.
+	DialTimeout time.Duration
+
+	// ResponseHeaderTimeout and TLSHandshakeTimeout keep the transport's
+	// defaults, no limit and 10s, when zero.
+	ResponseHeaderTimeout time.Duration
+	TLSHandshakeTimeout   time.Duration
+
+	// MaxRedirects defaults to 5 when zero.
+	MaxRedirects     int
+	DisableRedirects bool
+
+	// UserAgent defaults to uls_exporter/<version> when empty.
+	UserAgent string
+
+	DisableRetryOn503 bool
+
+	LeaseWarningThreshold  int
+	LeaseCriticalThreshold int
+
+	MaxTokenHistory int
+
+	HashEntitlementGroupIDs     bool
+	EntitlementGroupMappingFile string
+
+	LeaseCountAsCounter bool
+
+	// SampleFraction defaults to 1 when zero.
+	SampleFraction float64
+
+	// RollingAvgWindow is the number of scrapes uls_leases_rolling_avg
+	// averages, and defaults to 5 when zero.
+	RollingAvgWindow int
+
+	// MaxGroupDomainSeries caps the series of uls_leases_by_group_and_domain,
+	// keeping the pairs with the most leases. It defaults to 1000 when zero.
+	MaxGroupDomainSeries int
+
+	// MaxLeases truncates the leases of each scrape to that many when
+	// positive. Metrics are then computed from a subset of the leases.
+	MaxLeases int
+
+	// MaxResponseSize is in bytes and defaults to 10 MiB when zero.
+	MaxResponseSize int64
+
+	// StreamResponse decodes leases while reading the response, which may
+	// be a JSON stream or multipart, instead of reading it all first.
+	StreamResponse bool
+
+	// ResponseNDJSON parses the response as newline-delimited JSON, one
+	// lease per line. It cannot be combined with StreamResponse.
+	ResponseNDJSON bool
+
+	// SkipContentTypeCheck parses responses whatever their Content-Type,
+	// which otherwise must be application/json.
+	SkipContentTypeCheck bool
+
+	// FieldMapping maps JSON field names in lease responses to the names of
+	// the ULSLease fields they hold, such as "floating_lease_id":
+	// "FloatingLeaseID".
+	FieldMapping map[string]string
+
+	// PathRewriteFrom is a regular expression replaced with PathRewriteTo
+	// in the paths of ULS API requests. Paths are not rewritten when empty.
+	PathRewriteFrom string
+	PathRewriteTo   string
+
+	// HistogramBuckets is a comma-separated list of bucket upper bounds for
+	// uls_scrape_duration_seconds and uls_api_latency_seconds. The
+	// Prometheus defaults are used when empty.
+	HistogramBuckets string
+	NativeHistograms bool
+
+	// SuccessStatusCodes is a comma-separated list of the status codes of
+	// successful lease responses. It defaults to 200 when empty.
+	SuccessStatusCodes string
+
+	LabelRenames []LabelRename
+
+	// LogSampleRate is the fraction of error logs kept, and defaults to 1
+	// when zero. Below 1, at most LogSampleBurst errors, default 100, are
+	// logged per LogSampleInterval, default 1m.
+	LogSampleRate     float64
+	LogSampleBurst    int
+	LogSampleInterval time.Duration
+
+	// LogHTTPRequests is info, the default when empty, to log failed ULS
+	// API requests, debug to log every request, or trace to also log the
+	// first kilobyte of their bodies.
+	LogHTTPRequests string
+
+	// EnrichmentURL is a service that looks up the department and cost
+	// center of users for uls_leases_by_user, which is only exported when
+	// it is set. Its answers are cached for EnrichmentCacheTTL, default 5m.
+	EnrichmentURL      string
+	EnrichmentCacheTTL time.Duration
+
+	// Targets are more ULS base URIs scraped together with the exporter's
+	// own, every metric then carrying a target label. Their leases are
+	// fetched in parallel, at most MaxConcurrentFetches at a time, default
+	// 10.
+	Targets              []string
+	MaxConcurrentFetches int
+
+	// RateLimitJournal, when set, is a file keeping the times of the last
+	// requests to ULS, which are limited to RateLimitRequests, default 10,
+	// per RateLimitWindow, default 1m, across restarts.
+	RateLimitJournal  string
+	RateLimitRequests int
+	RateLimitWindow   time.Duration
+}
+
+type ULSExporter struct {
+	BaseURL *url.URL
+	// target is the base URL as given, such as a unix:// URL.
+	target string
+	// socketPath is the Unix socket connections go to, if any.
+	socketPath string
+	client     *http.Client
+	cache      *leaseCache
+	etags      etagCache
+	wal        *leaseWAL
+	journal    *requestJournal
+	events     *broadcaster
+	ws         *wsHub
+	now        func() time.Time
+	sleep      func(context.Context, time.Duration) error
+
+	jitterSource *jitterSource
+
+	thresholds map[string]int
+	plugins    []Plugin
+	tokens     *tokenHistory
+	groups     *groupLabeler
+
+	retryOn503 bool
+	userAgent  string
+
+	leaseCountAsCounter  bool
+	leaseSeconds         leaseSeconds
+	newLeases            newLeaseRate
+	rollingAvg           *rollingAverage
+	groupHistory         *groupHistory
+	lastSeen             *leaseLastSeen
+	maxGroupDomain       int
+	sampleFraction       float64
+	maxLeases            int
+	streamResponse       bool
+	responseNDJSON       bool
+	skipContentTypeCheck bool
+	fields               fieldMap
+	paths                *pathRewrite
+	last                 lastScrape
+
+	leaseAgeByGroup *prometheus.SummaryVec
+	collectAllocs   prometheus.Histogram
+	scrapeDuration  prometheus.Histogram
+	leaseAge        prometheus.Histogram
+	responseBytes   prometheus.Histogram
+	apiLatency      prometheus.Histogram
+
+	scrapeTimeout      time.Duration
+	lastScrapeTimeoutN int64
+
+	requestsActive int64
+	requestsTotal  uint64
+	rateLimited    uint64
+	correlated     uint64
+	truncated      uint64
+
+	authFailures    uint64
+	lastAuthFailure int64
+
+	maxResponseSize int64
+
+	autoRevocations uint64
+	scrapeErrors    scrapeErrorCounts
+	successCodes    map[int]bool
+	labels          *labelRenamer
+	goroutines      goroutineGroup
+	errorLog        *logSampler
+
+	enricher             *enricher
+	targets              []*ULSExporter
+	maxConcurrentFetches int
+
+	mu           sync.Mutex
+	previous     []ULSLease
+	havePrevious bool
+}
+
+func NewULSExporter(baseURL string, opts ExporterOptions) (*ULSExporter, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "unix" {
+		if opts.UnixSocket != "" {
+			return nil, fmt.Errorf("%s: a unix:// URL cannot be used with a Unix socket option", baseURL)
+		}
+		// Requests are plain HTTP over the socket.
+		opts.UnixSocket = u.Path
+		u = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	labels, err := newLabelRenamer(opts.LabelRenames, "entitlement_group_id")
+	if err != nil {
+		return nil, err
+	}
+	e := &ULSExporter{
+		BaseURL:       u,
+		target:        baseURL,
+		socketPath:    opts.UnixSocket,
+		labels:        labels,
+		client:        &http.Client{Timeout: opts.ScrapeTimeout},
+		scrapeTimeout: opts.ScrapeTimeout,
+		events:        newBroadcaster(),
+		ws:            newWSHub(opts.WSIdleTimeout),
+		now:           time.Now,
+		scrapeErrors:  newScrapeErrorCounts(),
+		sleep:         sleepContext,
+		jitterSource:  newJitterSource(),
+		tokens:        newTokenHistory(opts.MaxTokenHistory),
+		groups:        newGroupLabeler(opts.HashEntitlementGroupIDs, opts.EntitlementGroupMappingFile),
+		groupHistory:  newGroupHistory(),
+		lastSeen:      newLeaseLastSeen(),
+
+		retryOn503:           !opts.DisableRetryOn503,
+		userAgent:            opts.UserAgent,
+		leaseCountAsCounter:  opts.LeaseCountAsCounter,
+		sampleFraction:       opts.SampleFraction,
+		maxLeases:            opts.MaxLeases,
+		streamResponse:       opts.StreamResponse,
+		responseNDJSON:       opts.ResponseNDJSON,
+		skipContentTypeCheck: opts.SkipContentTypeCheck,
+		leaseAgeByGroup: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:  namespace,
+			Name:       "lease_age_seconds_by_group",
+			Help:       "Age of active ULS leases by entitlement group",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		}, []string{labels.Label("entitlement_group_id")}),
+		collectAllocs: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "collect_allocs_bytes",
+			Help:      "Bytes allocated while collecting metrics",
+			Buckets:   []float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20},
+		}),
+	}
+	e.ws.goroutines = &e.goroutines
+	logSampleRate, logSampleBurst, logSampleInterval := opts.LogSampleRate, opts.LogSampleBurst, opts.LogSampleInterval
+	if logSampleRate == 0 {
+		logSampleRate = 1
+	}
+	if logSampleBurst == 0 {
+		logSampleBurst = defaultLogSampleBurst
+	}
+	if logSampleInterval == 0 {
+		logSampleInterval = defaultLogSampleInterval
+	}
+	if logSampleRate < 0 || logSampleRate > 1 {
+		return nil, fmt.Errorf("log sample rate %v must be between 0 and 1", opts.LogSampleRate)
+	}
+	if logSampleBurst < 0 || logSampleInterval < 0 {
+		return nil, fmt.Errorf("log sample burst %d and interval %s must not be negative", opts.LogSampleBurst, opts.LogSampleInterval)
+	}
+	e.errorLog = newLogSampler(logSampleRate, logSampleBurst, logSampleInterval)
+	if opts.SampleFraction == 0 {
+		e.sampleFraction = 1
+	}
+	e.successCodes = map[int]bool{http.StatusOK: true}
+	if opts.SuccessStatusCodes != "" {
+		e.successCodes, err = parseStatusCodes(opts.SuccessStatusCodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buckets := prometheus.DefBuckets
+	if opts.HistogramBuckets != "" {
+		buckets, err = parseBuckets(opts.HistogramBuckets)
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.scrapeDuration = prometheus.NewHistogram(histogramOpts("scrape_duration_seconds", "Duration of scrapes of the ULS API", buckets, opts.NativeHistograms))
+	e.leaseAge = prometheus.NewHistogram(histogramOpts("lease_age_seconds", "Age of active ULS leases", leaseAgeBuckets, opts.NativeHistograms))
+	e.apiLatency = prometheus.NewHistogram(histogramOpts("api_latency_seconds", "Round-trip time of ULS API requests, up to the response headers", buckets, opts.NativeHistograms))
+	e.responseBytes = prometheus.NewHistogram(histogramOpts("api_response_bytes", "Size in bytes of ULS API response bodies", responseBytesBuckets, opts.NativeHistograms))
+	if e.userAgent == "" {
+		e.userAgent = defaultUserAgent()
+	}
+	e.maxResponseSize = opts.MaxResponseSize
+	if e.maxResponseSize == 0 {
+		e.maxResponseSize = defaultMaxResponseSize
+	}
+	if e.maxResponseSize < 0 {
+		return nil, fmt.Errorf("maximum response size %d must not be negative", opts.MaxResponseSize)
+	}
+	if e.sampleFraction <= 0 || e.sampleFraction > 1 {
+		return nil, fmt.Errorf("sample fraction %v must be above 0 and at most 1", opts.SampleFraction)
+	}
+	rollingAvgWindow := opts.RollingAvgWindow
+	if rollingAvgWindow == 0 {
+		rollingAvgWindow = defaultRollingAvgWindow
+	}
+	if rollingAvgWindow < 0 {
+		return nil, fmt.Errorf("rolling average window %d must not be negative", opts.RollingAvgWindow)
+	}
+	e.rollingAvg = newRollingAverage(rollingAvgWindow)
+	e.maxGroupDomain = opts.MaxGroupDomainSeries
+	if e.maxGroupDomain == 0 {
+		e.maxGroupDomain = defaultMaxGroupDomainSeries
+	}
+	if e.maxGroupDomain < 0 {
+		return nil, fmt.Errorf("maximum group and domain series %d must not be negative", opts.MaxGroupDomainSeries)
+	}
+	e.fields, err = newFieldMap(opts.FieldMapping)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ResponseNDJSON && opts.StreamResponse {
+		return nil, fmt.Errorf("NDJSON responses cannot be combined with streamed responses")
+	}
+	if opts.MaxLeases < 0 {
+		return nil, fmt.Errorf("max leases %d must not be negative", opts.MaxLeases)
+	}
+	e.thresholds = map[string]int{}
+	if opts.LeaseWarningThreshold > 0 {
+		e.thresholds["warning"] = opts.LeaseWarningThreshold
+	}
+	if opts.LeaseCriticalThreshold > 0 {
+		e.thresholds["critical"] = opts.LeaseCriticalThreshold
+	}
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	if maxRedirects < 0 {
+		return nil, fmt.Errorf("maximum redirects %d must not be negative", opts.MaxRedirects)
+	}
+	e.client.CheckRedirect = checkRedirect(maxRedirects, opts.DisableRedirects)
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	logged, err := newHTTPLogTransport(transport, opts.LogHTTPRequests)
+	if err != nil {
+		return nil, err
+	}
+	e.paths, err = newPathRewrite(opts.PathRewriteFrom, opts.PathRewriteTo)
+	if err != nil {
+		return nil, err
+	}
+	e.client.Transport, err = newAuthTransport(logged, u, e.paths, opts)
+	if err != nil {
+		return nil, err
+	}
+	e.cache, err = newLeaseCache(opts.CacheWindow, opts.ErrorCacheTTL, opts.ScrapeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if opts.EnrichmentURL != "" {
+		ttl := opts.EnrichmentCacheTTL
+		if ttl == 0 {
+			ttl = defaultEnrichmentCacheTTL
+		}
+		if ttl < 0 {
+			return nil, fmt.Errorf("enrichment cache TTL %s must not be negative", opts.EnrichmentCacheTTL)
+		}
+		e.enricher = newEnricher(opts.EnrichmentURL, ttl)
+	}
+	e.maxConcurrentFetches = opts.MaxConcurrentFetches
+	if e.maxConcurrentFetches == 0 {
+		e.maxConcurrentFetches = defaultMaxConcurrentFetches
+	}
+	if e.maxConcurrentFetches < 0 {
+		return nil, fmt.Errorf("maximum concurrent fetches %d must not be negative", opts.MaxConcurrentFetches)
+	}
+	if len(opts.Targets) > 0 {
+		e.targets, err = newTargets(opts.Targets, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.WALDir != "" {
+		e.wal, err = newLeaseWAL(opts.WALDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.RateLimitJournal != "" {
+		requests := opts.RateLimitRequests
+		if requests == 0 {
+			requests = defaultRateLimitRequests
+		}
+		window := opts.RateLimitWindow
+		if window == 0 {
+			window = defaultRateLimitWindow
+		}
+		e.journal, err = openRequestJournal(opts.RateLimitJournal, requests, window)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit journal: %w", err)
+		}
+	}
+	return e, nil
+}
+
+func (e *ULSExporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.labels.Desc(up)
+	if e.leaseCountAsCounter {
+		ch <- e.labels.Desc(leasesTotal)
+	} else {
+		ch <- e.labels.Desc(lease)
+	}
+	ch <- e.labels.Desc(singleflightDeduped)
+	ch <- e.labels.Desc(negativeCacheHits)
+	ch <- e.labels.Desc(sseClients)
+	ch <- e.labels.Desc(websocketClients)
+	ch <- e.labels.Desc(httpConnectionsActive)
+	ch <- e.labels.Desc(httpConnectionsTotal)
+	ch <- e.labels.Desc(scrapeTimeout)
+	ch <- e.labels.Desc(scrapeErrors)
+	ch <- e.labels.Desc(exporterGoroutines)
+	ch <- e.labels.Desc(logSampledDropped)
+	ch <- e.labels.Desc(apiRateLimited)
+	ch <- e.labels.Desc(responseTruncated)
+	ch <- e.labels.Desc(authFailures)
+	ch <- e.labels.Desc(lastAuthFailure)
+	ch <- e.labels.Desc(etagCacheHits)
+	ch <- e.labels.Desc(uniqueTokens)
+	ch <- e.labels.Desc(correlatedRequests)
+	ch <- e.labels.Desc(autoRevocations)
+	ch <- e.labels.Desc(sampleFraction)
+	ch <- e.labels.Desc(leasesTruncated)
+	ch <- e.labels.Desc(leasesRollingAvg)
+	ch <- e.labels.Desc(floatingLeaseLastSeen)
+	ch <- e.labels.Desc(newLeasesRate)
+	ch <- e.labels.Desc(groupsObserved)
+	ch <- e.labels.Desc(groupsLifetime)
+	ch <- e.labels.Desc(groupLeaseFraction)
+	ch <- e.labels.Desc(leasesByGroupAndDomain)
+	ch <- e.labels.Desc(groupDomainSeriesDropped)
+	ch <- e.labels.Desc(leasesByUser)
+	ch <- e.labels.Desc(enrichmentErrors)
+	if len(e.thresholds) > 0 {
+		ch <- e.labels.Desc(leaseThresholdExceeded)
+	}
+	e.leaseAgeByGroup.Describe(ch)
+	e.collectAllocs.Describe(ch)
+	e.scrapeDuration.Describe(ch)
+	e.leaseAge.Describe(ch)
+	e.responseBytes.Describe(ch)
+	e.apiLatency.Describe(ch)
+	for _, p := range e.plugins {
+		p.Describe(ch)
+	}
+	if e.wal != nil {
+		ch <- e.labels.Desc(walEvents)
+	}
+}
+
+func (e *ULSExporter) Collect(ch chan<- prometheus.Metric) {
+	e.collect(context.Background(), ch)
+}
+
+func (e *ULSExporter) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := e.now()
+	e.collectMetrics(ctx, ch)
+	e.scrapeDuration.Observe(e.now().Sub(start).Seconds())
+	e.scrapeDuration.Collect(ch)
+	e.responseBytes.Collect(ch)
+	e.apiLatency.Collect(ch)
+	runtime.ReadMemStats(&after)
+	e.collectAllocs.Observe(float64(after.TotalAlloc - before.TotalAlloc))
+	e.collectAllocs.Collect(ch)
+}
+
+func (e *ULSExporter) collectMetrics(ctx context.Context, ch chan<- prometheus.Metric) {
+	leases, err := e.cache.Get(ctx, e.BaseURL.String(), e.fetchLeases)
+	truncated := 0.0
+	if e.maxLeases > 0 && len(leases) > e.maxLeases {
+		leases = leases[:e.maxLeases]
+		truncated = 1
+	}
+	e.last.Set(leases, err)
+	if timeout := e.lastScrapeTimeout(); timeout > 0 {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(scrapeTimeout), prometheus.GaugeValue, timeout.Seconds())
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(httpConnectionsActive), prometheus.GaugeValue, float64(atomic.LoadInt64(&e.requestsActive)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(httpConnectionsTotal), prometheus.CounterValue, float64(atomic.LoadUint64(&e.requestsTotal)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(apiRateLimited), prometheus.CounterValue, float64(atomic.LoadUint64(&e.rateLimited)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(responseTruncated), prometheus.CounterValue, float64(atomic.LoadUint64(&e.truncated)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(authFailures), prometheus.CounterValue, float64(atomic.LoadUint64(&e.authFailures)))
+	if last := atomic.LoadInt64(&e.lastAuthFailure); last != 0 {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(lastAuthFailure), prometheus.GaugeValue, float64(last)/1e9)
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(etagCacheHits), prometheus.CounterValue, float64(e.etags.Hits()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(autoRevocations), prometheus.CounterValue, float64(atomic.LoadUint64(&e.autoRevocations)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(correlatedRequests), prometheus.CounterValue, float64(atomic.LoadUint64(&e.correlated)))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(uniqueTokens), prometheus.CounterValue, float64(e.tokens.Unique()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(singleflightDeduped), prometheus.CounterValue, float64(e.cache.Deduped()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(negativeCacheHits), prometheus.CounterValue, float64(e.cache.NegativeHits()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(sseClients), prometheus.GaugeValue, float64(e.events.Clients()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(websocketClients), prometheus.GaugeValue, float64(e.ws.Clients()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(exporterGoroutines), prometheus.GaugeValue, float64(e.goroutines.Running()))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(logSampledDropped), prometheus.CounterValue, float64(e.errorLog.Dropped()))
+	if e.wal != nil {
+		for event, n := range e.wal.Events() {
+			ch <- prometheus.MustNewConstMetric(e.labels.Desc(walEvents), prometheus.CounterValue, float64(n), event)
+		}
+	}
+	if err != nil {
+		reason := e.scrapeErrors.observe(err)
+		e.errorLog.Printf("%s error: %s", reason, err)
+	}
+	for _, reason := range scrapeErrorReasons {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(scrapeErrors), prometheus.CounterValue, float64(atomic.LoadUint64(e.scrapeErrors[reason])), reason)
+	}
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(up), prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(up), prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(leasesTruncated), prometheus.GaugeValue, truncated)
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(leasesRollingAvg), prometheus.GaugeValue, e.rollingAvg.Observe(float64(len(leases))))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(newLeasesRate), prometheus.GaugeValue, e.newLeases.Observe(e.now(), leases))
+	for id, t := range e.lastSeen.Observe(e.now(), leases) {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(floatingLeaseLastSeen), prometheus.GaugeValue, float64(t.UnixNano())/1e9, strconv.Itoa(id))
+	}
+	observed, lifetime := e.groupHistory.Observe(leases)
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(groupsObserved), prometheus.GaugeValue, float64(observed))
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(groupsLifetime), prometheus.CounterValue, float64(lifetime))
+	for group, n := range e.countByGroup(leases) {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(groupLeaseFraction), prometheus.GaugeValue, float64(n)/float64(len(leases)), group)
+	}
+	pairs, dropped := e.countByGroupAndDomain(leases)
+	for _, p := range pairs {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(leasesByGroupAndDomain), prometheus.GaugeValue, float64(p.count), p.group, p.domain)
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(groupDomainSeriesDropped), prometheus.GaugeValue, float64(dropped))
+	if e.enricher != nil {
+		e.collectUsers(ctx, leases, ch)
+	}
+	if e.leaseCountAsCounter {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(leasesTotal), prometheus.CounterValue, e.leaseSeconds.Observe(e.now(), len(leases)))
+	} else {
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(lease), prometheus.GaugeValue, float64(len(leases)))
+	}
+	for level, threshold := range e.thresholds {
+		exceeded := 0.0
+		if len(leases) >= threshold {
+			exceeded = 1
+		}
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(leaseThresholdExceeded), prometheus.GaugeValue, exceeded, level)
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(sampleFraction), prometheus.GaugeValue, e.sampleFraction)
+	e.observeLeaseAges(sampleLeases(leases, e.sampleFraction, e.now()))
+	e.leaseAgeByGroup.Collect(ch)
+	e.leaseAge.Collect(ch)
+	for _, p := range e.plugins {
+		p.Collect(leases, ch)
+	}
+}
+
+func (e *ULSExporter) observeLeaseAges(leases []ULSLease) {
+	now := e.now()
+	for _, l := range leases {
+		if l.IsRevoked {
+			continue
+		}
+		age := now.Sub(l.CreatedTimeUTC.Time()).Seconds()
+		e.leaseAge.Observe(age)
+		for _, group := range l.EntitlementGroupIDs {
+			e.leaseAgeByGroup.WithLabelValues(e.groups.Label(group)).Observe(age)
+		}
+	}
+}
+
+func (e *ULSExporter) collectUsers(ctx context.Context, leases []ULSLease, ch chan<- prometheus.Metric) {
+	counts := countByUser(leases)
+	users := make([]string, 0, len(counts))
+	for u := range counts {
+		users = append(users, u)
+	}
+	infos, err := e.enricher.Lookup(ctx, users)
+	if err != nil {
+		e.errorLog.Println(err)
+	}
+	for u, n := range counts {
+		info := infos[u]
+		ch <- prometheus.MustNewConstMetric(e.labels.Desc(leasesByUser), prometheus.GaugeValue, float64(n), u, info.Department, info.CostCenter)
+	}
+	ch <- prometheus.MustNewConstMetric(e.labels.Desc(enrichmentErrors), prometheus.CounterValue, float64(e.enricher.Errors()))
+}
+
+func (e *ULSExporter) Close() error {
+	e.cache.Close()
+	e.client.CloseIdleConnections()
+	for _, t := range e.targets {
+		t.Close()
+	}
+	if e.journal != nil {
+		e.journal.Close()
+	}
+	if e.wal != nil {
+		return e.wal.Close()
+	}
+	return nil
+}
+
+func (e *ULSExporter) fetchLeases(ctx context.Context) ([]ULSLease, error) {
+	leases, err := e.GetLeasesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.tokens.Observe(leases)
+	e.recordChanges(leases)
+	return leases, nil
+}
+
+func (e *ULSExporter) recordChanges(leases []ULSLease) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	previous, ok := e.previous, e.havePrevious
+	e.previous, e.havePrevious = leases, true
+	if !ok {
+		return
+	}
+	now := e.now().UTC()
+	events := diffLeases(now, previous, leases)
+	if len(events) == 0 {
+		return
+	}
+	if e.wal != nil {
+		err := e.wal.Record(events)
+		if err != nil {
+			e.errorLog.Println(err)
+		}
+	}
+	b, err := json.Marshal(LeaseDelta{Time: now, Events: events})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	e.events.Publish(b)
+}
+
+func (e *ULSExporter) EventsHandler() http.Handler {
+	return e.events
+}
+
+func (e *ULSExporter) WebSocketHandler() http.Handler {
+	return e.ws
+}
+
+func (e *ULSExporter) SnapshotGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return observingGatherer{Gatherer: g, observe: e.ws.Publish}
+}
+
+func (e *ULSExporter) GetLeases() ([]ULSLease, error) {
+	return e.GetLeasesContext(context.Background())
+}
+
+func (e *ULSExporter) GetLeasesContext(ctx context.Context) ([]ULSLease, error) {
+	leaseURL, err := e.paths.URL(e.BaseURL, "/v1/admin/lease")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, leaseURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	req.Header.Set(correlationIDHeader, id)
+	atomic.AddUint64(&e.correlated, 1)
+	e.etags.setHeader(req)
+	acceptGzip(req)
+	res, err := e.doRetrying(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w (correlation id %s)", err, id)
+	}
+	defer res.Body.Close()
+	ids := correlationIDs(id, res.Header.Get(correlationIDHeader))
+	if res.StatusCode == http.StatusNotModified {
+		leases, ok := e.etags.notModified()
+		if ok {
+			return leases, nil
+		}
+	}
+	if !e.successCodes[res.StatusCode] {
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+			atomic.AddUint64(&e.authFailures, 1)
+			atomic.StoreInt64(&e.lastAuthFailure, e.now().UnixNano())
+		}
+		return nil, fmt.Errorf("%w (%s)", newHTTPError(res), ids)
+	}
+	leases, err := e.readLeases(res)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, ids)
+	}
+	e.etags.store(res.Header.Get("ETag"), leases)
+	return leases, nil
+}
+
+func (e *ULSExporter) readLeases(res *http.Response) ([]ULSLease, error) {
+	err := e.checkContentType(res)
+	if err != nil {
+		return nil, err
+	}
+	if e.responseNDJSON {
+		return e.decodeLeaseLines(res)
+	}
+	if e.streamResponse {
+		return e.decodeLeases(res)
+	}
+	b, err := e.readBody(res)
+	if err != nil {
+		return nil, err
+	}
+	var leases []ULSLease
+	err = json.Unmarshal(b, e.fields.targets(&leases))
+	if err != nil {
+		return nil, newParseError(err)
+	}
+	return leases, nil
+}
+
+func (e *ULSExporter) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", e.userAgent)
+	if e.journal != nil {
+		err := e.waitJournal(req.Context())
+		if err != nil {
+			return nil, err
+		}
+	}
+	atomic.AddUint64(&e.requestsTotal, 1)
+	atomic.AddInt64(&e.requestsActive, 1)
+	defer atomic.AddInt64(&e.requestsActive, -1)
+	start := e.now()
+	res, err := e.client.Do(req)
+	if err == nil {
+		e.apiLatency.Observe(e.now().Sub(start).Seconds())
+	}
+	return res, err
+}
+
+type App struct {
+	Listen        string
+	Path          string
+	URI           string
+	InstanceLabel string
+	ScrapeTimeout time.Duration
+	CacheWindow   time.Duration
+	ErrorCacheTTL time.Duration
+	WALDir        string
+	WSIdleTimeout time.Duration
+
+	RateLimitJournal  string
+	RateLimitRequests int
+	RateLimitWindow   time.Duration
+
+	StartupJitterMax time.Duration
+	StartupTimeout   time.Duration
+
+	SelfTestPrometheusURL string
+	Version               bool
+	ListMetrics           bool
+	ListMetricsFormat     string
+	GenerateCompletion    string
+	GenerateAlerts        string
+	GenerateDashboard     bool
+
+	GenerateServiceMonitor          bool
+	GenerateServiceMonitorNamespace string
+	GenerateServiceMonitorService   string
+	GenerateServiceMonitorLabels    string
+	GenerateServiceMonitorInterval  time.Duration
+
+	RemoteWriteURL          string
+	RemoteWriteInterval     time.Duration
+	RemoteWriteUsername     string
+	RemoteWritePasswordFile string
+	RemoteRead              bool
+	RemoteReadDir           string
+	RemoteReadRetention     time.Duration
+
+	CronInterval time.Duration
+
+	AuthTokenFile             string
+	BasicAuthUsername         string
+	BasicAuthPasswordFile     string
+	CredentialRefreshInterval time.Duration
+	UseKeyring                bool
+
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCTokenURL     string
+
+	SAMLIdPURL string
+	SAMLSPCert string
+	SAMLSPKey  string
+
+	ProxyUsername string
+	ProxyPassword string
+
+	MinTLSVersion string
+	CipherSuites  string
+	TLSServerName string
+	ULSUnixSocket string
+
+	HTTPKeepAliveInterval     time.Duration
+	HTTPIdleTimeout           time.Duration
+	DialTimeout               time.Duration
+	HTTPResponseHeaderTimeout time.Duration
+	HTTPTLSHandshakeTimeout   time.Duration
+	HTTPMaxRedirects          int
+	HTTPDisableRedirects      bool
+	UserAgent                 string
+	RetryOn503                bool
+
+	AdminTokenFile string
+
+	MetricsAuthUsername string
+	MetricsAuthPassword string
+	MetricsAPIKey       string
+	MetricsAPIKeyQuery  bool
+
+	LeaseWarningThreshold  int
+	LeaseCriticalThreshold int
+	MaxTokenHistory        int
+
+	HashEntitlementGroupIDs     bool
+	EntitlementGroupMappingFile string
+	LeaseCountAsCounter         bool
+	SampleFraction              float64
+	MaxLeases                   int
+	MaxGroupDomainSeries        int
+	RollingAvgWindow            int
+	MaxResponseSize             int64
+	StreamResponse              bool
+	ResponseNDJSON              bool
+	SkipContentTypeCheck        bool
+	FieldMap                    string
+	PathRewriteFrom             string
+	PathRewriteTo               string
+	HistogramBuckets            string
+	NativeHistograms            bool
+	SuccessStatusCodes          string
+	LogSampleRate               float64
+	LogSampleBurst              int
+	LogSampleInterval           time.Duration
+	LogHTTPRequests             string
+	EnrichmentURL               string
+	EnrichmentCacheTTL          time.Duration
+	Targets                     string
+	MaxConcurrentFetches        int
+
+	ConfigFile       string
+	SkipHealthScrape bool
+
+	CollectProcessMetrics bool
+	CollectGoMetrics      bool
+
+	PluginDir     string
+	PluginSandbox bool
+	PluginTimeout time.Duration
+
+	ServerTLSCert     string
+	ServerTLSKey      string
+	ServerTLSClientCA string
+	TLSReloadInterval time.Duration
+
+	// Args are the arguments Start configures the App from when Main has
+	// not, without the program name.
+	Args []string
+
+	certs      *certReloader
+	config     *Config
+	httpServer *http.Server
+	listener   net.Listener
+	stop       func()
+	served     chan struct{}
+	// envs are the environment variables of the string flags by name.
+	envs map[string]string
+	// gather scrapes the ULS API and gathers every metric, as the metrics
+	// path serves them.
+	gather func(ctx context.Context) ([]*dto.MetricFamily, error)
+	// prompt asks for a credential to store in the keyring.
+	prompt   func(what string) (string, error)
+	serveErr error
+}
+
+func (app *App) flags(fs *flag.FlagSet) {
+	fs.StringVar(&app.Listen, "listen", app.envDefault("listen", "ULS_LISTEN", ":9101"), "address to listen")
+	fs.StringVar(&app.Path, "path", app.envDefault("path", "ULS_PATH", "/metrics"), "path to export metrics")
+	fs.StringVar(&app.URI, "uri", app.envDefault("uri", "ULS_URI", "http://localhost:8080"), "server base URI")
+	fs.StringVar(&app.EnrichmentURL, "enrichment-url", app.envDefault("enrichment-url", "ULS_ENRICHMENT_URL", ""), "URL of a service looking up the department and cost center of users for uls_leases_by_user (unset disables uls_leases_by_user)")
+	fs.DurationVar(&app.EnrichmentCacheTTL, "enrichment-cache-ttl", defaultEnrichmentCacheTTL, "how long to cache user metadata from -enrichment-url")
+	fs.StringVar(&app.Targets, "targets", app.envDefault("targets", "ULS_TARGETS", ""), "comma-separated list of more ULS base URIs to scrape together with -uri, labelling metrics with target")
+	fs.IntVar(&app.MaxConcurrentFetches, "max-concurrent-fetches", defaultMaxConcurrentFetches, "maximum number of -targets fetched at the same time")
+	fs.StringVar(&app.InstanceLabel, "instance-label", app.envDefault("instance-label", "ULS_INSTANCE_LABEL", ""), "value of the instance label added to all metrics (default the hostname)")
+	fs.DurationVar(&app.ScrapeTimeout, "scrape-timeout", 10*time.Second, "timeout for requests to the ULS API")
+	fs.DurationVar(&app.CacheWindow, "cache-window", time.Second, "window in which scrapes share a lease response")
+	fs.DurationVar(&app.ErrorCacheTTL, "error-cache-ttl", 5*time.Second, "duration to reuse a failed lease response")
+	fs.StringVar(&app.WALDir, "wal-dir", app.envDefault("wal-dir", "ULS_WAL_DIR", ""), "directory to write lease change events to")
+	fs.StringVar(&app.RateLimitJournal, "rate-limit-journal", app.envDefault("rate-limit-journal", "ULS_RATE_LIMIT_JOURNAL", ""), "file recording the times of requests to the ULS API, to limit them across restarts")
+	fs.IntVar(&app.RateLimitRequests, "rate-limit-requests", defaultRateLimitRequests, "maximum number of requests to the ULS API per -rate-limit-window with -rate-limit-journal")
+	fs.DurationVar(&app.RateLimitWindow, "rate-limit-window", defaultRateLimitWindow, "window for -rate-limit-requests")
+	fs.DurationVar(&app.WSIdleTimeout, "ws-idle-timeout", time.Minute, "duration after which unresponsive WebSocket clients are disconnected")
+	fs.DurationVar(&app.StartupJitterMax, "startup-jitter-max", 0, "maximum random delay before serving, to spread out exporters that start together")
+	fs.DurationVar(&app.StartupTimeout, "startup-timeout", 30*time.Second, "time limit for starting up before serving (0 disables)")
+	fs.BoolVar(&app.Version, "version", false, "print version information and exit")
+	fs.BoolVar(&app.ListMetrics, "list-metrics", false, "print the exported metrics and exit")
+	fs.StringVar(&app.ListMetricsFormat, "list-metrics-format", "text", "format for -list-metrics: text or json")
+	fs.StringVar(&app.GenerateCompletion, "generate-completion", "", "print a completion script for this shell, bash, zsh or fish, and exit")
+	fs.StringVar(&app.GenerateAlerts, "generate-alerts", "", "write the Prometheus alerting rules to this file, or - for stdout, and exit")
+	fs.BoolVar(&app.GenerateDashboard, "generate-dashboard", false, "print the Grafana dashboard and exit")
+	fs.BoolVar(&app.GenerateServiceMonitor, "generate-service-monitor", false, "print a Prometheus Operator ServiceMonitor for the exporter's Kubernetes Service and exit")
+	fs.StringVar(&app.GenerateServiceMonitorNamespace, "generate-service-monitor-namespace", "default", "namespace of the Service for -generate-service-monitor")
+	fs.StringVar(&app.GenerateServiceMonitorService, "generate-service-monitor-service", "uls-exporter", "name of the Service for -generate-service-monitor, which must also be its app.kubernetes.io/name label")
+	fs.StringVar(&app.GenerateServiceMonitorLabels, "generate-service-monitor-labels", "", "comma-separated name=value labels of the ServiceMonitor for -generate-service-monitor")
+	fs.DurationVar(&app.GenerateServiceMonitorInterval, "generate-service-monitor-interval", time.Minute, "scrape interval for -generate-service-monitor")
+	fs.StringVar(&app.SelfTestPrometheusURL, "self-test-prometheus-url", app.envDefault("self-test-prometheus-url", "ULS_SELF_TEST_PROMETHEUS_URL", ""), "push a synthetic sample to this Prometheus remote write URL, report the result and exit")
+	fs.StringVar(&app.RemoteWriteURL, "remote-write-url", app.envDefault("remote-write-url", "ULS_REMOTE_WRITE_URL", ""), "Prometheus remote write URL to push metrics to")
+	fs.DurationVar(&app.RemoteWriteInterval, "remote-write-interval", time.Minute, "interval to push metrics to -remote-write-url")
+	fs.StringVar(&app.RemoteWriteUsername, "remote-write-username", app.envDefault("remote-write-username", "ULS_REMOTE_WRITE_USERNAME", ""), "username for basic auth to the remote write URL")
+	fs.StringVar(&app.RemoteWritePasswordFile, "remote-write-password-file", app.envDefault("remote-write-password-file", "ULS_REMOTE_WRITE_PASSWORD_FILE", ""), "file containing the basic auth password for the remote write URL")
+	fs.DurationVar(&app.CronInterval, "cron-interval", 0, "instead of serving HTTP, print the metrics as JSON to stdout at this interval")
+	fs.BoolVar(&app.RemoteRead, "remote-read", false, "keep scraped samples and serve them with the Prometheus remote read API at /api/v1/read")
+	fs.StringVar(&app.RemoteReadDir, "remote-read-dir", app.envDefault("remote-read-dir", "ULS_REMOTE_READ_DIR", ""), "directory to persist -remote-read samples to (default a temporary directory removed at exit)")
+	fs.DurationVar(&app.RemoteReadRetention, "remote-read-retention", defaultRemoteReadRetention, "how long -remote-read keeps samples")
+	fs.StringVar(&app.AuthTokenFile, "auth-token-file", app.envDefault("auth-token-file", "ULS_AUTH_TOKEN_FILE", ""), "file containing a bearer token for the ULS API")
+	fs.StringVar(&app.BasicAuthUsername, "basic-auth-username", app.envDefault("basic-auth-username", "ULS_BASIC_AUTH_USERNAME", ""), "username for basic auth to the ULS API")
+	fs.StringVar(&app.BasicAuthPasswordFile, "basic-auth-password-file", app.envDefault("basic-auth-password-file", "ULS_BASIC_AUTH_PASSWORD_FILE", ""), "file containing the basic auth password for the ULS API")
+	fs.BoolVar(&app.UseKeyring, "use-keyring", false, "read the ULS API token, or the password of -basic-auth-username, from the OS keyring, asking for it on the terminal the first time")
+	fs.StringVar(&app.OIDCClientID, "oidc-client-id", app.envDefault("oidc-client-id", "ULS_OIDC_CLIENT_ID", ""), "OAuth2 client ID for the client credentials grant to the ULS API")
+	fs.StringVar(&app.OIDCClientSecret, "oidc-client-secret", app.envDefault("oidc-client-secret", "ULS_OIDC_CLIENT_SECRET", ""), "OAuth2 client secret for the client credentials grant to the ULS API")
+	fs.StringVar(&app.OIDCTokenURL, "oidc-token-url", app.envDefault("oidc-token-url", "ULS_OIDC_TOKEN_URL", ""), "OAuth2 token endpoint; when set, requests to the ULS API carry a client credentials access token")
+	fs.StringVar(&app.SAMLIdPURL, "saml-idp-url", app.envDefault("saml-idp-url", "ULS_SAML_IDP_URL", ""), "SAML IdP metadata URL; when set, a SAML assertion from the IdP is exchanged for a ULS session token")
+	fs.StringVar(&app.SAMLSPCert, "saml-sp-cert", app.envDefault("saml-sp-cert", "ULS_SAML_SP_CERT", ""), "SAML service provider certificate file")
+	fs.StringVar(&app.SAMLSPKey, "saml-sp-key", app.envDefault("saml-sp-key", "ULS_SAML_SP_KEY", ""), "SAML service provider RSA private key file")
+	fs.StringVar(&app.ProxyUsername, "proxy-username", app.envDefault("proxy-username", "ULS_PROXY_USERNAME", ""), "username for the HTTPS proxy to the ULS API")
+	fs.StringVar(&app.ProxyPassword, "proxy-password", app.envDefault("proxy-password", "ULS_PROXY_PASSWORD", ""), "password for the HTTPS proxy to the ULS API")
+	fs.StringVar(&app.SuccessStatusCodes, "success-status-codes", app.envDefault("success-status-codes", "ULS_SUCCESS_STATUS_CODES", "200"), "comma-separated HTTP status codes of successful ULS lease responses")
+	fs.StringVar(&app.MinTLSVersion, "min-tls-version", app.envDefault("min-tls-version", "ULS_MIN_TLS_VERSION", "1.2"), "minimum TLS version for the ULS API: 1.0, 1.1, 1.2 or 1.3")
+	fs.StringVar(&app.CipherSuites, "cipher-suites", app.envDefault("cipher-suites", "ULS_CIPHER_SUITES", ""), "comma-separated TLS cipher suite names for the ULS API (default Go's choice)")
+	fs.StringVar(&app.TLSServerName, "tls-server-name", app.envDefault("tls-server-name", "ULS_TLS_SERVER_NAME", ""), "name to verify the ULS API certificate against (default the ULS URI host)")
+	fs.StringVar(&app.ULSUnixSocket, "uls-unix-socket", app.envDefault("uls-unix-socket", "ULS_UNIX_SOCKET", ""), "Unix socket to connect to the ULS API through; -uri still sets the Host header and paths")
+	fs.DurationVar(&app.HTTPKeepAliveInterval, "http-keepalive-interval", defaultKeepAliveInterval, "TCP keepalive interval for connections to the ULS API")
+	fs.DurationVar(&app.HTTPIdleTimeout, "http-idle-timeout", defaultIdleConnTimeout, "time after which idle connections to the ULS API are closed")
+	fs.DurationVar(&app.DialTimeout, "dial-timeout", defaultDialTimeout, "time to wait for a TCP connection to the ULS API, which counts against -scrape-timeout")
+	fs.DurationVar(&app.HTTPResponseHeaderTimeout, "http-response-header-timeout", 0, "time to wait for the ULS API's response headers after sending a request (0 is no limit besides -scrape-timeout)")
+	fs.DurationVar(&app.HTTPTLSHandshakeTimeout, "http-tls-handshake-timeout", 10*time.Second, "time to wait for the TLS handshake with the ULS API")
+	fs.IntVar(&app.HTTPMaxRedirects, "http-max-redirects", defaultMaxRedirects, "maximum number of redirects followed for a ULS API request")
+	fs.BoolVar(&app.HTTPDisableRedirects, "http-disable-redirects", false, "fail ULS API requests that are redirected")
+	fs.StringVar(&app.UserAgent, "user-agent", app.envDefault("user-agent", "ULS_USER_AGENT", defaultUserAgent()), "User-Agent header sent to the ULS API")
+	fs.BoolVar(&app.RetryOn503, "retry-on-503", true, "retry ULS API requests answered with 503 Service Unavailable")
+	fs.StringVar(&app.AdminTokenFile, "admin-token-file", app.envDefault("admin-token-file", "ULS_ADMIN_TOKEN_FILE", ""), "file containing the bearer token required by POST /alert (unset disables /alert)")
+	fs.StringVar(&app.MetricsAuthUsername, "metrics-auth-username", app.envDefault("metrics-auth-username", "ULS_METRICS_AUTH_USERNAME", ""), "username required for basic auth to the metrics path")
+	fs.StringVar(&app.MetricsAuthPassword, "metrics-auth-password", app.envDefault("metrics-auth-password", "ULS_METRICS_AUTH_PASSWORD", ""), "password required for basic auth to the metrics path")
+	fs.StringVar(&app.MetricsAPIKey, "metrics-api-key", app.envDefault("metrics-api-key", "ULS_METRICS_API_KEY", ""), "API key required in the X-Api-Key header on the metrics path")
+	fs.BoolVar(&app.MetricsAPIKeyQuery, "metrics-api-key-via-query", false, "also accept -metrics-api-key in the api_key query parameter")
+	fs.DurationVar(&app.CredentialRefreshInterval, "credential-refresh-interval", time.Minute, "interval to re-read credential files")
+	fs.IntVar(&app.LeaseWarningThreshold, "lease-warning-threshold", 0, "lease count at which uls_lease_threshold_exceeded{level=\"warning\"} is 1 (0 disables)")
+	fs.IntVar(&app.LeaseCriticalThreshold, "lease-critical-threshold", 0, "lease count at which uls_lease_threshold_exceeded{level=\"critical\"} is 1 (0 disables)")
+	fs.IntVar(&app.MaxTokenHistory, "max-token-history", 0, "maximum number of lease tokens remembered for uls_unique_tokens_lifetime_total (0 is unbounded)")
+	fs.BoolVar(&app.HashEntitlementGroupIDs, "hash-entitlement-group-ids", false, "replace entitlement group IDs in labels with their SHA-256 digest")
+	fs.StringVar(&app.EntitlementGroupMappingFile, "entitlement-group-mapping-file", app.envDefault("entitlement-group-mapping-file", "ULS_ENTITLEMENT_GROUP_MAPPING_FILE", ""), "file to write digest to entitlement group ID mappings to")
+	fs.BoolVar(&app.LeaseCountAsCounter, "lease-count-as-counter", false, "export lease-seconds as the counter uls_leases_total instead of the uls_leases gauge")
+	fs.StringVar(&app.HistogramBuckets, "histogram-buckets", app.envDefault("histogram-buckets", "ULS_HISTOGRAM_BUCKETS", ""), "comma-separated bucket upper bounds in seconds for uls_scrape_duration_seconds and uls_api_latency_seconds (default Prometheus' buckets)")
+	fs.BoolVar(&app.NativeHistograms, "native-histograms", false, "also expose uls_scrape_duration_seconds and uls_lease_age_seconds as native histograms; needs the protobuf exposition format")
+	fs.StringVar(&app.LogHTTPRequests, "log-http-requests", app.envDefault("log-http-requests", "ULS_LOG_HTTP_REQUESTS", "info"), "ULS API requests to log: info for failures, debug for all, trace for all with bodies")
+	fs.Float64Var(&app.LogSampleRate, "log-sample-rate", 1, "fraction, from 0 to 1, of error logs to keep; below 1, -log-sample-burst also applies")
+	fs.IntVar(&app.LogSampleBurst, "log-sample-burst", defaultLogSampleBurst, "maximum number of error logs per -log-sample-interval when -log-sample-rate is below 1")
+	fs.DurationVar(&app.LogSampleInterval, "log-sample-interval", defaultLogSampleInterval, "interval for -log-sample-burst")
+	fs.IntVar(&app.RollingAvgWindow, "rolling-avg-window", defaultRollingAvgWindow, "number of successful scrapes uls_leases_rolling_avg averages")
+	fs.IntVar(&app.MaxGroupDomainSeries, "max-group-domain-series", defaultMaxGroupDomainSeries, "maximum number of series of uls_leases_by_group_and_domain, keeping the pairs with the most leases")
+	fs.IntVar(&app.MaxLeases, "max-leases", 0, "maximum number of leases per scrape, truncating the rest so metrics are incomplete (0 is unlimited)")
+	fs.Float64Var(&app.SampleFraction, "sample-fraction", 1, "fraction of leases, above 0 and at most 1, sampled for per-lease metrics such as uls_lease_age_seconds_by_group")
+	fs.Int64Var(&app.MaxResponseSize, "max-response-size", defaultMaxResponseSize, "maximum size in bytes of a ULS API response body")
+	fs.BoolVar(&app.StreamResponse, "stream-response", false, "decode leases while reading the ULS API response, which may be a JSON stream or multipart/mixed")
+	fs.BoolVar(&app.ResponseNDJSON, "response-ndjson", false, "parse the ULS API response as newline-delimited JSON, one lease per line")
+	fs.BoolVar(&app.SkipContentTypeCheck, "skip-content-type-check", false, "parse ULS API responses whatever their Content-Type, instead of requiring application/json")
+	fs.StringVar(&app.PathRewriteFrom, "path-rewrite-from", app.envDefault("path-rewrite-from", "ULS_PATH_REWRITE_FROM", ""), "regular expression to replace in the paths of ULS API requests, such as ^/v1/")
+	fs.StringVar(&app.PathRewriteTo, "path-rewrite-to", app.envDefault("path-rewrite-to", "ULS_PATH_REWRITE_TO", ""), "replacement for -path-rewrite-from matches, which may use $1 for submatches")
+	fs.StringVar(&app.FieldMap, "field-map", app.envDefault("field-map", "ULS_FIELD_MAP", ""), `JSON object mapping field names in ULS API leases to lease fields, such as {"floating_lease_id": "FloatingLeaseID"}`)
+	fs.StringVar(&app.ConfigFile, "config", app.envDefault("config", "ULS_CONFIG", ""), "YAML or TOML configuration file, by its extension")
+	fs.BoolVar(&app.SkipHealthScrape, "skip-health-scrape", false, "do not scrape the ULS /v1/health endpoint")
+	fs.BoolVar(&app.CollectProcessMetrics, "collect-process-metrics", true, "export process_* metrics about the exporter process")
+	fs.BoolVar(&app.CollectGoMetrics, "collect-go-metrics", true, "export go_* metrics about the Go runtime")
+	fs.StringVar(&app.PluginDir, "plugin-dir", app.envDefault("plugin-dir", "ULS_PLUGIN_DIR", ""), "directory to load collector plugins (*.so) from")
+	fs.BoolVar(&app.PluginSandbox, "plugin-sandbox", false, "abandon plugin collections that exceed -plugin-timeout")
+	fs.DurationVar(&app.PluginTimeout, "plugin-timeout", 5*time.Second, "time limit for a sandboxed plugin collection")
+	fs.StringVar(&app.ServerTLSCert, "server-tls-cert", app.envDefault("server-tls-cert", "ULS_SERVER_TLS_CERT", ""), "certificate file to serve metrics over TLS")
+	fs.StringVar(&app.ServerTLSKey, "server-tls-key", app.envDefault("server-tls-key", "ULS_SERVER_TLS_KEY", ""), "private key file to serve metrics over TLS")
+	fs.StringVar(&app.ServerTLSClientCA, "server-tls-client-ca", app.envDefault("server-tls-client-ca", "ULS_SERVER_TLS_CLIENT_CA", ""), "CA file that client certificates must be signed by")
+	fs.DurationVar(&app.TLSReloadInterval, "tls-reload-interval", 5*time.Minute, "interval to re-read the server TLS certificate and key")
+}
+
+// configure registers the flags on fs and sets them from, in increasing order
+// of precedence, the embedded default configuration, the -config file, the
+// environment and args.
+func (app *App) configure(fs *flag.FlagSet, args []string) (*Config, error) {
+	app.flags(fs)
+	config, err := parseConfig(defaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("default config: %w", err)
+	}
+	err = config.apply(fs, app.envSet)
+	if err != nil {
+		return nil, fmt.Errorf("default config: %w", err)
+	}
+	err = envFlags(fs, typedFlagEnvs)
+	if err != nil {
+		return nil, err
+	}
+	err = app.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if app.ConfigFile == "" {
+		return config, nil
+	}
+	config, err = loadConfig(app.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	err = config.apply(fs, func(name string) bool {
+		return set[name] || app.envSet(name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", app.ConfigFile, err)
+	}
+	return config, nil
+}
+
+// Main runs the exporter with the command-line arguments until SIGINT or
+// SIGTERM.
+func (app *App) Main() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return app.RunContext(ctx, os.Args[1:])
+}
+
+// RunContext configures the App from args, without the program name, and
+// runs it until ctx is done, then shuts the HTTP server down, waiting up to
+// shutdownTimeout for in-flight requests.
+func (app *App) RunContext(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("uls_exporter", flag.ContinueOnError)
+	config, err := app.configure(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if app.Version {
+		printVersion(os.Stdout)
+		return nil
+	}
+	if app.ListMetrics {
+		return listMetrics(os.Stdout, app.ListMetricsFormat)
+	}
+	if app.GenerateCompletion != "" {
+		return writeCompletion(os.Stdout, app.GenerateCompletion, fs)
+	}
+	if app.GenerateAlerts != "" {
+		return writeAlerts(os.Stdout, app.GenerateAlerts)
+	}
+	if app.GenerateDashboard {
+		return writeDashboard(os.Stdout)
+	}
+	if app.GenerateServiceMonitor {
+		return app.writeServiceMonitor(os.Stdout)
+	}
+	if app.SelfTestPrometheusURL != "" {
+		w, err := newRemoteWriter(app.SelfTestPrometheusURL, app.RemoteWriteUsername, app.RemoteWritePasswordFile, app.CredentialRefreshInterval, app.ScrapeTimeout)
+		if err != nil {
+			return err
+		}
+		err = selfTest(ctx, w, time.Now())
+		if err != nil {
+			fmt.Printf("self-test failed: %s\n", err)
+			return err
+		}
+		fmt.Println("self-test ok")
+		return nil
+	}
+	app.config = config
+	if app.CronInterval > 0 {
+		return app.runCron(ctx, os.Stdout)
+	}
+	err = app.StartContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Print("shutting down")
+			return nil
+		}
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		log.Print("shutting down")
+	case <-app.served:
+	}
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = app.Stop(stopCtx)
+	if app.serveErr != nil {
+		return app.serveErr
+	}
+	return err
+}
+
+func (app *App) start(config *Config) (server *http.Server, stop func(), err error) {
+	var stops []func()
+	stop = func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+	reg := prometheus.NewRegistry()
+	mux := http.NewServeMux()
+	serverMetrics := newServerMetrics(app.NativeHistograms)
+	err = reg.Register(serverMetrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	handle := func(path string, h http.Handler) {
+		mux.Handle(path, serverMetrics.Handler(path, h))
+	}
+	fieldMapping, err := parseFieldMap(app.FieldMap, config.FieldMapping)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := ExporterOptions{
+		ScrapeTimeout: app.ScrapeTimeout,
+		CacheWindow:   app.CacheWindow,
+		ErrorCacheTTL: app.ErrorCacheTTL,
+		WALDir:        app.WALDir,
+		WSIdleTimeout: app.WSIdleTimeout,
+
+		RateLimitJournal:  app.RateLimitJournal,
+		RateLimitRequests: app.RateLimitRequests,
+		RateLimitWindow:   app.RateLimitWindow,
+
+		AuthTokenFile:             app.AuthTokenFile,
+		BasicAuthUsername:         app.BasicAuthUsername,
+		BasicAuthPasswordFile:     app.BasicAuthPasswordFile,
+		CredentialRefreshInterval: app.CredentialRefreshInterval,
+
+		OIDCClientID:     app.OIDCClientID,
+		OIDCClientSecret: app.OIDCClientSecret,
+		OIDCTokenURL:     app.OIDCTokenURL,
+		SAMLIdPURL:       app.SAMLIdPURL,
+		SAMLSPCert:       app.SAMLSPCert,
+		SAMLSPKey:        app.SAMLSPKey,
+
+		ProxyUsername: app.ProxyUsername,
+		ProxyPassword: app.ProxyPassword,
+
+		MinTLSVersion: app.MinTLSVersion,
+		CipherSuites:  app.CipherSuites,
+		TLSServerName: app.TLSServerName,
+
+		UnixSocket:        app.ULSUnixSocket,
+		KeepAliveInterval: app.HTTPKeepAliveInterval,
+		IdleConnTimeout:   app.HTTPIdleTimeout,
+		DisableRetryOn503: !app.RetryOn503,
+
+		DialTimeout:           app.DialTimeout,
+		ResponseHeaderTimeout: app.HTTPResponseHeaderTimeout,
+		TLSHandshakeTimeout:   app.HTTPTLSHandshakeTimeout,
+
+		MaxRedirects:     app.HTTPMaxRedirects,
+		DisableRedirects: app.HTTPDisableRedirects,
+
+		UserAgent: app.UserAgent,
+
+		LeaseWarningThreshold:  app.LeaseWarningThreshold,
+		LeaseCriticalThreshold: app.LeaseCriticalThreshold,
+
+		MaxTokenHistory: app.MaxTokenHistory,
+
+		HashEntitlementGroupIDs:     app.HashEntitlementGroupIDs,
+		EntitlementGroupMappingFile: app.EntitlementGroupMappingFile,
+
+		LeaseCountAsCounter: app.LeaseCountAsCounter,
+
+		SampleFraction: app.SampleFraction,
+		MaxLeases:      app.MaxLeases,
+
+		RollingAvgWindow:     app.RollingAvgWindow,
+		MaxGroupDomainSeries: app.MaxGroupDomainSeries,
+
+		MaxResponseSize:      app.MaxResponseSize,
+		StreamResponse:       app.StreamResponse,
+		ResponseNDJSON:       app.ResponseNDJSON,
+		SkipContentTypeCheck: app.SkipContentTypeCheck,
+		FieldMapping:         fieldMapping,
+		PathRewriteFrom:      app.PathRewriteFrom,
+		PathRewriteTo:        app.PathRewriteTo,
+
+		HistogramBuckets: app.HistogramBuckets,
+		NativeHistograms: app.NativeHistograms,
+
+		SuccessStatusCodes: app.SuccessStatusCodes,
+
+		LabelRenames: config.LabelRenames,
+
+		LogSampleRate:     app.LogSampleRate,
+		LogSampleBurst:    app.LogSampleBurst,
+		LogSampleInterval: app.LogSampleInterval,
+
+		LogHTTPRequests: app.LogHTTPRequests,
+
+		EnrichmentURL:      app.EnrichmentURL,
+		EnrichmentCacheTTL: app.EnrichmentCacheTTL,
+
+		Targets:              parseTargets(app.Targets),
+		MaxConcurrentFetches: app.MaxConcurrentFetches,
+	}
+	if app.UseKeyring {
+		app.keyringOptions(&opts)
+	}
+	exporter, err := NewULSExporter(app.URI, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	stops = append(stops, func() { exporter.Close() })
+	if app.PluginDir != "" {
+		for _, p := range loadPlugins(app.PluginDir) {
+			if app.PluginSandbox {
+				p = sandboxedPlugin{Plugin: p, timeout: app.PluginTimeout, goroutines: &exporter.goroutines}
+			}
+			log.Printf("loaded plugin %s", p.Name())
+			exporter.RegisterPlugin(p)
+		}
+	}
+	err = runtimeCollectors(reg, app.CollectProcessMetrics, app.CollectGoMetrics)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !app.SkipHealthScrape {
+		err = reg.Register(exporter.HealthCollector())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	instance, err := app.instance()
+	if err != nil {
+		return nil, nil, err
+	}
+	label := func(g prometheus.Gatherer) prometheus.Gatherer {
+		return constLabelGatherer{Gatherer: g, name: "instance", value: instance}
+	}
+	wrap := func(g prometheus.Gatherer) prometheus.Gatherer {
+		return exporter.SnapshotGatherer(label(g))
+	}
+	// protect applies the metrics authentication to handlers serving
+	// metrics or lease data.
+	protect := func(handler http.Handler) http.Handler {
+		if app.MetricsAuthUsername != "" || app.MetricsAuthPassword != "" {
+			handler = basicAuth(handler, app.MetricsAuthUsername, app.MetricsAuthPassword)
+		}
+		if app.MetricsAPIKey != "" {
+			handler = apiKeyAuth(handler, app.MetricsAPIKey, app.MetricsAPIKeyQuery)
+		}
+		return handler
+	}
+	if len(config.RecordingRules) > 0 {
+		rec, err := newRecorder(config.RecordingRules)
+		if err != nil {
+			return nil, nil, err
+		}
+		stops = append(stops, func() { rec.Close() })
+		wrap = func(g prometheus.Gatherer) prometheus.Gatherer {
+			return rec.Gatherer(exporter.SnapshotGatherer(label(g)))
+		}
+		handle("/recorded", protect(promhttp.HandlerFor(rec, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})))
+	}
+	if app.MetricsAPIKey != "" && app.MetricsAPIKeyQuery {
+		log.Print("warning: -metrics-api-key-via-query is set; the API key may be recorded in access logs")
+	}
+	if app.RemoteRead {
+		store, err := newRemoteReadStore(app.RemoteReadDir, app.RemoteReadRetention)
+		if err != nil {
+			return nil, nil, fmt.Errorf("remote read: %w", err)
+		}
+		stops = append(stops, func() { store.Close() })
+		stored := wrap
+		wrap = func(g prometheus.Gatherer) prometheus.Gatherer {
+			return store.Gatherer(stored(g))
+		}
+		handle("/api/v1/read", protect(store))
+	}
+	handle(app.Path, protect(promhttp.InstrumentMetricHandler(reg, exporter.MetricsHandler(reg, wrap))))
+	app.gather = func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		ctx, cancel := exporter.scrapeContext(ctx, 0, false)
+		defer cancel()
+		g, err := exporter.Gatherer(ctx, reg)
+		if err != nil {
+			return nil, err
+		}
+		return wrap(g).Gather()
+	}
+	handle("/events", protect(exporter.EventsHandler()))
+	handle("/lease/count", protect(exporter.LeaseCountHandler()))
+	handle("/metrics/cardinality", protect(exporter.CardinalityHandler(reg)))
+	handle("/schema", SchemaHandler())
+	handle("/dashboard", DashboardHandler())
+	handle("/version", VersionHandler())
+	handle("/healthz", healthzHandler())
+	handle("/ws/metrics", protect(exporter.WebSocketHandler()))
+	if app.AdminTokenFile != "" {
+		adminToken, err := newFileCredential(app.AdminTokenFile, app.CredentialRefreshInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		handle("/alert", exporter.AlertHandler(adminToken))
+	}
+	if app.RemoteWriteURL != "" {
+		w, err := newRemoteWriter(app.RemoteWriteURL, app.RemoteWriteUsername, app.RemoteWritePasswordFile, app.CredentialRefreshInterval, app.ScrapeTimeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		g, err := exporter.Gatherer(ctx, reg)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.Run(ctx, label(g), app.RemoteWriteInterval)
+		}()
+		stops = append(stops, func() {
+			cancel()
+			<-done
+		})
+	}
+	server, err = app.server(mux)
+	if err != nil {
+		return nil, nil, err
+	}
+	if app.certs != nil {
+		err = reg.Register(app.certs.Collector())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return server, stop, nil
+}
+
+// typedFlagEnvs are the environment variables of the flags that are not
+// strings, which envFlags parses like the command line.
+var typedFlagEnvs = map[string]string{
+	"scrape-timeout":               "ULS_SCRAPE_TIMEOUT",
+	"cache-window":                 "ULS_CACHE_WINDOW",
+	"error-cache-ttl":              "ULS_ERROR_CACHE_TTL",
+	"ws-idle-timeout":              "ULS_WS_IDLE_TIMEOUT",
+	"rate-limit-requests":          "ULS_RATE_LIMIT_REQUESTS",
+	"rate-limit-window":            "ULS_RATE_LIMIT_WINDOW",
+	"startup-jitter-max":           "ULS_STARTUP_JITTER_MAX",
+	"startup-timeout":              "ULS_STARTUP_TIMEOUT",
+	"http-keepalive-interval":      "ULS_HTTP_KEEPALIVE_INTERVAL",
+	"http-idle-timeout":            "ULS_HTTP_IDLE_TIMEOUT",
+	"retry-on-503":                 "ULS_RETRY_ON_503",
+	"http-response-header-timeout": "ULS_HTTP_RESPONSE_HEADER_TIMEOUT",
+	"dial-timeout":                 "ULS_DIAL_TIMEOUT",
+	"http-tls-handshake-timeout":   "ULS_HTTP_TLS_HANDSHAKE_TIMEOUT",
+	"http-max-redirects":           "ULS_HTTP_MAX_REDIRECTS",
+	"http-disable-redirects":       "ULS_HTTP_DISABLE_REDIRECTS",
+	"remote-write-interval":        "ULS_REMOTE_WRITE_INTERVAL",
+	"cron-interval":                "ULS_CRON_INTERVAL",
+	"remote-read":                  "ULS_REMOTE_READ",
+	"remote-read-retention":        "ULS_REMOTE_READ_RETENTION",
+	"tls-reload-interval":          "ULS_TLS_RELOAD_INTERVAL",
+	"credential-refresh-interval":  "ULS_CREDENTIAL_REFRESH_INTERVAL",
+	"use-keyring":                  "ULS_USE_KEYRING",
+	"lease-warning-threshold":      "ULS_LEASE_WARNING_THRESHOLD",
+	"lease-critical-threshold":     "ULS_LEASE_CRITICAL_THRESHOLD",
+	"max-token-history":            "ULS_MAX_TOKEN_HISTORY",
+	"hash-entitlement-group-ids":   "ULS_HASH_ENTITLEMENT_GROUP_IDS",
+	"lease-count-as-counter":       "ULS_LEASE_COUNT_AS_COUNTER",
+	"sample-fraction":              "ULS_SAMPLE_FRACTION",
+	"max-leases":                   "ULS_MAX_LEASES",
+	"rolling-avg-window":           "ULS_ROLLING_AVG_WINDOW",
+	"max-group-domain-series":      "ULS_MAX_GROUP_DOMAIN_SERIES",
+	"stream-response":              "ULS_STREAM_RESPONSE",
+	"response-ndjson":              "ULS_RESPONSE_NDJSON",
+	"skip-content-type-check":      "ULS_SKIP_CONTENT_TYPE_CHECK",
+	"enrichment-cache-ttl":         "ULS_ENRICHMENT_CACHE_TTL",
+	"max-concurrent-fetches":       "ULS_MAX_CONCURRENT_FETCHES",
+	"native-histograms":            "ULS_NATIVE_HISTOGRAMS",
+	"log-sample-rate":              "ULS_LOG_SAMPLE_RATE",
+	"log-sample-burst":             "ULS_LOG_SAMPLE_BURST",
+	"log-sample-interval":          "ULS_LOG_SAMPLE_INTERVAL",
+	"max-response-size":            "ULS_MAX_RESPONSE_SIZE",
+	"metrics-api-key-via-query":    "ULS_METRICS_API_KEY_VIA_QUERY",
+	"skip-health-scrape":           "ULS_SKIP_HEALTH_SCRAPE",
+	"collect-process-metrics":      "ULS_COLLECT_PROCESS_METRICS",
+	"collect-go-metrics":           "ULS_COLLECT_GO_METRICS",
+	"plugin-sandbox":               "ULS_PLUGIN_SANDBOX",
+	"plugin-timeout":               "ULS_PLUGIN_TIMEOUT",
+}
+
+func envDefault(env string, def string) string {
+	s, ok := os.LookupEnv(env)
+	if ok {
+		return s
+	}
+	return def
+}
+
+// envDefault returns the environment variable env, or def if it is unset,
+// and records env as the variable of the flag name.
+func (app *App) envDefault(name, env, def string) string {
+	if app.envs == nil {
+		app.envs = map[string]string{}
+	}
+	app.envs[name] = env
+	return envDefault(env, def)
+}
+
+// envSet reports whether the environment variable of the flag name is set.
+func (app *App) envSet(name string) bool {
+	env, ok := app.envs[name]
+	if !ok {
+		env, ok = typedFlagEnvs[name]
+	}
+	if !ok {
+		return false
+	}
+	_, ok = os.LookupEnv(env)
+	return ok
+}
+
+func envFlags(fs *flag.FlagSet, envs map[string]string) error {
+	for name, env := range envs {
+		s, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		err := fs.Set(name, s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package uls
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func leaseJSON(id int, token string) string {
+	return fmt.Sprintf(`{"floatingLeaseId":%d,"token":%q,"createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{},"entitlementGroupIds":["group"]}`, id, token)
+}
+
+func leasesJSON(leases ...string) string {
+	return "[" + strings.Join(leases, ",") + "]"
+}
+
+func nLeasesJSON(n int) string {
+	leases := make([]string, n)
+	for i := range leases {
+		leases[i] = leaseJSON(i, fmt.Sprintf("00000000-0000-0000-0000-%012d", i))
+	}
+	return leasesJSON(leases...)
+}
+
+type countingServer struct {
+	*httptest.Server
+	requests int32
+}
+
+func newCountingServer(t *testing.T, h http.HandlerFunc) *countingServer {
+	t.Helper()
+	s := &countingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		h(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *countingServer) Requests() int32 {
+	return atomic.LoadInt32(&s.requests)
+}
+
+func newTestExporter(t *testing.T, baseURL string, opts ExporterOptions) *ULSExporter {
+	t.Helper()
+	e, err := NewULSExporter(baseURL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := e.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	return e
+}
+
+func gather(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	err := reg.Register(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := make(map[string]*dto.MetricFamily, len(mfs))
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return families
+}
+
+func metricValue(t *testing.T, families map[string]*dto.MetricFamily, name string) float64 {
+	t.Helper()
+	mf, ok := families[name]
+	if !ok || len(mf.Metric) != 1 {
+		t.Fatalf("metric %s not found exactly once", name)
+	}
+	m := mf.Metric[0]
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	}
+	t.Fatalf("metric %s is neither gauge nor counter", name)
+	return 0
+}
+
+func labeledValues(t *testing.T, families map[string]*dto.MetricFamily, name string, label string) map[string]float64 {
+	t.Helper()
+	values := map[string]float64{}
+	mf, ok := families[name]
+	if !ok {
+		return values
+	}
+	for _, m := range mf.Metric {
+		var key string
+		for _, l := range m.Label {
+			if l.GetName() == label {
+				key = l.GetValue()
+			}
+		}
+		switch {
+		case m.Gauge != nil:
+			values[key] = m.Gauge.GetValue()
+		case m.Counter != nil:
+			values[key] = m.Counter.GetValue()
+		case m.Summary != nil:
+			values[key] = float64(m.Summary.GetSampleCount())
+		}
+	}
+	return values
+}
+
+func TestEnvFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	d := fs.Duration("cache-window", time.Second, "")
+	envs := map[string]string{"cache-window": "ULS_CACHE_WINDOW"}
+
+	t.Setenv("ULS_CACHE_WINDOW", "5s")
+	err := envFlags(fs, envs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *d != 5*time.Second {
+		t.Errorf("got %v, want 5s", *d)
+	}
+
+	t.Setenv("ULS_CACHE_WINDOW", "5")
+	err = envFlags(fs, envs)
+	if err == nil || !strings.Contains(err.Error(), "ULS_CACHE_WINDOW") {
+		t.Errorf("got %v, want error naming ULS_CACHE_WINDOW", err)
+	}
+}
+
+func TestHTTPConnectionsActive(t *testing.T) {
+	const n = 3
+	arrived := make(chan struct{}, n)
+	release := make(chan struct{})
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Write([]byte(leasesJSON()))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := e.GetLeases()
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-arrived
+	}
+	if got := atomic.LoadInt64(&e.requestsActive); got != n {
+		t.Errorf("got %d active requests while blocked, want %d", got, n)
+	}
+	close(release)
+	wg.Wait()
+
+	families := gather(t, e)
+	if v := metricValue(t, families, "uls_http_connections_active"); v != 0 {
+		t.Errorf("got uls_http_connections_active %v after completion, want 0", v)
+	}
+	if v := metricValue(t, families, "uls_http_connections_total"); v != n+1 {
+		t.Errorf("got uls_http_connections_total %v, want %d", v, n+1)
+	}
+}
+
+func TestTimeUTCUnmarshal(t *testing.T) {
+	var l ULSLease
+	err := json.Unmarshal([]byte(`{"createdTimeUtc":"2021-06-01T12:30:45.123456Z"}`), &l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2021, 6, 1, 12, 30, 45, 123456000, time.UTC)
+	if got := l.CreatedTimeUTC.Time(); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLeaseAgeByGroup(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	lease := func(token string, age time.Duration, groups ...string) string {
+		b, _ := json.Marshal(groups)
+		return fmt.Sprintf(`{"token":%q,"createdTimeUtc":%q,"entitlementGroupIds":%s}`,
+			token, now.Add(-age).Format(TimeUTCFormat), b)
+	}
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(leasesJSON(
+			lease("6ba7b810-9dad-11d1-80b4-00c04fd430c1", 100*time.Second, "short"),
+			lease("6ba7b810-9dad-11d1-80b4-00c04fd430c2", 100*time.Second, "short"),
+			lease("6ba7b810-9dad-11d1-80b4-00c04fd430c3", 1000*time.Second, "long", "both"),
+			lease("6ba7b810-9dad-11d1-80b4-00c04fd430c4", 100*time.Second, "both"),
+		)))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	e.now = func() time.Time { return now }
+
+	families := gather(t, e)
+
+	mf, ok := families["uls_lease_age_seconds_by_group"]
+	if !ok {
+		t.Fatal("uls_lease_age_seconds_by_group not found")
+	}
+	want := map[string]struct {
+		count  uint64
+		median float64
+	}{
+		"short": {2, 100},
+		"long":  {1, 1000},
+		"both":  {2, 100},
+	}
+	if len(mf.Metric) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(mf.Metric), len(want))
+	}
+	for _, m := range mf.Metric {
+		group := m.Label[0].GetValue()
+		w := want[group]
+		if got := m.Summary.GetSampleCount(); got != w.count {
+			t.Errorf("%s: got count %d, want %d", group, got, w.count)
+		}
+		for _, q := range m.Summary.Quantile {
+			if q.GetQuantile() == 0.5 && q.GetValue() != w.median {
+				t.Errorf("%s: got median %v, want %v", group, q.GetValue(), w.median)
+			}
+		}
+	}
+}
+
+func TestLeaseThresholdExceeded(t *testing.T) {
+	for _, tc := range []struct {
+		leases   int
+		warning  float64
+		critical float64
+	}{
+		{leases: 4, warning: 0, critical: 0},
+		{leases: 5, warning: 1, critical: 0},
+		{leases: 6, warning: 1, critical: 0},
+		{leases: 9, warning: 1, critical: 0},
+		{leases: 10, warning: 1, critical: 1},
+		{leases: 11, warning: 1, critical: 1},
+	} {
+		body := nLeasesJSON(tc.leases)
+		uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+		e := newTestExporter(t, uls.URL, ExporterOptions{LeaseWarningThreshold: 5, LeaseCriticalThreshold: 10})
+
+		got := labeledValues(t, gather(t, e), "uls_lease_threshold_exceeded", "level")
+
+		if got["warning"] != tc.warning || got["critical"] != tc.critical {
+			t.Errorf("%d leases: got %v, want warning=%v critical=%v", tc.leases, got, tc.warning, tc.critical)
+		}
+	}
+}
+
+func TestLeaseThresholdDisabled(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nLeasesJSON(3)))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	if _, ok := gather(t, e)["uls_lease_threshold_exceeded"]; ok {
+		t.Error("uls_lease_threshold_exceeded emitted without thresholds")
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	captureLog(t)
+	// The ULS API toggles between accepting and rejecting the credentials.
+	statuses := []int{http.StatusOK, http.StatusUnauthorized, http.StatusOK, http.StatusForbidden, http.StatusInternalServerError}
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[atomic.AddInt32(&scrape, 1)-1]
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	for i, want := range []struct {
+		up, failures, last float64
+	}{
+		{1, 0, 0},
+		{0, 1, 1622505660},
+		{1, 1, 1622505660},
+		{0, 2, 1622505780},
+		// Other errors are not authentication failures.
+		{0, 2, 1622505780},
+	} {
+		families := gather(t, e)
+		if got := metricValue(t, families, "uls_up"); got != want.up {
+			t.Errorf("scrape %d: uls_up = %v, want %v", i+1, got, want.up)
+		}
+		if got := metricValue(t, families, "uls_auth_failures_total"); got != want.failures {
+			t.Errorf("scrape %d: uls_auth_failures_total = %v, want %v", i+1, got, want.failures)
+		}
+		if want.last == 0 {
+			if _, ok := families["uls_last_auth_failure_timestamp_seconds"]; ok {
+				t.Errorf("scrape %d: uls_last_auth_failure_timestamp_seconds exported before any failure", i+1)
+			}
+		} else if got := metricValue(t, families, "uls_last_auth_failure_timestamp_seconds"); got != want.last {
+			t.Errorf("scrape %d: uls_last_auth_failure_timestamp_seconds = %v, want %v", i+1, got, want.last)
+		}
+		now = now.Add(time.Minute)
+	}
+}
+
+func TestMaxLeases(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(100))
+	})
+	for _, tc := range []struct {
+		max           int
+		wantLeases    float64
+		wantTruncated float64
+	}{
+		{0, 100, 0},
+		{100, 100, 0},
+		{250, 100, 0},
+		{10, 10, 1},
+	} {
+		e := newTestExporter(t, uls.URL, ExporterOptions{MaxLeases: tc.max})
+		families := gather(t, e)
+		if got := metricValue(t, families, "uls_leases"); got != tc.wantLeases {
+			t.Errorf("max leases %d: uls_leases = %v, want %v", tc.max, got, tc.wantLeases)
+		}
+		if got := metricValue(t, families, "uls_leases_truncated"); got != tc.wantTruncated {
+			t.Errorf("max leases %d: uls_leases_truncated = %v, want %v", tc.max, got, tc.wantTruncated)
+		}
+	}
+	_, err := NewULSExporter("http://localhost:8080", ExporterOptions{MaxLeases: -1})
+	if err == nil {
+		t.Error("max leases -1: expected an error")
+	}
+}
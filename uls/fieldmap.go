@@ -0,0 +1,138 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// fieldMap maps JSON field names of leases in ULS API responses to the JSON
+// names of ULSLease fields, for ULS versions that name them differently.
+type fieldMap map[string]string
+
+// parseFieldMap merges the field mapping from the config file with the JSON
+// object given by -field-map, which wins, and checks that every mapping
+// names a ULSLease field.
+func parseFieldMap(flagValue string, config map[string]string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for from, to := range config {
+		mapping[from] = to
+	}
+	if flagValue != "" {
+		var m map[string]string
+		err := json.Unmarshal([]byte(flagValue), &m)
+		if err != nil {
+			return nil, fmt.Errorf("field map: %w", err)
+		}
+		for from, to := range m {
+			mapping[from] = to
+		}
+	}
+	_, err := newFieldMap(mapping)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// newFieldMap maps the JSON fields in mapping to the ULSLease fields they
+// name, such as "floating_lease_id": "FloatingLeaseID". It returns nil for
+// an empty mapping.
+func newFieldMap(mapping map[string]string) (fieldMap, error) {
+	if len(mapping) == 0 {
+		return nil, nil
+	}
+	froms := make([]string, 0, len(mapping))
+	for from := range mapping {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	t := reflect.TypeOf(ULSLease{})
+	m := fieldMap{}
+	mapped := map[string]string{}
+	for _, from := range froms {
+		to := mapping[from]
+		f, ok := t.FieldByName(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("field map %q: %q is not a lease field", from, to)
+		}
+		if other, ok := mapped[to]; ok {
+			return nil, fmt.Errorf("field map: %q and %q both map to %s", other, from, to)
+		}
+		mapped[to] = from
+		m[from] = strings.Split(f.Tag.Get("json"), ",")[0]
+	}
+	return m, nil
+}
+
+// target returns what to decode a lease into with the mapping applied.
+func (m fieldMap) target(lease *ULSLease) interface{} {
+	if m == nil {
+		return lease
+	}
+	return &mappedLease{lease: lease, fields: m}
+}
+
+// targets returns what to decode an array of leases into with the mapping
+// applied.
+func (m fieldMap) targets(leases *[]ULSLease) interface{} {
+	if m == nil {
+		return leases
+	}
+	return &mappedLeases{leases: leases, fields: m}
+}
+
+// mappedLease decodes a lease after renaming its fields by a fieldMap.
+// Mapped fields replace fields of the same name in the response.
+type mappedLease struct {
+	lease  *ULSLease
+	fields fieldMap
+}
+
+func (l *mappedLease) UnmarshalJSON(b []byte) error {
+	var in map[string]json.RawMessage
+	err := json.Unmarshal(b, &in)
+	if err != nil {
+		return err
+	}
+	out := make(map[string]json.RawMessage, len(in))
+	for name, v := range in {
+		if _, ok := l.fields[name]; !ok {
+			out[name] = v
+		}
+	}
+	for name, v := range in {
+		if to, ok := l.fields[name]; ok {
+			out[to] = v
+		}
+	}
+	b, err = json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, l.lease)
+}
+
+type mappedLeases struct {
+	leases *[]ULSLease
+	fields fieldMap
+}
+
+func (l *mappedLeases) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	err := json.Unmarshal(b, &raw)
+	if err != nil || raw == nil {
+		return err
+	}
+	leases := make([]ULSLease, len(raw))
+	for i := range raw {
+		err := json.Unmarshal(raw[i], l.fields.target(&leases[i]))
+		if err != nil {
+			return err
+		}
+	}
+	*l.leases = leases
+	return nil
+}
@@ -0,0 +1,99 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func snakeLeaseJSON(id int) string {
+	return fmt.Sprintf(`{"floating_lease_id":%d,"token":"00000000-0000-0000-0000-%012d","created_time_utc":"2021-01-01T00:00:00Z","is_revoked":%t,"clientEntitlementContext":{"EnvironmentUser":"user%d"},"entitlement_group_ids":["group"]}`, id, id, id == 2, id)
+}
+
+func TestFieldMapping(t *testing.T) {
+	config, err := parseConfig([]byte(`
+field_mapping:
+  floating_lease_id: FloatingLeaseID
+  created_time_utc: CreatedTimeUTC
+  is_revoked: IsRevoked
+  entitlement_group_ids: EntitlementGroupIDs
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leases := make([]string, 3)
+	for i := range leases {
+		leases[i] = snakeLeaseJSON(i)
+	}
+	for name, tc := range map[string]struct {
+		body string
+		opts ExporterOptions
+	}{
+		"array":  {leasesJSON(leases...), ExporterOptions{}},
+		"stream": {strings.Join(leases, "\n"), ExporterOptions{StreamResponse: true}},
+		"ndjson": {strings.Join(leases, "\n"), ExporterOptions{ResponseNDJSON: true}},
+	} {
+		body := tc.body
+		uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		})
+		tc.opts.FieldMapping = config.FieldMapping
+		e := newTestExporter(t, uls.URL, tc.opts)
+		got, err := e.GetLeases()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		checkLeaseIDs(t, got, 3)
+		l := got[2]
+		if !l.IsRevoked || l.CreatedTimeUTC.Time().Year() != 2021 || !reflect.DeepEqual(l.EntitlementGroupIDs, []string{"group"}) || l.ClientEntitlementContext.EnvironmentUser != "user2" || l.Token.String() != "00000000-0000-0000-0000-000000000002" {
+			t.Errorf("%s: got lease %+v", name, l)
+		}
+	}
+}
+
+func TestFieldMappingReplacesField(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"floatingLeaseId":7,"slot":1}]`)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{FieldMapping: map[string]string{"slot": "FloatingLeaseID"}})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 1 || leases[0].FloatingLeaseID != 1 {
+		t.Errorf("got leases %+v, want the mapped ID 1", leases)
+	}
+}
+
+func TestParseFieldMap(t *testing.T) {
+	got, err := parseFieldMap(`{"slot": "FloatingLeaseID", "revoked": "IsRevoked"}`, map[string]string{"slot": "Token", "group_ids": "EntitlementGroupIDs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"slot": "FloatingLeaseID", "revoked": "IsRevoked", "group_ids": "EntitlementGroupIDs"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got field map %v, want %v", got, want)
+	}
+
+	for value, want := range map[string]string{
+		`{"slot": "Slot"}`:                     `"Slot" is not a lease field`,
+		`{"a": "IsRevoked", "b": "IsRevoked"}`: `"a" and "b" both map to IsRevoked`,
+		`{"slot": 1}`:                          "field map: json",
+		`["floating_lease_id"]`:                "field map: json",
+		`{"": "FloatingLeaseID"}`:              "is not a lease field",
+	} {
+		_, err := parseFieldMap(value, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("field map %s: got error %v, want %q", value, err, want)
+		}
+	}
+}
+
+func TestFieldMappingConfigValidation(t *testing.T) {
+	_, err := parseConfig([]byte("field_mapping:\n  slot: Slot\n"))
+	if err == nil {
+		t.Error("expected an error for a mapping to an unknown field")
+	}
+}
@@ -0,0 +1,19 @@
+package uls
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type observingGatherer struct {
+	prometheus.Gatherer
+	observe func([]*dto.MetricFamily)
+}
+
+func (g observingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	if len(mfs) > 0 {
+		g.observe(mfs)
+	}
+	return mfs, err
+}
@@ -0,0 +1,26 @@
+package uls
+
+import "sync/atomic"
+
+// goroutineGroup counts the goroutines it started that are still running,
+// exported as uls_exporter_goroutines. A nil group starts goroutines
+// without counting them.
+type goroutineGroup struct {
+	running int64
+}
+
+func (g *goroutineGroup) Go(f func()) {
+	if g == nil {
+		go f()
+		return
+	}
+	atomic.AddInt64(&g.running, 1)
+	go func() {
+		defer atomic.AddInt64(&g.running, -1)
+		f()
+	}()
+}
+
+func (g *goroutineGroup) Running() int64 {
+	return atomic.LoadInt64(&g.running)
+}
@@ -0,0 +1,54 @@
+package uls
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitGoroutines waits for the goroutines running in g to reach n.
+func waitGoroutines(t *testing.T, g *goroutineGroup, n int64) {
+	t.Helper()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(5 * time.Second)
+	for g.Running() != n {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			t.Fatalf("%d goroutines running, want %d", g.Running(), n)
+		}
+	}
+}
+
+func TestExporterGoroutinesReturnToBaseline(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nLeasesJSON(2)))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	release := make(chan struct{})
+	e.RegisterPlugin(sandboxedPlugin{Plugin: blockingPlugin{release: release}, timeout: 10 * time.Millisecond, goroutines: &e.goroutines})
+	baseline := e.goroutines.Running()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gather(t, e)
+		}()
+	}
+	wg.Wait()
+	// Each timed out plugin leaves its collector and a drain goroutine
+	// running until the plugin returns.
+	if n := e.goroutines.Running(); n != baseline+8 {
+		t.Errorf("got %d goroutines with blocked plugins, want %d", n, baseline+8)
+	}
+	if v := metricValue(t, gather(t, e), "uls_exporter_goroutines"); v != float64(baseline+8) {
+		t.Errorf("got uls_exporter_goroutines %v, want %d", v, baseline+8)
+	}
+
+	close(release)
+	waitGoroutines(t, &e.goroutines, baseline)
+}
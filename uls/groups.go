@@ -0,0 +1,154 @@
+package uls
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type groupLabeler struct {
+	hash        bool
+	mappingFile string
+
+	mu    sync.Mutex
+	known map[string]string
+}
+
+func newGroupLabeler(hash bool, mappingFile string) *groupLabeler {
+	return &groupLabeler{hash: hash, mappingFile: mappingFile, known: map[string]string{}}
+}
+
+func hashGroupID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Label returns the label value for an entitlement group ID, which is its
+// SHA-256 digest when hashing is enabled.
+func (g *groupLabeler) Label(id string) string {
+	if !g.hash {
+		return id
+	}
+	h := hashGroupID(id)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.known[h]; ok {
+		return h
+	}
+	g.known[h] = id
+	if g.mappingFile != "" {
+		err := g.writeMapping()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return h
+}
+
+func (g *groupLabeler) writeMapping() error {
+	lines := make([]string, 0, len(g.known))
+	for h, id := range g.known {
+		lines = append(lines, fmt.Sprintf("%s %s\n", h, id))
+	}
+	sort.Strings(lines)
+	tmp, err := ioutil.TempFile(filepath.Dir(g.mappingFile), ".group-mapping-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(strings.Join(lines, ""))
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), g.mappingFile)
+}
+
+// groupHistory counts the distinct entitlement group IDs of each lease list
+// and of every lease list since the exporter started.
+type groupHistory struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newGroupHistory() *groupHistory {
+	return &groupHistory{seen: map[string]struct{}{}}
+}
+
+// Observe returns the number of distinct group IDs in leases and the number
+// seen so far, including them.
+func (h *groupHistory) Observe(leases []ULSLease) (current int, lifetime int) {
+	groups := map[string]struct{}{}
+	for _, l := range leases {
+		for _, id := range l.EntitlementGroupIDs {
+			groups[id] = struct{}{}
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id := range groups {
+		h.seen[id] = struct{}{}
+	}
+	return len(groups), len(h.seen)
+}
+
+// countByGroup counts leases by the label of each of their entitlement
+// groups.
+func (e *ULSExporter) countByGroup(leases []ULSLease) map[string]int {
+	counts := map[string]int{}
+	for _, l := range leases {
+		for _, id := range l.EntitlementGroupIDs {
+			counts[e.groups.Label(id)]++
+		}
+	}
+	return counts
+}
+
+const defaultMaxGroupDomainSeries = 1000
+
+type groupDomainCount struct {
+	group  string
+	domain string
+	count  int
+}
+
+// countByGroupAndDomain counts leases by each of their entitlement groups
+// and their environment domain. It returns at most maxGroupDomain pairs,
+// those with the most leases, and how many pairs it left out.
+func (e *ULSExporter) countByGroupAndDomain(leases []ULSLease) ([]groupDomainCount, int) {
+	type pair struct{ group, domain string }
+	counts := map[pair]int{}
+	for _, l := range leases {
+		for _, id := range l.EntitlementGroupIDs {
+			counts[pair{e.groups.Label(id), l.ClientEntitlementContext.EnvironmentDomain}]++
+		}
+	}
+	pairs := make([]groupDomainCount, 0, len(counts))
+	for p, n := range counts {
+		pairs = append(pairs, groupDomainCount{group: p.group, domain: p.domain, count: n})
+	}
+	if len(pairs) <= e.maxGroupDomain {
+		return pairs, 0
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].count != pairs[j].count {
+			return pairs[i].count > pairs[j].count
+		}
+		if pairs[i].group != pairs[j].group {
+			return pairs[i].group < pairs[j].group
+		}
+		return pairs[i].domain < pairs[j].domain
+	})
+	return pairs[:e.maxGroupDomain], len(pairs) - e.maxGroupDomain
+}
@@ -0,0 +1,187 @@
+package uls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestHashGroupID(t *testing.T) {
+	a, b := hashGroupID("unity-pro"), hashGroupID("unity-enterprise")
+	if a == b {
+		t.Errorf("different IDs produced the same hash %s", a)
+	}
+	if again := hashGroupID("unity-pro"); again != a {
+		t.Errorf("same ID produced %s and %s", a, again)
+	}
+	if len(a) != 64 {
+		t.Errorf("hash %q is not a SHA-256 hex digest", a)
+	}
+}
+
+func TestHashedGroupLabels(t *testing.T) {
+	mapping := filepath.Join(t.TempDir(), "groups.txt")
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"token":"6ba7b810-9dad-11d1-80b4-00c04fd430c1","createdTimeUtc":"2021-01-01T00:00:00Z","entitlementGroupIds":["unity-pro"]}]`)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{HashEntitlementGroupIDs: true, EntitlementGroupMappingFile: mapping})
+
+	got := labeledValues(t, gather(t, e), "uls_lease_age_seconds_by_group", "entitlement_group_id")
+	hash := hashGroupID("unity-pro")
+	if _, ok := got[hash]; !ok || len(got) != 1 {
+		t.Errorf("got labels %v, want only %s", got, hash)
+	}
+	b, err := ioutil.ReadFile(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hash + " unity-pro\n"; string(b) != want {
+		t.Errorf("mapping file = %q, want %q", b, want)
+	}
+}
+
+func groupLeasesJSON(groups ...[]string) string {
+	leases := make([]string, len(groups))
+	for i, g := range groups {
+		ids := make([]string, len(g))
+		for j, id := range g {
+			ids[j] = fmt.Sprintf("%q", id)
+		}
+		leases[i] = fmt.Sprintf(`{"floatingLeaseId":%d,"token":"00000000-0000-0000-0000-%012d","createdTimeUtc":"2021-01-01T00:00:00Z","entitlementGroupIds":[%s]}`, i, i, strings.Join(ids, ","))
+	}
+	return leasesJSON(leases...)
+}
+
+func TestEntitlementGroupsObserved(t *testing.T) {
+	fixtures := []string{
+		groupLeasesJSON([]string{"a", "b"}, []string{"b"}, []string{"a", "c"}),
+		groupLeasesJSON([]string{"b", "c"}, []string{"c"}),
+		groupLeasesJSON([]string{"d"}, []string{"e", "f"}),
+		groupLeasesJSON([]string{}),
+	}
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fixtures[atomic.AddInt32(&scrape, 1)-1])
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	for i, want := range []struct {
+		observed, lifetime float64
+	}{
+		{3, 3}, // a, b, c
+		{2, 3}, // overlapping: b, c
+		{3, 6}, // disjoint: d, e, f
+		{0, 6},
+	} {
+		families := gather(t, e)
+		if got := metricValue(t, families, "uls_entitlement_groups_observed"); got != want.observed {
+			t.Errorf("fixture %d: uls_entitlement_groups_observed = %v, want %v", i, got, want.observed)
+		}
+		if got := metricValue(t, families, "uls_entitlement_groups_lifetime_total"); got != want.lifetime {
+			t.Errorf("fixture %d: uls_entitlement_groups_lifetime_total = %v, want %v", i, got, want.lifetime)
+		}
+	}
+}
+
+func TestEntitlementGroupLeaseFraction(t *testing.T) {
+	var body string
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	body = groupLeasesJSON([]string{"a"}, []string{"b"}, []string{"a"}, []string{"c"}, []string{"a"}, []string{"b"}, []string{"a"})
+	got := labeledValues(t, gather(t, e), "uls_entitlement_group_lease_fraction", "entitlement_group_id")
+	want := map[string]float64{"a": 4.0 / 7, "b": 2.0 / 7, "c": 1.0 / 7}
+	sum := 0.0
+	for group, f := range got {
+		sum += f
+		if math.Abs(f-want[group]) > 1e-9 {
+			t.Errorf("group %s: fraction %v, want %v", group, f, want[group])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got fractions for %v, want %v", got, want)
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("fractions sum to %v, want 1", sum)
+	}
+
+	body = "[]"
+	if got := labeledValues(t, gather(t, e), "uls_entitlement_group_lease_fraction", "entitlement_group_id"); len(got) != 0 {
+		t.Errorf("got fractions %v without leases", got)
+	}
+}
+
+func groupDomainLeasesJSON(pairs ...[2]string) string {
+	leases := make([]string, len(pairs))
+	for i, p := range pairs {
+		leases[i] = fmt.Sprintf(`{"floatingLeaseId":%d,"token":"00000000-0000-0000-0000-%012d","createdTimeUtc":"2021-01-01T00:00:00Z","clientEntitlementContext":{"EnvironmentDomain":%q},"entitlementGroupIds":[%q]}`, i, i, p[1], p[0])
+	}
+	return leasesJSON(leases...)
+}
+
+// groupDomainValues returns uls_leases_by_group_and_domain by group/domain.
+func groupDomainValues(t *testing.T, families map[string]*dto.MetricFamily) map[string]float64 {
+	t.Helper()
+	values := map[string]float64{}
+	for _, m := range families["uls_leases_by_group_and_domain"].GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		values[labels["entitlement_group_id"]+"/"+labels["environment_domain"]] = m.GetGauge().GetValue()
+	}
+	return values
+}
+
+func TestLeasesByGroupAndDomain(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, groupDomainLeasesJSON(
+			[2]string{"pro", "corp.example"},
+			[2]string{"pro", "corp.example"},
+			[2]string{"pro", "corp.example"},
+			[2]string{"pro", "lab.example"},
+			[2]string{"pro", "lab.example"},
+			[2]string{"enterprise", "corp.example"},
+			[2]string{"enterprise", ""},
+		))
+	})
+
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	families := gather(t, e)
+	want := map[string]float64{
+		"pro/corp.example":        3,
+		"pro/lab.example":         2,
+		"enterprise/corp.example": 1,
+		"enterprise/":             1,
+	}
+	if got := groupDomainValues(t, families); !reflect.DeepEqual(got, want) {
+		t.Errorf("got uls_leases_by_group_and_domain %v, want %v", got, want)
+	}
+	if got := metricValue(t, families, "uls_leases_by_group_and_domain_dropped_series"); got != 0 {
+		t.Errorf("uls_leases_by_group_and_domain_dropped_series = %v, want 0", got)
+	}
+
+	// Only the pairs with the most leases are kept, ties broken by name.
+	e = newTestExporter(t, uls.URL, ExporterOptions{MaxGroupDomainSeries: 3})
+	families = gather(t, e)
+	want = map[string]float64{
+		"pro/corp.example": 3,
+		"pro/lab.example":  2,
+		"enterprise/":      1,
+	}
+	if got := groupDomainValues(t, families); !reflect.DeepEqual(got, want) {
+		t.Errorf("capped at 3: got uls_leases_by_group_and_domain %v, want %v", got, want)
+	}
+	if got := metricValue(t, families, "uls_leases_by_group_and_domain_dropped_series"); got != 1 {
+		t.Errorf("uls_leases_by_group_and_domain_dropped_series = %v, want 1", got)
+	}
+}
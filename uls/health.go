@@ -0,0 +1,134 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (e *ULSExporter) GetHealth() (map[string]interface{}, error) {
+	healthURL, err := e.paths.URL(e.BaseURL, "/v1/health")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	acceptGzip(req)
+	res, err := e.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("%d %s", res.StatusCode, res.Status)
+	}
+	b, err := e.readBody(res)
+	if err != nil {
+		return nil, err
+	}
+	var health map[string]interface{}
+	err = json.Unmarshal(b, &health)
+	if err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+type healthCollector struct {
+	exporter *ULSExporter
+}
+
+func (e *ULSExporter) HealthCollector() prometheus.Collector {
+	return healthCollector{exporter: e}
+}
+
+// Describe sends nothing: component names come from the health response,
+// so the collector is unchecked.
+func (c healthCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c healthCollector) Collect(ch chan<- prometheus.Metric) {
+	health, err := c.exporter.GetHealth()
+	if err != nil {
+		c.exporter.errorLog.Println(err)
+		return
+	}
+	components := make([]string, 0, len(health))
+	for component := range health {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	seen := map[string]bool{}
+	for _, component := range components {
+		up, ok := healthValue(health[component])
+		name := snakeCase(component)
+		if !ok || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "health", name+"_up"),
+			fmt.Sprintf("ULS health component %s is up", component),
+			nil, nil,
+		)
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, up)
+	}
+}
+
+func healthValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case float64:
+		if v != 0 {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		switch strings.ToLower(v) {
+		case "up", "ok", "healthy", "pass", "passing", "green", "true":
+			return 1, true
+		}
+		return 0, true
+	case map[string]interface{}:
+		for _, key := range []string{"status", "healthy", "up"} {
+			if inner, ok := v[key]; ok {
+				return healthValue(inner)
+			}
+		}
+	}
+	return 0, false
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			if prevLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			prevLower = false
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			prevLower = true
+		default:
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			prevLower = false
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
@@ -0,0 +1,63 @@
+package uls
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthCollector(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{
+			"database": "healthy",
+			"licenseService": {"status": "down"},
+			"cache": true,
+			"queue": {"healthy": false},
+			"version": {"build": "1.2.3"}
+		}`))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	families := gather(t, e.HealthCollector())
+
+	want := map[string]float64{
+		"uls_health_database_up":        1,
+		"uls_health_license_service_up": 0,
+		"uls_health_cache_up":           1,
+		"uls_health_queue_up":           0,
+	}
+	if len(families) != len(want) {
+		t.Errorf("got %d metrics, want %d", len(families), len(want))
+	}
+	for name, v := range want {
+		if got := metricValue(t, families, name); got != v {
+			t.Errorf("got %s %v, want %v", name, got, v)
+		}
+	}
+}
+
+func TestHealthCollectorError(t *testing.T) {
+	uls := newCountingServer(t, http.NotFound)
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	if families := gather(t, e.HealthCollector()); len(families) != 0 {
+		t.Errorf("got %d metrics for a missing health endpoint, want 0", len(families))
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"database":         "database",
+		"licenseService":   "license_service",
+		"license-service":  "license_service",
+		"License Service!": "license_service",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package uls
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// leaseAgeBuckets span a minute to a month.
+var leaseAgeBuckets = []float64{60, 600, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600, 30 * 24 * 3600}
+
+// histogramOpts keeps the classic buckets when native is set, so scrapers
+// using the text format still see them.
+func histogramOpts(name string, help string, buckets []float64, native bool) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}
+	if native {
+		opts.NativeHistogramBucketFactor = 1.1
+	}
+	return opts
+}
+
+// parseBuckets parses a comma-separated list of histogram bucket upper
+// bounds, returning them sorted and without duplicates.
+func parseBuckets(s string) ([]float64, error) {
+	var buckets []float64
+	for _, f := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("histogram bucket %q: %w", f, err)
+		}
+		if !(b > 0) {
+			return nil, fmt.Errorf("histogram bucket %v must be positive", b)
+		}
+		buckets = append(buckets, b)
+	}
+	sort.Float64s(buckets)
+	unique := buckets[:1]
+	for _, b := range buckets[1:] {
+		if b != unique[len(unique)-1] {
+			unique = append(unique, b)
+		}
+	}
+	if len(unique) < 2 {
+		return nil, fmt.Errorf("histogram buckets %q: at least 2 distinct buckets are required", s)
+	}
+	return unique, nil
+}
@@ -0,0 +1,151 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestParseBuckets(t *testing.T) {
+	got, err := parseBuckets("0.5, 0.1,2,0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.1, 0.5, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got buckets %v, want %v", got, want)
+	}
+	for _, s := range []string{"1", "1,1", "0,1", "-1,2", "0.1,fast", "NaN,1"} {
+		_, err := parseBuckets(s)
+		if err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
+
+func TestScrapeDurationBuckets(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Unix(1700000000, 0)
+	var step time.Duration
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		now = now.Add(step)
+		mu.Unlock()
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{HistogramBuckets: "0.01,0.1,1"})
+	e.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	for _, d := range []time.Duration{5 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond, 5 * time.Second} {
+		mu.Lock()
+		step = d
+		mu.Unlock()
+		gather(t, e)
+	}
+
+	mf, ok := gather(t, e)["uls_scrape_duration_seconds"]
+	if !ok || len(mf.Metric) != 1 {
+		t.Fatal("uls_scrape_duration_seconds not found")
+	}
+	got := map[float64]uint64{}
+	for _, b := range mf.Metric[0].Histogram.Bucket {
+		got[b.GetUpperBound()] = b.GetCumulativeCount()
+	}
+	// The last gather observes a fifth scrape of 5s.
+	want := map[float64]uint64{0.01: 1, 0.1: 3, 1: 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got cumulative bucket counts %v, want %v", got, want)
+	}
+	if n := mf.Metric[0].Histogram.GetSampleCount(); n != 5 {
+		t.Errorf("got %d observations, want 5", n)
+	}
+}
+
+func TestHistogramBucketsOption(t *testing.T) {
+	_, err := NewULSExporter("http://localhost", ExporterOptions{HistogramBuckets: "1"})
+	if err == nil {
+		t.Error("single bucket: got no error")
+	}
+}
+
+func TestNativeHistograms(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	for _, native := range []bool{false, true} {
+		e := newTestExporter(t, uls.URL, ExporterOptions{NativeHistograms: native})
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(e)
+		rec := httptest.NewRecorder()
+		promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, name := range []string{"uls_scrape_duration_seconds", "uls_lease_age_seconds"} {
+			if !strings.Contains(rec.Body.String(), "# TYPE "+name+" histogram\n") {
+				t.Errorf("native %v: %s is not exposed as a histogram", native, name)
+			}
+		}
+
+		families := gather(t, e)
+		for _, name := range []string{"uls_scrape_duration_seconds", "uls_lease_age_seconds"} {
+			mf, ok := families[name]
+			if !ok || len(mf.Metric) != 1 {
+				t.Fatalf("%s not found", name)
+			}
+			h := mf.Metric[0].Histogram
+			if len(h.Bucket) == 0 {
+				t.Errorf("native %v: %s has no classic buckets", native, name)
+			}
+			hasNative := h.Schema != nil && len(h.PositiveSpan)+len(h.NegativeSpan) > 0 || h.GetZeroCount() > 0
+			if hasNative != native {
+				t.Errorf("native %v: %s has native buckets %v (schema %v)", native, name, hasNative, h.Schema)
+			}
+		}
+	}
+}
+
+func TestAPILatency(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(100))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	// Every reading of the clock advances it by a millisecond.
+	var mu sync.Mutex
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Millisecond)
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		families := gather(t, e)
+		latency := families["uls_api_latency_seconds"].GetMetric()[0].GetHistogram()
+		scrape := families["uls_scrape_duration_seconds"].GetMetric()[0].GetHistogram()
+		if latency.GetSampleCount() != uint64(i+1) || scrape.GetSampleCount() != uint64(i+1) {
+			t.Fatalf("scrape %d: got %d latency and %d scrape samples", i, latency.GetSampleCount(), scrape.GetSampleCount())
+		}
+		if !(latency.GetSampleSum() > 0) || latency.GetSampleSum() > scrape.GetSampleSum() {
+			t.Errorf("scrape %d: API latency %vs is not within the scrape duration %vs", i, latency.GetSampleSum(), scrape.GetSampleSum())
+		}
+	}
+
+	// With the real clock as well.
+	e = newTestExporter(t, uls.URL, ExporterOptions{})
+	families := gather(t, e)
+	latency := families["uls_api_latency_seconds"].GetMetric()[0].GetHistogram().GetSampleSum()
+	scrape := families["uls_scrape_duration_seconds"].GetMetric()[0].GetHistogram().GetSampleSum()
+	if latency > scrape {
+		t.Errorf("API latency %vs exceeds the scrape duration %vs", latency, scrape)
+	}
+}
@@ -0,0 +1,132 @@
+package uls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// levelTrace is below slog.LevelDebug, for request and response bodies.
+const levelTrace = slog.LevelDebug - 4
+
+// httpLogBodyLimit is the number of bytes of each body logged at trace.
+const httpLogBodyLimit = 1 << 10
+
+const redacted = "REDACTED"
+
+// redactedHeaders are not logged, since they carry credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+var httpLogLevels = map[string]slog.Level{
+	"info":  slog.LevelInfo,
+	"debug": slog.LevelDebug,
+	"trace": levelTrace,
+}
+
+// logWriter writes to the standard logger's output, so that slog records
+// go wherever log.SetOutput sends them.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	return log.Writer().Write(p)
+}
+
+// httpLogTransport logs the requests to the ULS API: failed ones at info,
+// every request at debug, and also the start of each body at trace.
+type httpLogTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+// newHTTPLogTransport wraps base to log at level, one of info, debug or
+// trace. An empty level means info.
+func newHTTPLogTransport(base http.RoundTripper, level string) (http.RoundTripper, error) {
+	if level == "" {
+		level = "info"
+	}
+	l, ok := httpLogLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("HTTP request log level %q must be info, debug or trace", level)
+	}
+	handler := slog.HandlerOptions{Level: l}.NewTextHandler(logWriter{})
+	return &httpLogTransport{base: base, logger: slog.New(handler)}, nil
+}
+
+func (t *httpLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	trace := t.logger.Enabled(ctx, levelTrace)
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.Redacted()),
+		slog.String("headers", formatHeaders(req.Header)),
+	}
+	if trace && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			prefix, _ := peekBody(body)
+			body.Close()
+			attrs = append(attrs, slog.String("request_body", prefix))
+		}
+	}
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		if res.StatusCode >= 400 {
+			level = slog.LevelWarn
+		}
+		attrs = append(attrs, slog.Int("status", res.StatusCode))
+		if trace {
+			var prefix string
+			prefix, res.Body = peekBody(res.Body)
+			attrs = append(attrs, slog.String("response_body", prefix))
+		}
+	}
+	t.logger.LogAttrs(ctx, level, "ULS API request", attrs...)
+	return res, err
+}
+
+func (t *httpLogTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// formatHeaders formats h sorted by name, with the values of
+// redactedHeaders replaced.
+func formatHeaders(h http.Header) string {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := h[name]; ok {
+			h.Set(name, redacted)
+		}
+	}
+	var b strings.Builder
+	h.Write(&b)
+	return strings.ReplaceAll(strings.TrimSuffix(b.String(), "\r\n"), "\r\n", "; ")
+}
+
+// peekBody returns the first httpLogBodyLimit bytes of body, and a body
+// that still reads from the start.
+func peekBody(body io.ReadCloser) (string, io.ReadCloser) {
+	prefix, err := ioutil.ReadAll(io.LimitReader(body, httpLogBodyLimit))
+	rest := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), body), body}
+	if err != nil {
+		return fmt.Sprintf("%s (%s)", prefix, err), rest
+	}
+	return string(prefix), rest
+}
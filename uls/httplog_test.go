@@ -0,0 +1,94 @@
+package uls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHTTPLogLevels(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(100))
+	})
+	for _, tc := range []struct {
+		level    string
+		want     []string
+		dontWant []string
+	}{
+		{"", []string{"level=WARN", "status=503"}, []string{"status=200", "response_body"}},
+		{"info", []string{"level=WARN", "status=503"}, []string{"status=200", "response_body"}},
+		{"debug", []string{"level=DEBUG", "status=200", "url=" + uls.URL + "/ok", "method=POST", "duration=", "status=503"}, []string{"response_body", "request_body"}},
+		{"trace", []string{"status=200", `request_body="{\"user\":\"alice\"}"`, `response_body="[{`, "status=503", `response_body="unavailable\n"`}, nil},
+	} {
+		t.Run(tc.level, func(t *testing.T) {
+			logs := captureLog(t)
+			transport, err := newHTTPLogTransport(http.DefaultTransport, tc.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: transport}
+			for _, path := range []string{"/ok", "/fail"} {
+				req, err := http.NewRequest(http.MethodPost, uls.URL+path, strings.NewReader(`{"user":"alice"}`))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer secret-token")
+				req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+				res, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := ioutil.ReadAll(res.Body)
+				res.Body.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if path == "/ok" && string(b) != nLeasesJSON(100) {
+					t.Errorf("logging changed the response body to %.40q", b)
+				}
+			}
+			out := logs.String()
+			for _, s := range tc.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("log does not contain %q:\n%s", s, out)
+				}
+			}
+			for _, s := range append(tc.dontWant, "secret-token", "c2VjcmV0") {
+				if strings.Contains(out, s) {
+					t.Errorf("log contains %q:\n%s", s, out)
+				}
+			}
+			if strings.Contains(out, "status=") && !strings.Contains(out, "Authorization: REDACTED") {
+				t.Errorf("log does not show the redacted Authorization header:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestHTTPLogBodyLimit(t *testing.T) {
+	body := nLeasesJSON(100)
+	prefix, rest := peekBody(ioutil.NopCloser(strings.NewReader(body)))
+	if len(prefix) != httpLogBodyLimit || !strings.HasPrefix(body, prefix) {
+		t.Errorf("got a %d byte prefix, want the first %d bytes", len(prefix), httpLogBodyLimit)
+	}
+	b, err := ioutil.ReadAll(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != body {
+		t.Error("the body read after peeking differs from the original")
+	}
+}
+
+func TestHTTPLogLevelInvalid(t *testing.T) {
+	_, err := NewULSExporter("http://localhost:8080", ExporterOptions{LogHTTPRequests: "verbose"})
+	if err == nil {
+		t.Error("expected an error for HTTP request log level verbose")
+	}
+}
@@ -0,0 +1,117 @@
+package uls_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"uls_exporter/uls"
+)
+
+const leases = `[
+	{"floatingLeaseId":1,"token":"00000000-0000-0000-0000-000000000001","createdTimeUtc":"2021-01-01T00:00:00Z","lastRenewalTimeUtc":"2021-01-01T00:00:00Z","isRevoked":false,"clientEntitlementContext":{"environmentUser":"alice"},"entitlementGroupIds":["group"]},
+	{"floatingLeaseId":2,"token":"00000000-0000-0000-0000-000000000002","createdTimeUtc":"2021-01-02T00:00:00Z","lastRenewalTimeUtc":"2021-01-02T00:00:00Z","isRevoked":false,"clientEntitlementContext":{"environmentUser":"bob"},"entitlementGroupIds":["group"]}
+]`
+
+func newULS(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, leases)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newExporter(t *testing.T, url string) *uls.ULSExporter {
+	t.Helper()
+	e, err := uls.NewULSExporter(url, uls.ExporterOptions{ScrapeTimeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+func TestLibraryGetLeases(t *testing.T) {
+	e := newExporter(t, newULS(t).URL)
+
+	got, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d leases, want 2", len(got))
+	}
+	var l uls.ULSLease = got[1]
+	var ctx uls.ULSClientEntitlementContext = l.ClientEntitlementContext
+	if l.FloatingLeaseID != 2 || ctx.EnvironmentUser != "bob" {
+		t.Errorf("got lease %d held by %q, want 2 held by bob", l.FloatingLeaseID, ctx.EnvironmentUser)
+	}
+	var created uls.TimeUTC = l.CreatedTimeUTC
+	if want := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC); !created.Time().Equal(want) {
+		t.Errorf("got created time %s, want %s", created.Time(), want)
+	}
+}
+
+func TestLibraryCollector(t *testing.T) {
+	e := newExporter(t, newULS(t).URL)
+
+	var c prometheus.Collector = e
+	reg := prometheus.NewPedanticRegistry()
+	err := reg.Register(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := testutil.GatherAndCount(reg, "uls_up", "uls_leases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d uls_up and uls_leases samples, want 2", n)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "uls_leases" {
+			if v := mf.Metric[0].GetGauge().GetValue(); v != 2 {
+				t.Errorf("uls_leases = %v, want 2", v)
+			}
+			return
+		}
+	}
+	t.Error("uls_leases not gathered")
+}
+
+func TestLibraryDown(t *testing.T) {
+	s := newULS(t)
+	e := newExporter(t, s.URL)
+	s.Close()
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("got no error from a stopped ULS server")
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(e)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == "uls_up" {
+			if v := mf.Metric[0].GetGauge().GetValue(); v != 0 {
+				t.Errorf("uls_up = %v, want 0", v)
+			}
+			return
+		}
+	}
+	t.Error("uls_up not gathered")
+}
@@ -0,0 +1,169 @@
+package uls
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitRequests = 10
+	defaultRateLimitWindow   = time.Minute
+
+	journalMagic      = "ULSJ"
+	journalHeaderSize = 12
+)
+
+// requestJournal limits requests to the ULS API to a number per window,
+// keeping the times of the last requests in a file so that the limit holds
+// across restarts. The file is a fixed-size circular buffer: a header with
+// journalMagic, the number of slots and the index of the next slot to
+// write, followed by the slots, each a request time in Unix nanoseconds, or
+// 0 if unused. All numbers are big-endian.
+type requestJournal struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	file  *os.File
+	times []int64
+	next  int
+}
+
+// openRequestJournal opens the journal at path, creating it if needed, for
+// requests at most per window. A journal written with a different number of
+// requests keeps the latest ones that fit.
+func openRequestJournal(path string, requests int, window time.Duration) (*requestJournal, error) {
+	if requests <= 0 {
+		return nil, fmt.Errorf("rate limit of %d requests must be positive", requests)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	old, err := decodeJournal(b)
+	if err != nil {
+		log.Printf("rate limit journal %s: %s, starting over", path, err)
+	}
+	if len(old) > requests {
+		old = old[len(old)-requests:]
+	}
+	j := &requestJournal{window: window, file: f, times: make([]int64, requests)}
+	j.next = copy(j.times, old) % requests
+	err = j.writeAll()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// decodeJournal returns the request times in b, oldest first.
+func decodeJournal(b []byte) ([]int64, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < journalHeaderSize || string(b[:4]) != journalMagic {
+		return nil, fmt.Errorf("not a rate limit journal")
+	}
+	n := int(binary.BigEndian.Uint32(b[4:]))
+	next := int(binary.BigEndian.Uint32(b[8:]))
+	if len(b) != journalHeaderSize+8*n || next >= n {
+		return nil, fmt.Errorf("journal of %d bytes with %d slots is corrupt", len(b), n)
+	}
+	var times []int64
+	for i := 0; i < n; i++ {
+		slot := (next + i) % n
+		t := int64(binary.BigEndian.Uint64(b[journalHeaderSize+8*slot:]))
+		if t != 0 {
+			times = append(times, t)
+		}
+	}
+	return times, nil
+}
+
+func (j *requestJournal) header() []byte {
+	b := make([]byte, journalHeaderSize)
+	copy(b, journalMagic)
+	binary.BigEndian.PutUint32(b[4:], uint32(len(j.times)))
+	binary.BigEndian.PutUint32(b[8:], uint32(j.next))
+	return b
+}
+
+func (j *requestJournal) writeAll() error {
+	b := make([]byte, journalHeaderSize+8*len(j.times))
+	copy(b, j.header())
+	for i, t := range j.times {
+		binary.BigEndian.PutUint64(b[journalHeaderSize+8*i:], uint64(t))
+	}
+	err := j.file.Truncate(int64(len(b)))
+	if err != nil {
+		return err
+	}
+	_, err = j.file.WriteAt(b, 0)
+	return err
+}
+
+// reserve records a request at now and returns 0, or, if the journal
+// already has its number of requests in the window before now, the time
+// until the oldest of them leaves it.
+func (j *requestJournal) reserve(now time.Time) (time.Duration, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if oldest := j.times[j.next]; oldest != 0 {
+		wait := time.Unix(0, oldest).Add(j.window).Sub(now)
+		if wait > 0 {
+			return wait, nil
+		}
+	}
+	slot := j.next
+	j.times[slot] = now.UnixNano()
+	j.next = (slot + 1) % len(j.times)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(j.times[slot]))
+	_, err := j.file.WriteAt(b[:], int64(journalHeaderSize+8*slot))
+	if err != nil {
+		return 0, err
+	}
+	_, err = j.file.WriteAt(j.header(), 0)
+	return 0, err
+}
+
+func (j *requestJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// waitJournal waits until the rate limit journal allows a request, or ctx
+// is done.
+func (e *ULSExporter) waitJournal(ctx context.Context) error {
+	for {
+		wait, err := e.journal.reserve(e.now())
+		if err != nil {
+			e.errorLog.Printf("rate limit journal: %s", err)
+		}
+		if wait == 0 {
+			return nil
+		}
+		e.errorLog.Printf("rate limit journal: waiting %s before requesting ULS", wait)
+		err = e.sleep(ctx, wait)
+		if err != nil {
+			return err
+		}
+	}
+}
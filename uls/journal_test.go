@@ -0,0 +1,158 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func reserveAt(t *testing.T, j *requestJournal, now time.Time, want time.Duration) {
+	t.Helper()
+	wait, err := j.reserve(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != want {
+		t.Errorf("reserve at %s: wait %s, want %s", now.Format("15:04:05"), wait, want)
+	}
+}
+
+func openJournal(t *testing.T, path string, requests int) *requestJournal {
+	t.Helper()
+	j, err := openRequestJournal(path, requests, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func TestRequestJournalRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	t0 := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	j := openJournal(t, path, 3)
+	for i := 0; i < 3; i++ {
+		reserveAt(t, j, t0.Add(time.Duration(i)*time.Second), 0)
+	}
+	// A fourth request within the minute waits for the first to leave it.
+	reserveAt(t, j, t0.Add(3*time.Second), 57*time.Second)
+	j.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != journalHeaderSize+3*8 {
+		t.Errorf("journal of 3 requests has %d bytes, want %d", info.Size(), journalHeaderSize+3*8)
+	}
+
+	// After a restart, the requests before it still count.
+	j = openJournal(t, path, 3)
+	reserveAt(t, j, t0.Add(10*time.Second), 50*time.Second)
+	reserveAt(t, j, t0.Add(time.Minute), 0)
+	reserveAt(t, j, t0.Add(62*time.Second), 0)
+	reserveAt(t, j, t0.Add(62*time.Second), 0)
+	reserveAt(t, j, t0.Add(62*time.Second), 58*time.Second)
+	j.Close()
+
+	// Restarting with a smaller limit keeps the latest requests, the two at
+	// t0+62s.
+	j = openJournal(t, path, 2)
+	reserveAt(t, j, t0.Add(90*time.Second), 32*time.Second)
+	j.Close()
+
+	// Restarting with a larger limit has room for more.
+	j = openJournal(t, path, 4)
+	reserveAt(t, j, t0.Add(90*time.Second), 0)
+	reserveAt(t, j, t0.Add(90*time.Second), 0)
+	reserveAt(t, j, t0.Add(90*time.Second), 32*time.Second)
+}
+
+func TestRequestJournalCorrupt(t *testing.T) {
+	logs := captureLog(t)
+	path := filepath.Join(t.TempDir(), "journal")
+	err := os.WriteFile(path, []byte("ULSJ\x00\x00\x00\x05\x00\x00\x00\x00"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := openJournal(t, path, 1)
+	t0 := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	reserveAt(t, j, t0, 0)
+	reserveAt(t, j, t0, time.Minute)
+	if !strings.Contains(logs.String(), "is corrupt, starting over") {
+		t.Errorf("log does not mention the corrupt journal:\n%s", logs.String())
+	}
+}
+
+func TestRateLimitJournal(t *testing.T) {
+	captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	path := filepath.Join(t.TempDir(), "journal")
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	start := func() *ULSExporter {
+		e := newTestExporter(t, uls.URL, ExporterOptions{RateLimitJournal: path, RateLimitRequests: 2})
+		e.now = func() time.Time { return now }
+		e.sleep = func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			now = now.Add(d)
+			return nil
+		}
+		return e
+	}
+
+	e := start()
+	for i := 0; i < 2; i++ {
+		_, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	e.Close()
+
+	// Restarting right away does not reset the limit: the first request
+	// waits for the minute to pass.
+	now = now.Add(5 * time.Second)
+	e = start()
+	_, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{53 * time.Second}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("slept %v, want %v", slept, want)
+	}
+	if n := atomic.LoadInt32(&uls.requests); n != 3 {
+		t.Errorf("ULS got %d requests, want 3", n)
+	}
+}
+
+func TestRateLimitJournalCancelled(t *testing.T) {
+	captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{RateLimitJournal: filepath.Join(t.TempDir(), "journal"), RateLimitRequests: 1})
+	_, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = e.GetLeasesContext(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt32(&uls.requests); n != 1 {
+		t.Errorf("ULS got %d requests, want 1", n)
+	}
+}
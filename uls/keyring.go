@@ -0,0 +1,91 @@
+package uls
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keyringService is the service the exporter's OS keyring entries are
+// stored under.
+const keyringService = "uls_exporter"
+
+// staticCredential is a credential that does not change, such as one read
+// from the OS keyring at startup.
+type staticCredential string
+
+func (c staticCredential) Get() string {
+	return string(c)
+}
+
+// keyringEntry names the keyring entry of the credential app uses: the
+// basic auth password of -basic-auth-username, or else the API token.
+func (app *App) keyringEntry() (user, what string) {
+	if app.BasicAuthUsername != "" {
+		return "basic-auth/" + app.BasicAuthUsername, "ULS API password for " + app.BasicAuthUsername
+	}
+	return "token", "ULS API token"
+}
+
+// keyringCredential returns the credential stored in the OS keyring. If
+// there is none, it asks for it with prompt and stores it.
+func (app *App) keyringCredential(prompt func(what string) (string, error)) (string, error) {
+	user, what := app.keyringEntry()
+	secret, err := keyring.Get(keyringService, user)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, keyring.ErrNotFound) {
+		return "", err
+	}
+	secret, err = prompt(what)
+	if err != nil {
+		return "", err
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("empty %s", what)
+	}
+	err = keyring.Set(keyringService, user, secret)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("stored the %s in the keyring", what)
+	return secret, nil
+}
+
+// promptTerminal reads a credential from the terminal on stdin without
+// echoing it.
+func promptTerminal(what string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no %s in the keyring, and stdin is not a terminal to ask for it", what)
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", what)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(b), err
+}
+
+// keyringOptions sets the credential in opts from the OS keyring, or leaves
+// the credential files from flags when the keyring is unavailable.
+func (app *App) keyringOptions(opts *ExporterOptions) {
+	prompt := app.prompt
+	if prompt == nil {
+		prompt = promptTerminal
+	}
+	secret, err := app.keyringCredential(prompt)
+	switch {
+	case err != nil:
+		log.Printf("keyring: %s, using the credential flags", err)
+	case app.BasicAuthUsername != "":
+		opts.BasicAuthPassword = secret
+	default:
+		opts.AuthToken = secret
+	}
+}
@@ -0,0 +1,116 @@
+package uls
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// countingPrompt answers prompts with value and counts them.
+type countingPrompt struct {
+	value string
+	err   error
+	asked []string
+}
+
+func (p *countingPrompt) prompt(what string) (string, error) {
+	p.asked = append(p.asked, what)
+	return p.value, p.err
+}
+
+func TestKeyringCredential(t *testing.T) {
+	captureLog(t)
+	keyring.MockInit()
+	prompt := &countingPrompt{value: "secret-token\n"}
+	app := &App{prompt: prompt.prompt}
+
+	// The first run asks for the token and stores it, later runs read it.
+	for run := 1; run <= 2; run++ {
+		var opts ExporterOptions
+		app.keyringOptions(&opts)
+		if opts.AuthToken != "secret-token" || opts.BasicAuthPassword != "" {
+			t.Errorf("run %d: got token %q and password %q", run, opts.AuthToken, opts.BasicAuthPassword)
+		}
+	}
+	if len(prompt.asked) != 1 || prompt.asked[0] != "ULS API token" {
+		t.Errorf("asked for %q, want the ULS API token once", prompt.asked)
+	}
+	if got, err := keyring.Get(keyringService, "token"); err != nil || got != "secret-token" {
+		t.Errorf("keyring has %q, %v", got, err)
+	}
+
+	// Basic auth passwords are stored by username.
+	prompt = &countingPrompt{value: "hunter2"}
+	app = &App{BasicAuthUsername: "admin", prompt: prompt.prompt}
+	var opts ExporterOptions
+	app.keyringOptions(&opts)
+	if opts.BasicAuthPassword != "hunter2" || opts.AuthToken != "" {
+		t.Errorf("got token %q and password %q", opts.AuthToken, opts.BasicAuthPassword)
+	}
+	if got, err := keyring.Get(keyringService, "basic-auth/admin"); err != nil || got != "hunter2" {
+		t.Errorf("keyring has %q, %v", got, err)
+	}
+}
+
+func TestKeyringUnavailable(t *testing.T) {
+	logs := captureLog(t)
+	keyring.MockInitWithError(errors.New("no secret service"))
+	prompt := &countingPrompt{value: "secret-token"}
+	app := &App{prompt: prompt.prompt}
+	opts := ExporterOptions{AuthTokenFile: "/run/secrets/token"}
+	app.keyringOptions(&opts)
+	if opts.AuthToken != "" || opts.AuthTokenFile != "/run/secrets/token" {
+		t.Errorf("got token %q and token file %q, want the flag", opts.AuthToken, opts.AuthTokenFile)
+	}
+	if len(prompt.asked) != 0 {
+		t.Errorf("asked for %q without a keyring", prompt.asked)
+	}
+	if !strings.Contains(logs.String(), "keyring: no secret service, using the credential flags") {
+		t.Errorf("log does not mention the fallback:\n%s", logs.String())
+	}
+}
+
+func TestKeyringPromptFails(t *testing.T) {
+	captureLog(t)
+	keyring.MockInit()
+	for _, prompt := range []*countingPrompt{
+		{err: errors.New("stdin is not a terminal")},
+		{value: "  \n"},
+	} {
+		app := &App{prompt: prompt.prompt}
+		var opts ExporterOptions
+		app.keyringOptions(&opts)
+		if opts.AuthToken != "" {
+			t.Errorf("got token %q", opts.AuthToken)
+		}
+		if _, err := keyring.Get(keyringService, "token"); !errors.Is(err, keyring.ErrNotFound) {
+			t.Errorf("keyring lookup after a failed prompt: got %v, want not found", err)
+		}
+	}
+}
+
+func TestKeyringCredentialAuth(t *testing.T) {
+	keyring.MockInit()
+	err := keyring.Set(keyringService, "basic-auth/admin", "from-keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writeSecret(t, passwordFile, "from-file")
+	var rec headerRecorder
+	uls := newCountingServer(t, rec.handler("Authorization"))
+	app := &App{BasicAuthUsername: "admin"}
+	opts := ExporterOptions{BasicAuthUsername: "admin", BasicAuthPasswordFile: passwordFile}
+	app.keyringOptions(&opts)
+
+	// The keyring wins over the password file.
+	e := newTestExporter(t, uls.URL, opts)
+	gather(t, e)
+	if got, want := rec.last(), "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:from-keyring")); got != want {
+		t.Errorf("got Authorization %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package uls
+
+import (
+	"os"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// constLabelGatherer adds a label to every gathered metric that does not
+// already have it.
+type constLabelGatherer struct {
+	prometheus.Gatherer
+	name  string
+	value string
+}
+
+func (g constLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+	metrics:
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == g.name {
+					continue metrics
+				}
+			}
+			m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(g.name), Value: proto.String(g.value)})
+			sort.Slice(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+		}
+	}
+	return mfs, err
+}
+
+func (app *App) instance() (string, error) {
+	if app.InstanceLabel != "" {
+		return app.InstanceLabel, nil
+	}
+	return os.Hostname()
+}
@@ -0,0 +1,78 @@
+package uls
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInstanceLabelOnAllMetrics(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector())
+	g, err := e.Gatherer(context.Background(), reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := constLabelGatherer{Gatherer: g, name: "instance", value: "replica-1"}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) == 0 {
+		t.Fatal("no metrics gathered")
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			found := false
+			for i, l := range m.Label {
+				if i > 0 && m.Label[i-1].GetName() > l.GetName() {
+					t.Errorf("%s: labels not sorted", mf.GetName())
+				}
+				if l.GetName() == "instance" && l.GetValue() == "replica-1" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s: no instance=\"replica-1\" label", mf.GetName())
+			}
+		}
+	}
+}
+
+func TestInstanceLabelFlag(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for args, want := range map[string]string{
+		"":                          hostname,
+		"-instance-label=replica-2": "replica-2",
+	} {
+		app := &App{}
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var argv []string
+		if args != "" {
+			argv = []string{args}
+		}
+		_, err := app.configure(fs, argv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := app.instance()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%q: instance = %q, want %q", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package uls
+
+import (
+	"sync"
+	"time"
+)
+
+// leaseLastSeen remembers when each floating lease ID was last held by an
+// active lease, so that slots keep their series after they go dark.
+type leaseLastSeen struct {
+	mu   sync.Mutex
+	seen map[int]time.Time
+}
+
+func newLeaseLastSeen() *leaseLastSeen {
+	return &leaseLastSeen{seen: map[int]time.Time{}}
+}
+
+// Observe records the floating lease IDs of the leases not revoked as seen
+// at now, and returns the last time every ID seen so far was active.
+func (s *leaseLastSeen) Observe(now time.Time, leases []ULSLease) map[int]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range leases {
+		if !l.IsRevoked {
+			s.seen[l.FloatingLeaseID] = now
+		}
+	}
+	seen := make(map[int]time.Time, len(s.seen))
+	for id, t := range s.seen {
+		seen[id] = t
+	}
+	return seen
+}
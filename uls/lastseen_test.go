@@ -0,0 +1,65 @@
+package uls
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// lastSeen returns uls_floating_lease_last_seen_timestamp_seconds by
+// floating lease ID.
+func lastSeen(families map[string]*dto.MetricFamily) map[string]float64 {
+	values := map[string]float64{}
+	mf, ok := families["uls_floating_lease_last_seen_timestamp_seconds"]
+	if !ok {
+		return values
+	}
+	for _, m := range mf.Metric {
+		values[m.Label[0].GetValue()] = m.Gauge.GetValue()
+	}
+	return values
+}
+
+func TestFloatingLeaseLastSeen(t *testing.T) {
+	revoked := strings.Replace(leaseJSON(3, "00000000-0000-0000-0000-000000000003"), `"isRevoked":false`, `"isRevoked":true`, 1)
+	responses := []string{
+		leasesJSON(leaseJSON(1, "00000000-0000-0000-0000-000000000001"), leaseJSON(2, "00000000-0000-0000-0000-000000000002")),
+		// Slot 2 goes dark, and a revoked lease does not hold slot 3.
+		leasesJSON(leaseJSON(1, "00000000-0000-0000-0000-000000000001"), revoked),
+		"error",
+		leasesJSON(leaseJSON(1, "00000000-0000-0000-0000-000000000001")),
+	}
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body := responses[atomic.AddInt32(&scrape, 1)-1]
+		if body == "error" {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(body))
+	})
+	captureLog(t)
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	e.now = func() time.Time { return now }
+
+	t0 := float64(start.Unix())
+	for i, want := range []map[string]float64{
+		{"1": t0, "2": t0},
+		{"1": t0 + 60, "2": t0},
+		{},
+		{"1": t0 + 180, "2": t0},
+	} {
+		got := lastSeen(gather(t, e))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("scrape %d: got last seen %v, want %v", i+1, got, want)
+		}
+		now = now.Add(time.Minute)
+	}
+}
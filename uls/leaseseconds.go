@@ -0,0 +1,26 @@
+package uls
+
+import (
+	"sync"
+	"time"
+)
+
+// leaseSeconds accumulates the lease count integrated over time between
+// scrapes.
+type leaseSeconds struct {
+	mu    sync.Mutex
+	last  time.Time
+	total float64
+}
+
+func (s *leaseSeconds) Observe(now time.Time, count int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.last.IsZero() && now.After(s.last) {
+		s.total += float64(count) * now.Sub(s.last).Seconds()
+	}
+	if now.After(s.last) {
+		s.last = now
+	}
+	return s.total
+}
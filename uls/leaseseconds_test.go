@@ -0,0 +1,38 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLeaseCountAsCounter(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{LeaseCountAsCounter: true})
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	var previous float64
+	for i, want := range []float64{0, 45, 90, 180} {
+		families := gather(t, e)
+		if _, ok := families["uls_leases"]; ok {
+			t.Fatal("uls_leases gauge exported alongside the counter")
+		}
+		got := metricValue(t, families, "uls_leases_total")
+		if got != want {
+			t.Errorf("scrape %d: uls_leases_total = %v, want %v", i+1, got, want)
+		}
+		if got < previous {
+			t.Errorf("scrape %d: counter decreased from %v to %v", i+1, previous, got)
+		}
+		previous = got
+		step := 15 * time.Second
+		if i == 2 {
+			step = 30 * time.Second
+		}
+		now = now.Add(step)
+	}
+}
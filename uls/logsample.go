@@ -0,0 +1,72 @@
+package uls
+
+import (
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultLogSampleBurst    = 100
+	defaultLogSampleInterval = time.Minute
+)
+
+// logSampler logs a rate fraction of the errors it is given, spread evenly
+// and starting with the first, and of those at most burst per interval.
+// With a rate of 1 every error is logged.
+type logSampler struct {
+	rate    float64
+	limiter *rate.Limiter
+	now     func() time.Time
+
+	mu      sync.Mutex
+	seen    uint64
+	dropped uint64
+}
+
+func newLogSampler(sampleRate float64, burst int, interval time.Duration) *logSampler {
+	return &logSampler{
+		rate:    sampleRate,
+		limiter: rate.NewLimiter(rate.Limit(float64(burst)/interval.Seconds()), burst),
+		now:     time.Now,
+	}
+}
+
+func (s *logSampler) allow() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if math.Ceil(float64(s.seen)*s.rate) == math.Ceil(float64(s.seen-1)*s.rate) {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	if !s.limiter.AllowN(s.now(), 1) {
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+	return true
+}
+
+func (s *logSampler) Printf(format string, v ...interface{}) {
+	if s.allow() {
+		log.Printf(format, v...)
+	}
+}
+
+func (s *logSampler) Println(v ...interface{}) {
+	if s.allow() {
+		log.Println(v...)
+	}
+}
+
+// Dropped returns the number of errors that were not logged.
+func (s *logSampler) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
@@ -0,0 +1,92 @@
+package uls
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func countLines(s string) int {
+	return strings.Count(s, "\n")
+}
+
+func TestLogSampler(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		name        string
+		rate        float64
+		burst       int
+		wantLogged  int
+		wantDropped uint64
+	}{
+		{"all", 1, 100, 1000, 0},
+		{"tenth", 0.1, 100, 100, 900},
+		{"burst", 0.5, 100, 100, 900},
+		{"none", 0, 100, 0, 1000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLog(t)
+			s := newLogSampler(tc.rate, tc.burst, time.Minute)
+			s.now = func() time.Time { return now }
+			for i := 0; i < 1000; i++ {
+				s.Printf("error %d", i)
+			}
+			if got := countLines(logs.String()); got != tc.wantLogged {
+				t.Errorf("got %d log lines, want %d", got, tc.wantLogged)
+			}
+			if got := s.Dropped(); got != tc.wantDropped {
+				t.Errorf("got %d dropped, want %d", got, tc.wantDropped)
+			}
+		})
+	}
+}
+
+func TestLogSamplerRefills(t *testing.T) {
+	logs := captureLog(t)
+	now := time.Unix(1700000000, 0)
+	s := newLogSampler(0.5, 10, time.Minute)
+	s.now = func() time.Time { return now }
+	for i := 0; i < 100; i++ {
+		s.Println("error")
+	}
+	now = now.Add(time.Minute)
+	for i := 0; i < 100; i++ {
+		s.Println("error")
+	}
+	if got := countLines(logs.String()); got != 20 {
+		t.Errorf("got %d log lines, want 20", got)
+	}
+}
+
+func TestLogSampleOptions(t *testing.T) {
+	for _, opts := range []ExporterOptions{
+		{LogSampleRate: -0.1},
+		{LogSampleRate: 1.5},
+		{LogSampleBurst: -1},
+		{LogSampleInterval: -time.Second},
+	} {
+		_, err := NewULSExporter("http://localhost", opts)
+		if err == nil {
+			t.Errorf("NewULSExporter(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestLogSampledDroppedMetric(t *testing.T) {
+	logs := captureLog(t)
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{LogSampleRate: 0.5, DisableRetryOn503: true})
+	for i := 0; i < 4; i++ {
+		gather(t, e)
+	}
+	got := metricValue(t, gather(t, e), "uls_log_sampled_dropped_total")
+	if got != 2 {
+		t.Errorf("got uls_log_sampled_dropped_total %v, want 2", got)
+	}
+	if n := strings.Count(logs.String(), "http error"); n != 3 {
+		t.Errorf("got %d logged errors, want 3:\n%s", n, logs.String())
+	}
+}
@@ -0,0 +1,83 @@
+package uls
+
+//go:generate go run ../internal/gen -o ../METRICS.md
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type MetricInfo struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels"`
+}
+
+// metricInfos lists the exporter's own metrics for -list-metrics. Metrics
+// created with newDesc are added automatically.
+var metricInfos = []MetricInfo{
+	{Name: namespace + "_lease_age_seconds_by_group", Type: "summary", Help: "Age of active ULS leases by entitlement group", Labels: []string{"entitlement_group_id", "quantile"}},
+	{Name: namespace + "_scrape_duration_seconds", Type: "histogram", Help: "Duration of scrapes of the ULS API", Labels: []string{"le"}},
+	{Name: namespace + "_lease_age_seconds", Type: "histogram", Help: "Age of active ULS leases", Labels: []string{"le"}},
+	{Name: namespace + "_api_latency_seconds", Type: "histogram", Help: "Round-trip time of ULS API requests, up to the response headers", Labels: []string{"le"}},
+	{Name: namespace + "_api_response_bytes", Type: "histogram", Help: "Size in bytes of ULS API response bodies", Labels: []string{"le"}},
+	{Name: namespace + "_collect_allocs_bytes", Type: "histogram", Help: "Bytes allocated while collecting metrics", Labels: []string{"le"}},
+	{Name: namespace + "_http_server_requests_total", Type: "counter", Help: "Number of requests to the exporter's HTTP server", Labels: []string{"path", "code"}},
+	{Name: namespace + "_http_server_request_duration_seconds", Type: "histogram", Help: "Duration of requests to the exporter's HTTP server", Labels: []string{"path", "le"}},
+	{Name: namespace + "_http_server_response_size_bytes", Type: "histogram", Help: "Size of responses from the exporter's HTTP server", Labels: []string{"path", "le"}},
+	{Name: namespace + "_tls_cert_reload_errors_total", Type: "counter", Help: "Number of failed attempts to reload the server TLS certificate", Labels: []string{}},
+	{Name: namespace + "_health_<component>_up", Type: "gauge", Help: "ULS health component <component> is up", Labels: []string{}},
+}
+
+var valueTypes = map[prometheus.ValueType]string{
+	prometheus.CounterValue: "counter",
+	prometheus.GaugeValue:   "gauge",
+	prometheus.UntypedValue: "untyped",
+}
+
+func newDesc(t prometheus.ValueType, name string, help string, labels ...string) *prometheus.Desc {
+	fqName := prometheus.BuildFQName(namespace, "", name)
+	if labels == nil {
+		labels = []string{}
+	}
+	info := MetricInfo{Name: fqName, Type: valueTypes[t], Help: help, Labels: labels}
+	metricInfos = append(metricInfos, info)
+	desc := prometheus.NewDesc(fqName, help, labels, nil)
+	descInfos[desc] = info
+	return desc
+}
+
+// Metrics returns the exporter's own metrics sorted by name. Plugins and the
+// process and Go runtime collectors are not included.
+func Metrics() []MetricInfo {
+	infos := append([]MetricInfo(nil), metricInfos...)
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func listMetrics(w io.Writer, format string) error {
+	infos := Metrics()
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tTYPE\tLABELS\tHELP")
+		for _, m := range infos {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Name, m.Type, strings.Join(m.Labels, ","), m.Help)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown metrics list format %q, want text or json", format)
+}
@@ -0,0 +1,71 @@
+package uls
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestListMetricsText(t *testing.T) {
+	var buf bytes.Buffer
+	err := listMetrics(&buf, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"uls_up", "uls_leases", "uls_lease_age_seconds_by_group", "uls_wal_events_total"} {
+		if !strings.Contains(buf.String(), name+" ") {
+			t.Errorf("output does not list %s:\n%s", name, buf.String())
+		}
+	}
+}
+
+func TestListMetricsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := listMetrics(&buf, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []MetricInfo
+	err = json.Unmarshal(buf.Bytes(), &infos)
+	if err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, buf.String())
+	}
+	listed := map[string]MetricInfo{}
+	for _, m := range infos {
+		listed[m.Name] = m
+	}
+	if m := listed["uls_up"]; m.Type != "gauge" || m.Help == "" {
+		t.Errorf("uls_up listed as %+v", m)
+	}
+	if m := listed["uls_wal_events_total"]; m.Type != "counter" || len(m.Labels) != 1 || m.Labels[0] != "event" {
+		t.Errorf("uls_wal_events_total listed as %+v", m)
+	}
+
+	e := newTestExporter(t, "http://localhost:8080", ExporterOptions{LeaseWarningThreshold: 1, LeaseCountAsCounter: true, WALDir: t.TempDir()})
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		e.Describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		found := false
+		for name := range listed {
+			if strings.Contains(desc.String(), `fqName: "`+name+`"`) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("described metric not listed: %s", desc)
+		}
+	}
+}
+
+func TestListMetricsUnknownFormat(t *testing.T) {
+	err := listMetrics(&bytes.Buffer{}, "yaml")
+	if err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,78 @@
+package uls
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ndjsonLineSize is the initial size of a line buffer for NDJSON
+// responses, which grows up to the maximum response size.
+const ndjsonLineSize = 64 << 10
+
+// decodeLeaseLines decodes a newline-delimited JSON response body, one lease
+// per line, as it is read. Blank lines are skipped.
+func (e *ULSExporter) decodeLeaseLines(res *http.Response) ([]ULSLease, error) {
+	body, err := decompressedBody(res)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	r := &countingReader{r: io.LimitReader(body, e.maxResponseSize+1)}
+	leases, err := scanLeaseLines(r, int(e.maxResponseSize)+1, e.fields)
+	e.responseBytes.Observe(float64(r.n))
+	switch {
+	case r.n > e.maxResponseSize:
+		return nil, e.tooLarge()
+	case r.err != nil:
+		return nil, &ULSNetworkError{Err: r.err}
+	}
+	return leases, err
+}
+
+// scanLeaseLines parses each non-blank line of r, of at most max bytes, as a
+// lease with fields mapped.
+func scanLeaseLines(r io.Reader, max int, fields fieldMap) ([]ULSLease, error) {
+	s := bufio.NewScanner(r)
+	size := ndjsonLineSize
+	if size > max {
+		size = max
+	}
+	s.Buffer(make([]byte, 0, size), max)
+	s.Split(scanLines)
+	var leases []ULSLease
+	var offset int64
+	for line := 1; s.Scan(); line++ {
+		b := s.Bytes()
+		start := offset
+		offset += int64(len(b)) + 1
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		var lease ULSLease
+		err := json.Unmarshal(b, fields.target(&lease))
+		if err != nil {
+			perr := newParseError(err)
+			perr.Offset += start
+			perr.Err = fmt.Errorf("line %d: %w", line, err)
+			return nil, perr
+		}
+		leases = append(leases, lease)
+	}
+	return leases, s.Err()
+}
+
+// scanLines is bufio.ScanLines without dropping carriage returns, so that
+// line lengths add up to offsets in the body.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
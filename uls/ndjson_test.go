@@ -0,0 +1,70 @@
+package uls
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func ndjsonLeases(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(&b, leaseJSON(i, fmt.Sprintf("00000000-0000-0000-0000-%012d", i)))
+	}
+	return b.String()
+}
+
+func TestResponseNDJSON(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		// Blank lines and CRLF line endings are accepted, and the last
+		// line needs no newline.
+		fmt.Fprint(w, ndjsonLeases(2)+"\n"+leaseJSON(2, "00000000-0000-0000-0000-000000000002")+"\r\n"+leaseJSON(3, "00000000-0000-0000-0000-000000000003"))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{ResponseNDJSON: true})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 4)
+}
+
+func TestResponseNDJSONParseError(t *testing.T) {
+	first := leaseJSON(0, "00000000-0000-0000-0000-000000000000")
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, first+"\n"+`{"floatingLeaseId":"one"}`+"\n")
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{ResponseNDJSON: true})
+	_, err := e.GetLeases()
+	var perr *ULSParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got error %v, want a ULSParseError", err)
+	}
+	if !strings.Contains(err.Error(), "line 2: ") {
+		t.Errorf("error %q does not name line 2", err)
+	}
+	// The offset is past the first line and into the bad value.
+	if past := int64(len(first) + 1); perr.Offset <= past {
+		t.Errorf("got offset %d, want more than %d", perr.Offset, past)
+	}
+}
+
+func TestResponseNDJSONTooLarge(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ndjsonLeases(10))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{ResponseNDJSON: true, MaxResponseSize: 300})
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "exceeds 300 bytes") {
+		t.Errorf("got error %v for a large NDJSON response", err)
+	}
+}
+
+func TestResponseNDJSONWithStreamResponse(t *testing.T) {
+	_, err := NewULSExporter("http://localhost", ExporterOptions{ResponseNDJSON: true, StreamResponse: true})
+	if err == nil {
+		t.Error("expected an error for NDJSON with streamed responses")
+	}
+}
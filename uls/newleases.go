@@ -0,0 +1,40 @@
+package uls
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newLeaseRate estimates the rate of new leases per minute from the tokens
+// that were not in the previous scrape.
+type newLeaseRate struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]struct{}
+	last   time.Time
+}
+
+// Observe returns the number of tokens in leases not in the previous
+// observation per minute since it, or 0 for the first observation, and
+// remembers the tokens for the next.
+func (r *newLeaseRate) Observe(now time.Time, leases []ULSLease) float64 {
+	tokens := make(map[uuid.UUID]struct{}, len(leases))
+	for _, l := range leases {
+		tokens[l.Token] = struct{}{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, last := r.tokens, r.last
+	r.tokens, r.last = tokens, now
+	if previous == nil || !now.After(last) {
+		return 0
+	}
+	n := 0
+	for t := range tokens {
+		if _, ok := previous[t]; !ok {
+			n++
+		}
+	}
+	return float64(n) / now.Sub(last).Seconds() * 60
+}
@@ -0,0 +1,44 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewLeasesRate(t *testing.T) {
+	// The second response drops lease 0 and adds leases 3, 4 and 5.
+	responses := [][]int{{0, 1, 2}, {1, 2, 3, 4, 5}, {1, 2, 3, 4, 5}}
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		ids := responses[atomic.AddInt32(&scrape, 1)-1]
+		leases := make([]string, len(ids))
+		for i, id := range ids {
+			leases[i] = leaseJSON(id, fmt.Sprintf("00000000-0000-0000-0000-%012d", id))
+		}
+		fmt.Fprint(w, leasesJSON(leases...))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	// 3 new leases in 30s are 6 a minute.
+	for i, want := range []float64{0, 6, 0} {
+		if got := metricValue(t, gather(t, e), "uls_new_leases_rate"); got != want {
+			t.Errorf("scrape %d: uls_new_leases_rate = %v, want %v", i+1, got, want)
+		}
+		now = now.Add(30 * time.Second)
+	}
+}
+
+func TestNewLeaseRateSameTime(t *testing.T) {
+	var r newLeaseRate
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	r.Observe(now, nil)
+	leases := []ULSLease{{FloatingLeaseID: 1}}
+	if got := r.Observe(now, leases); got != 0 {
+		t.Errorf("got rate %v without elapsed time, want 0", got)
+	}
+}
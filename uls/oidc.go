@@ -0,0 +1,23 @@
+package uls
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// newOIDCTransport authenticates requests through base with an access token
+// from the client credentials grant. The token is fetched through base too,
+// and fetched again shortly before it expires.
+func newOIDCTransport(base http.RoundTripper, opts ExporterOptions) http.RoundTripper {
+	config := clientcredentials.Config{
+		ClientID:     opts.OIDCClientID,
+		ClientSecret: opts.OIDCClientSecret,
+		TokenURL:     opts.OIDCTokenURL,
+	}
+	client := &http.Client{Transport: base, Timeout: opts.ScrapeTimeout}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+	return &oauth2.Transport{Source: config.TokenSource(ctx), Base: base}
+}
@@ -0,0 +1,106 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTokenEndpoint issues token-1, token-2, ... valid for expiresIn seconds.
+func newTokenEndpoint(t *testing.T, expiresIn int) *countingServer {
+	t.Helper()
+	var n int32
+	var mu sync.Mutex
+	return newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "exporter" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		n++
+		token := fmt.Sprintf("token-%d", n)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":%d}`, token, expiresIn)
+	})
+}
+
+func bearerRecorder(t *testing.T) (*countingServer, *headerRecorder) {
+	t.Helper()
+	rec := &headerRecorder{}
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		rec.mu.Lock()
+		rec.values = append(rec.values, r.Header.Get("Authorization"))
+		rec.mu.Unlock()
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	return s, rec
+}
+
+func TestOIDCRefreshesExpiredToken(t *testing.T) {
+	// Tokens are refreshed 10s before they expire, so a 1s token is
+	// fetched again for every request.
+	tokens := newTokenEndpoint(t, 1)
+	uls, rec := bearerRecorder(t)
+	e := newTestExporter(t, uls.URL, ExporterOptions{OIDCClientID: "exporter", OIDCClientSecret: "s3cret", OIDCTokenURL: tokens.URL})
+
+	for i := 0; i < 2; i++ {
+		_, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if fmt.Sprint(rec.values) != "[Bearer token-1 Bearer token-2]" {
+		t.Errorf("ULS got Authorization %q, want token-1 then token-2", rec.values)
+	}
+	if tokens.Requests() != 2 {
+		t.Errorf("got %d token requests, want 2", tokens.Requests())
+	}
+}
+
+func TestOIDCReusesValidToken(t *testing.T) {
+	tokens := newTokenEndpoint(t, 3600)
+	uls, rec := bearerRecorder(t)
+	e := newTestExporter(t, uls.URL, ExporterOptions{OIDCClientID: "exporter", OIDCClientSecret: "s3cret", OIDCTokenURL: tokens.URL})
+
+	for i := 0; i < 3; i++ {
+		_, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if fmt.Sprint(rec.values) != "[Bearer token-1 Bearer token-1 Bearer token-1]" {
+		t.Errorf("ULS got Authorization %q, want token-1 three times", rec.values)
+	}
+	if tokens.Requests() != 1 {
+		t.Errorf("got %d token requests, want 1", tokens.Requests())
+	}
+}
+
+func TestOIDCInvalidClient(t *testing.T) {
+	tokens := newTokenEndpoint(t, 3600)
+	uls, _ := bearerRecorder(t)
+	e := newTestExporter(t, uls.URL, ExporterOptions{OIDCClientID: "exporter", OIDCClientSecret: "wrong", OIDCTokenURL: tokens.URL})
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("got no error with a rejected client secret")
+	}
+	if uls.Requests() != 0 {
+		t.Errorf("ULS got %d requests without a token, want 0", uls.Requests())
+	}
+}
+
+func TestOIDCExclusiveWithStaticCredentials(t *testing.T) {
+	_, err := NewULSExporter("http://uls", ExporterOptions{OIDCTokenURL: "http://idp/token", AuthTokenFile: "/dev/null"})
+	if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("got error %v, want OIDC and the auth token file to be rejected together", err)
+	}
+}
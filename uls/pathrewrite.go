@@ -0,0 +1,39 @@
+package uls
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// pathRewrite rewrites ULS API paths with a regular expression, for
+// installations that serve the API under other paths such as /uls/v1.
+type pathRewrite struct {
+	from *regexp.Regexp
+	to   string
+}
+
+// newPathRewrite replaces matches of the regular expression from in API
+// paths with to, which may refer to submatches as in
+// regexp.Regexp.ReplaceAllString. It returns nil when from is empty.
+func newPathRewrite(from, to string) (*pathRewrite, error) {
+	if from == "" {
+		if to != "" {
+			return nil, fmt.Errorf("path rewrite to %q needs a pattern to rewrite from", to)
+		}
+		return nil, nil
+	}
+	re, err := regexp.Compile(from)
+	if err != nil {
+		return nil, fmt.Errorf("path rewrite pattern: %w", err)
+	}
+	return &pathRewrite{from: re, to: to}, nil
+}
+
+// URL resolves the API path, rewritten, against base.
+func (r *pathRewrite) URL(base *url.URL, path string) (*url.URL, error) {
+	if r != nil {
+		path = r.from.ReplaceAllString(path, r.to)
+	}
+	return base.Parse(path)
+}
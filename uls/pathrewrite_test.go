@@ -0,0 +1,87 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPathRewrite(t *testing.T) {
+	token := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /uls/v1/admin/lease":
+			fmt.Fprint(w, nLeasesJSON(2))
+		case "GET /uls/v1/health":
+			fmt.Fprint(w, `{"database": "healthy"}`)
+		case "DELETE /uls/v1/admin/lease/" + token.String():
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{PathRewriteFrom: "^/v1/", PathRewriteTo: "/uls/v1/"})
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 2)
+	health, err := e.GetHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health["database"] != "healthy" {
+		t.Errorf("got health %v", health)
+	}
+	err = e.RevokeLease(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPathRewriteURL(t *testing.T) {
+	base, err := url.Parse("https://uls.example.com:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		from, to, path, want string
+	}{
+		{"", "", "/v1/admin/lease", "https://uls.example.com:8443/v1/admin/lease"},
+		{"^/v1/", "/uls/v1/", "/v1/admin/lease", "https://uls.example.com:8443/uls/v1/admin/lease"},
+		{"^/v1/admin/(.*)", "/api/$1/v1", "/v1/admin/lease", "https://uls.example.com:8443/api/lease/v1"},
+		{"^/v2/", "/uls/v2/", "/v1/health", "https://uls.example.com:8443/v1/health"},
+	} {
+		r, err := newPathRewrite(tc.from, tc.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := r.URL(base, tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.String() != tc.want {
+			t.Errorf("rewriting %s with %q to %q: got %s, want %s", tc.path, tc.from, tc.to, u, tc.want)
+		}
+	}
+}
+
+func TestPathRewriteErrors(t *testing.T) {
+	for _, tc := range []struct {
+		from, to, want string
+	}{
+		{"^/v1/(", "/uls/v1/", "path rewrite pattern: error parsing regexp"},
+		{"", "/uls/v1/", "needs a pattern"},
+	} {
+		_, err := NewULSExporter("http://localhost", ExporterOptions{PathRewriteFrom: tc.from, PathRewriteTo: tc.to})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("rewriting %q to %q: got error %v, want %q", tc.from, tc.to, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package uls
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"plugin"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Plugin interface {
+	Name() string
+	Describe(ch chan<- *prometheus.Desc)
+	Collect(leases []ULSLease, ch chan<- prometheus.Metric)
+}
+
+type NoopPlugin struct{}
+
+func (NoopPlugin) Name() string {
+	return "noop"
+}
+
+func (NoopPlugin) Describe(ch chan<- *prometheus.Desc) {}
+
+func (NoopPlugin) Collect(leases []ULSLease, ch chan<- prometheus.Metric) {}
+
+// RegisterPlugin adds p to the collectors run after each successful lease
+// fetch. Plugins must be registered before the exporter itself is
+// registered with Prometheus.
+func (e *ULSExporter) RegisterPlugin(p Plugin) {
+	e.plugins = append(e.plugins, p)
+}
+
+type sandboxedPlugin struct {
+	Plugin
+	timeout    time.Duration
+	goroutines *goroutineGroup
+}
+
+func (p sandboxedPlugin) Collect(leases []ULSLease, ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	p.goroutines.Go(func() {
+		defer close(metrics)
+		p.Plugin.Collect(leases, metrics)
+	})
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				return
+			}
+			ch <- m
+		case <-timer.C:
+			log.Printf("plugin %s: collect timed out after %s", p.Name(), p.timeout)
+			p.goroutines.Go(func() {
+				for range metrics {
+				}
+			})
+			return
+		}
+	}
+}
+
+func loadPlugins(dir string) []Plugin {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	var plugins []Plugin
+	for _, path := range paths {
+		p, err := loadPlugin(path)
+		if err != nil {
+			log.Printf("loading plugin %s: %v", path, err)
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
+
+func loadPlugin(path string) (Plugin, error) {
+	so, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := so.Lookup("Plugin")
+	if err != nil {
+		return nil, err
+	}
+	switch p := sym.(type) {
+	case Plugin:
+		return p, nil
+	case *Plugin:
+		return *p, nil
+	}
+	return nil, fmt.Errorf("symbol Plugin of type %T does not implement Plugin", sym)
+}
@@ -0,0 +1,95 @@
+package uls
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var spyDesc = prometheus.NewDesc("uls_spy_leases", "Leases seen by the spy plugin", nil, nil)
+
+type spyPlugin struct {
+	NoopPlugin
+	calls  int
+	leases []ULSLease
+}
+
+func (p *spyPlugin) Describe(ch chan<- *prometheus.Desc) {
+	ch <- spyDesc
+}
+
+func (p *spyPlugin) Collect(leases []ULSLease, ch chan<- prometheus.Metric) {
+	p.calls++
+	p.leases = leases
+	ch <- prometheus.MustNewConstMetric(spyDesc, prometheus.GaugeValue, float64(len(leases)))
+}
+
+func TestPluginsAreCollected(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nLeasesJSON(2)))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	spy := &spyPlugin{}
+	e.RegisterPlugin(NoopPlugin{})
+	e.RegisterPlugin(spy)
+
+	families := gather(t, e)
+
+	if spy.calls != 1 || len(spy.leases) != 2 {
+		t.Errorf("got %d calls with %d leases, want 1 call with 2 leases", spy.calls, len(spy.leases))
+	}
+	if v := metricValue(t, families, "uls_spy_leases"); v != 2 {
+		t.Errorf("got uls_spy_leases %v, want 2", v)
+	}
+	if spy.Name() != "noop" {
+		t.Errorf("got name %q", spy.Name())
+	}
+}
+
+type blockingPlugin struct {
+	NoopPlugin
+	release chan struct{}
+}
+
+func (p blockingPlugin) Describe(ch chan<- *prometheus.Desc) {
+	ch <- spyDesc
+}
+
+func (p blockingPlugin) Collect(leases []ULSLease, ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(spyDesc, prometheus.GaugeValue, float64(len(leases)))
+	<-p.release
+	ch <- prometheus.MustNewConstMetric(spyDesc, prometheus.GaugeValue, float64(len(leases)))
+}
+
+func TestSandboxedPluginTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	p := sandboxedPlugin{Plugin: blockingPlugin{release: release}, timeout: 50 * time.Millisecond}
+	ch := make(chan prometheus.Metric, 2)
+
+	p.Collect(make([]ULSLease, 3), ch)
+
+	if n := len(ch); n != 1 {
+		t.Errorf("got %d metrics before timeout, want 1", n)
+	}
+}
+
+func TestLoadPluginsSkipsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"broken.so", "README.txt"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte("not a plugin"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugins := loadPlugins(dir)
+
+	if len(plugins) != 0 {
+		t.Errorf("got %d plugins, want 0", len(plugins))
+	}
+}
@@ -0,0 +1,212 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/tsdb"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	recorderRetention   = time.Hour
+	recorderQueryLimit  = 1000000
+	recorderEvalTimeout = 10 * time.Second
+)
+
+type recorder struct {
+	rules  []RecordingRule
+	dir    string
+	db     *tsdb.DB
+	engine *promql.Engine
+	now    func() time.Time
+}
+
+func newRecorder(rules []RecordingRule) (*recorder, error) {
+	dir, err := os.MkdirTemp("", "uls_exporter-recorded-")
+	if err != nil {
+		return nil, err
+	}
+	opts := tsdb.DefaultOptions()
+	opts.WALSegmentSize = -1
+	opts.RetentionDuration = recorderRetention.Milliseconds()
+	db, err := tsdb.Open(dir, nil, nil, opts, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &recorder{
+		rules: rules,
+		dir:   dir,
+		db:    db,
+		engine: promql.NewEngine(promql.EngineOpts{
+			MaxSamples: recorderQueryLimit,
+			Timeout:    recorderEvalTimeout,
+		}),
+		now: time.Now,
+	}, nil
+}
+
+func (r *recorder) Close() error {
+	err := r.db.Close()
+	if rerr := os.RemoveAll(r.dir); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (r *recorder) Append(mfs []*dto.MetricFamily) error {
+	return appendFamilies(r.db, mfs, r.now())
+}
+
+// appendFamilies appends the samples of mfs to db at t.
+func appendFamilies(db *tsdb.DB, mfs []*dto.MetricFamily, t time.Time) error {
+	ts := t.UnixMilli()
+	app := db.Appender(context.Background())
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, s := range familySamples(mf.GetName(), m) {
+				_, err := app.Append(0, s.labels, ts, s.value)
+				if err != nil {
+					app.Rollback()
+					return err
+				}
+			}
+		}
+	}
+	return app.Commit()
+}
+
+func (r *recorder) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return observingGatherer{Gatherer: g, observe: func(mfs []*dto.MetricFamily) {
+		err := r.Append(mfs)
+		if err != nil {
+			log.Println(err)
+		}
+	}}
+}
+
+func (r *recorder) Gather() ([]*dto.MetricFamily, error) {
+	ts := r.now()
+	var mfs []*dto.MetricFamily
+	var errs []string
+	for _, rule := range r.rules {
+		vector, err := r.eval(rule.Expr, ts)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", rule.Record, err))
+			continue
+		}
+		mf := &dto.MetricFamily{
+			Name: proto.String(rule.Record),
+			Help: proto.String("Recorded: " + rule.Expr),
+			Type: dto.MetricType_GAUGE.Enum(),
+		}
+		for _, sample := range vector {
+			b := labels.NewBuilder(sample.Metric).Del(labels.MetricName)
+			for name, value := range rule.Labels {
+				b.Set(name, value)
+			}
+			m := &dto.Metric{Gauge: &dto.Gauge{Value: proto.Float64(sample.V)}}
+			for _, l := range b.Labels() {
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+			}
+			mf.Metric = append(mf.Metric, m)
+		}
+		if len(mf.Metric) > 0 {
+			mfs = append(mfs, mf)
+		}
+	}
+	sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+	if len(errs) > 0 {
+		return mfs, errors.New(strings.Join(errs, "; "))
+	}
+	return mfs, nil
+}
+
+func (r *recorder) eval(expr string, ts time.Time) (promql.Vector, error) {
+	q, err := r.engine.NewInstantQuery(r.db, nil, expr, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	res := q.Exec(context.Background())
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		return v, nil
+	case promql.Scalar:
+		return promql.Vector{{Point: promql.Point{T: v.T, V: v.V}}}, nil
+	}
+	return nil, fmt.Errorf("unsupported result type %s", res.Value.Type())
+}
+
+type sample struct {
+	labels labels.Labels
+	value  float64
+}
+
+func familySamples(name string, m *dto.Metric) []sample {
+	base := map[string]string{}
+	for _, l := range m.Label {
+		base[l.GetName()] = l.GetValue()
+	}
+	series := func(name string, value float64, extra ...string) sample {
+		lbls := map[string]string{labels.MetricName: name}
+		for k, v := range base {
+			lbls[k] = v
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			lbls[extra[i]] = extra[i+1]
+		}
+		return sample{labels: labels.FromMap(lbls), value: value}
+	}
+	switch {
+	case m.Gauge != nil:
+		return []sample{series(name, m.Gauge.GetValue())}
+	case m.Counter != nil:
+		return []sample{series(name, m.Counter.GetValue())}
+	case m.Untyped != nil:
+		return []sample{series(name, m.Untyped.GetValue())}
+	case m.Summary != nil:
+		samples := []sample{
+			series(name+"_sum", m.Summary.GetSampleSum()),
+			series(name+"_count", float64(m.Summary.GetSampleCount())),
+		}
+		for _, q := range m.Summary.Quantile {
+			samples = append(samples, series(name, q.GetValue(), "quantile", formatFloat(q.GetQuantile())))
+		}
+		return samples
+	case m.Histogram != nil:
+		samples := []sample{
+			series(name+"_sum", m.Histogram.GetSampleSum()),
+			series(name+"_count", float64(m.Histogram.GetSampleCount())),
+			series(name+"_bucket", float64(m.Histogram.GetSampleCount()), "le", "+Inf"),
+		}
+		for _, b := range m.Histogram.Bucket {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+			samples = append(samples, series(name+"_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound())))
+		}
+		return samples
+	}
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,91 @@
+package uls
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func newTestRecorder(t *testing.T, rules ...RecordingRule) *recorder {
+	t.Helper()
+	r, err := newRecorder(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := r.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	return r
+}
+
+func TestRecorderEvaluatesRate(t *testing.T) {
+	var leases int32 = 10
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nLeasesJSON(int(atomic.LoadInt32(&leases)))))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	rec := newTestRecorder(t, RecordingRule{
+		Record: "uls_lease_growth_rate",
+		Expr:   "rate(uls_leases[5m])",
+		Labels: map[string]string{"source": "recorded"},
+	})
+	now := time.Unix(1600000000, 0)
+	rec.now = func() time.Time { return now }
+	gatherer := rec.Gatherer(reg)
+
+	_, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&leases, 70)
+	_, err = gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := rec.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "uls_lease_growth_rate" || len(mfs[0].Metric) != 1 {
+		t.Fatalf("got %v, want one uls_lease_growth_rate sample", mfs)
+	}
+	m := mfs[0].Metric[0]
+	// 60 leases over 60s, extrapolated by 10s towards zero, over a 5m window.
+	if got, want := m.Gauge.GetValue(), 70.0/300; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got rate %v, want %v", got, want)
+	}
+	if len(m.Label) != 1 || m.Label[0].GetName() != "source" || m.Label[0].GetValue() != "recorded" {
+		t.Errorf("got labels %v, want source=recorded", m.Label)
+	}
+
+	srv := httptest.NewServer(promhttp.HandlerFor(rec, promhttp.HandlerOpts{}))
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body strings.Builder
+	_, err = io.Copy(&body, res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.String(), `uls_lease_growth_rate{source="recorded"}`) {
+		t.Errorf("recorded endpoint missing sample:\n%s", body.String())
+	}
+}
@@ -0,0 +1,184 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+const (
+	defaultRemoteReadRetention = 24 * time.Hour
+	// remoteReadMaxRequest is the largest compressed read request accepted.
+	remoteReadMaxRequest = 32 << 20
+	// remoteReadMaxSamples is the most samples one read request returns.
+	remoteReadMaxSamples = 5000000
+)
+
+// remoteReadStore keeps the samples of every scrape in a TSDB and serves
+// them with the Prometheus remote read API, so that Prometheus can fill in
+// scrapes it missed. Without a directory the TSDB lives in a temporary
+// directory that is removed on Close, with no WAL.
+type remoteReadStore struct {
+	dir  string
+	temp bool
+	db   *tsdb.DB
+	now  func() time.Time
+}
+
+func newRemoteReadStore(dir string, retention time.Duration) (*remoteReadStore, error) {
+	if retention <= 0 {
+		return nil, fmt.Errorf("remote read retention %s must be positive", retention)
+	}
+	s := &remoteReadStore{dir: dir, now: time.Now}
+	opts := tsdb.DefaultOptions()
+	opts.RetentionDuration = retention.Milliseconds()
+	if dir == "" {
+		var err error
+		s.dir, err = os.MkdirTemp("", "uls_exporter-remote-read-")
+		if err != nil {
+			return nil, err
+		}
+		s.temp = true
+		opts.WALSegmentSize = -1
+	}
+	db, err := tsdb.Open(s.dir, nil, nil, opts, nil)
+	if err != nil {
+		if s.temp {
+			os.RemoveAll(s.dir)
+		}
+		return nil, err
+	}
+	s.db = db
+	return s, nil
+}
+
+func (s *remoteReadStore) Close() error {
+	err := s.db.Close()
+	if s.temp {
+		if rerr := os.RemoveAll(s.dir); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Gatherer stores the samples of every gathering of g.
+func (s *remoteReadStore) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return observingGatherer{Gatherer: g, observe: func(mfs []*dto.MetricFamily) {
+		err := appendFamilies(s.db, mfs, s.now())
+		if err != nil {
+			log.Printf("remote read: %s", err)
+		}
+	}}
+}
+
+// ServeHTTP answers snappy-compressed protobuf remote read requests with
+// samples. Streamed chunks are not supported.
+func (s *remoteReadStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	compressed, err := ioutil.ReadAll(io.LimitReader(r.Body, remoteReadMaxRequest))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req prompb.ReadRequest
+	err = req.Unmarshal(b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := prompb.ReadResponse{}
+	samples := 0
+	for _, q := range req.Queries {
+		result, err := s.query(r.Context(), q, &samples)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.Results = append(res.Results, result)
+	}
+	b, err = res.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	w.Write(snappy.Encode(nil, b))
+}
+
+// query returns the samples matching q, adding their number to samples.
+func (s *remoteReadStore) query(ctx context.Context, q *prompb.Query, samples *int) (*prompb.QueryResult, error) {
+	matchers := make([]*labels.Matcher, 0, len(q.Matchers))
+	for _, m := range q.Matchers {
+		var t labels.MatchType
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+			t = labels.MatchEqual
+		case prompb.LabelMatcher_NEQ:
+			t = labels.MatchNotEqual
+		case prompb.LabelMatcher_RE:
+			t = labels.MatchRegexp
+		case prompb.LabelMatcher_NRE:
+			t = labels.MatchNotRegexp
+		default:
+			return nil, fmt.Errorf("unknown label matcher type %d", m.Type)
+		}
+		matcher, err := labels.NewMatcher(t, m.Name, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	querier, err := s.db.Querier(ctx, q.StartTimestampMs, q.EndTimestampMs)
+	if err != nil {
+		return nil, err
+	}
+	defer querier.Close()
+	hints := &storage.SelectHints{Start: q.StartTimestampMs, End: q.EndTimestampMs}
+	set := querier.Select(false, hints, matchers...)
+	result := &prompb.QueryResult{}
+	for set.Next() {
+		series := set.At()
+		ts := &prompb.TimeSeries{}
+		for _, l := range series.Labels() {
+			ts.Labels = append(ts.Labels, prompb.Label{Name: l.Name, Value: l.Value})
+		}
+		it := series.Iterator()
+		for it.Next() {
+			*samples++
+			if *samples > remoteReadMaxSamples {
+				return nil, fmt.Errorf("query returns more than %d samples", remoteReadMaxSamples)
+			}
+			t, v := it.At()
+			ts.Samples = append(ts.Samples, prompb.Sample{Timestamp: t, Value: v})
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, set.Err()
+}
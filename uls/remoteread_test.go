@@ -0,0 +1,233 @@
+package uls
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func newTestRemoteReadStore(t *testing.T, dir string) *remoteReadStore {
+	t.Helper()
+	s, err := newRemoteReadStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// remoteRead sends a remote read request for the samples of the metric name
+// between start and end to h.
+func remoteRead(t *testing.T, h http.Handler, name string, start, end time.Time) []*prompb.TimeSeries {
+	t.Helper()
+	req := prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: start.UnixMilli(),
+		EndTimestampMs:   end.UnixMilli(),
+		Matchers: []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: name},
+			{Type: prompb.LabelMatcher_NEQ, Name: "instance", Value: "other"},
+		},
+	}}}
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(snappy.Encode(nil, b)))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if ct, ce := w.Header().Get("Content-Type"), w.Header().Get("Content-Encoding"); ct != "application/x-protobuf" || ce != "snappy" {
+		t.Errorf("got Content-Type %q and Content-Encoding %q", ct, ce)
+	}
+	b, err = snappy.Decode(nil, w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res prompb.ReadResponse
+	err = res.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Results) != 1 {
+		t.Fatalf("got %d results, want 1", len(res.Results))
+	}
+	return res.Results[0].Timeseries
+}
+
+func leasesGauge(t *testing.T) (prometheus.Gatherer, prometheus.Gauge) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "uls_leases", ConstLabels: prometheus.Labels{"instance": "uls"}})
+	reg.MustRegister(g)
+	return reg, g
+}
+
+func TestRemoteRead(t *testing.T) {
+	s := newTestRemoteReadStore(t, "")
+	reg, leases := leasesGauge(t)
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s.now = func() time.Time { return now }
+	g := s.Gatherer(reg)
+	for _, v := range []float64{3, 5} {
+		leases.Set(v)
+		_, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	want := []*prompb.TimeSeries{{
+		Labels: []prompb.Label{{Name: "__name__", Value: "uls_leases"}, {Name: "instance", Value: "uls"}},
+		Samples: []prompb.Sample{
+			{Timestamp: start.UnixMilli(), Value: 3},
+			{Timestamp: start.Add(time.Minute).UnixMilli(), Value: 5},
+		},
+	}}
+	if got := remoteRead(t, s, "uls_leases", start, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Only samples in the queried range are returned.
+	want[0].Samples = want[0].Samples[1:]
+	if got := remoteRead(t, s, "uls_leases", start.Add(time.Second), now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v from the second sample on, want %v", got, want)
+	}
+	if got := remoteRead(t, s, "uls_up", start, now); len(got) != 0 {
+		t.Errorf("got %v for a metric never scraped", got)
+	}
+}
+
+func TestRemoteReadPersisted(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newRemoteReadStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, leases := leasesGauge(t)
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	leases.Set(7)
+	_, err = s.Gatherer(reg).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Samples from before a restart are served from the WAL.
+	s = newTestRemoteReadStore(t, dir)
+	got := remoteRead(t, s, "uls_leases", now, now.Add(time.Minute))
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Samples, []prompb.Sample{{Timestamp: now.UnixMilli(), Value: 7}}) {
+		t.Errorf("got %v after reopening, want the sample of 7", got)
+	}
+}
+
+func TestRemoteReadBadRequest(t *testing.T) {
+	s := newTestRemoteReadStore(t, "")
+	for _, tc := range []struct {
+		method string
+		body   []byte
+		want   int
+	}{
+		{http.MethodGet, nil, http.StatusMethodNotAllowed},
+		{http.MethodPost, []byte("not snappy"), http.StatusBadRequest},
+		{http.MethodPost, snappy.Encode(nil, []byte("not protobuf")), http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(tc.method, "/api/v1/read", bytes.NewReader(tc.body)))
+		res := w.Result()
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != tc.want {
+			t.Errorf("%s with %q: got status %d, want %d: %s", tc.method, tc.body, res.StatusCode, tc.want, body)
+		}
+	}
+}
+
+func TestRemoteReadRetention(t *testing.T) {
+	_, err := newRemoteReadStore("", 0)
+	if err == nil {
+		t.Error("expected an error for a zero retention")
+	}
+}
+
+func TestAppRemoteRead(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(nLeasesJSON(2)))
+	})
+	app := startApp(t, "-uri="+uls.URL, "-instance-label=a", "-remote-read", "-metrics-auth-username=prometheus", "-metrics-auth-password=secret")
+	t.Cleanup(func() { app.Stop(context.Background()) })
+	start := time.Now()
+	client := &http.Client{}
+	get, err := http.NewRequest(http.MethodGet, "http://"+app.Addr().String()+"/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get.SetBasicAuth("prometheus", "secret")
+	res, err := client.Do(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	req := prompb.ReadRequest{Queries: []*prompb.Query{{
+		StartTimestampMs: start.Add(-time.Minute).UnixMilli(),
+		EndTimestampMs:   time.Now().Add(time.Minute).UnixMilli(),
+		Matchers:         []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: "uls_leases"}},
+	}}}
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(auth bool) *http.Response {
+		r, err := http.NewRequest(http.MethodPost, "http://"+app.Addr().String()+"/api/v1/read", bytes.NewReader(snappy.Encode(nil, b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth {
+			r.SetBasicAuth("prometheus", "secret")
+		}
+		res, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+	if res := read(false); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d without credentials, want 401", res.StatusCode)
+	}
+	res = read(true)
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("status %d: %s", res.StatusCode, err)
+	}
+	var resp prompb.ReadResponse
+	err = resp.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := resp.Results[0].Timeseries
+	want := []prompb.Label{{Name: "__name__", Value: "uls_leases"}, {Name: "instance", Value: "a"}}
+	if len(series) != 1 || !reflect.DeepEqual(series[0].Labels, want) || len(series[0].Samples) != 1 || series[0].Samples[0].Value != 2 {
+		t.Errorf("got series %v, want one sample of 2 with labels %v", series, want)
+	}
+}
@@ -0,0 +1,112 @@
+package uls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type remoteWriter struct {
+	url      string
+	client   *http.Client
+	username string
+	password *fileCredential
+	now      func() time.Time
+}
+
+func newRemoteWriter(url string, username string, passwordFile string, refresh time.Duration, timeout time.Duration) (*remoteWriter, error) {
+	w := &remoteWriter{url: url, client: &http.Client{Timeout: timeout}, username: username, now: time.Now}
+	if passwordFile != "" {
+		var err error
+		w.password, err = newFileCredential(passwordFile, refresh)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *remoteWriter) Write(ctx context.Context, series []prompb.TimeSeries) error {
+	b, err := (&prompb.WriteRequest{Timeseries: series}).Marshal()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(snappy.Encode(nil, b)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.password != nil {
+		req.SetBasicAuth(w.username, w.password.Get())
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%d %s: %s", res.StatusCode, res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Push gathers g and writes every sample with the current time.
+func (w *remoteWriter) Push(ctx context.Context, g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		if len(mfs) == 0 {
+			return err
+		}
+		log.Println(err)
+	}
+	return w.Write(ctx, timeSeries(mfs, w.now()))
+}
+
+func (w *remoteWriter) Run(ctx context.Context, g prometheus.Gatherer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.Push(ctx, g)
+			if err != nil {
+				log.Printf("remote write: %s", err)
+			}
+		}
+	}
+}
+
+func timeSeries(mfs []*dto.MetricFamily, t time.Time) []prompb.TimeSeries {
+	ts := t.UnixNano() / int64(time.Millisecond)
+	var series []prompb.TimeSeries
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, s := range familySamples(mf.GetName(), m) {
+				lbls := make([]prompb.Label, 0, len(s.labels))
+				for _, l := range s.labels {
+					lbls = append(lbls, prompb.Label{Name: l.Name, Value: l.Value})
+				}
+				series = append(series, prompb.TimeSeries{
+					Labels:  lbls,
+					Samples: []prompb.Sample{{Value: s.value, Timestamp: ts}},
+				})
+			}
+		}
+	}
+	return series
+}
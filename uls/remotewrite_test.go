@@ -0,0 +1,122 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type remoteWriteServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []prompb.WriteRequest
+}
+
+func newRemoteWriteServer(t *testing.T, username, password string) *remoteWriteServer {
+	t.Helper()
+	s := &remoteWriteServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("Content-Encoding") != "snappy" {
+			http.Error(w, "unexpected encoding", http.StatusBadRequest)
+			return
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err = snappy.Decode(nil, b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req prompb.WriteRequest
+		err = req.Unmarshal(b)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func seriesValue(req prompb.WriteRequest, name string) (prompb.Sample, bool) {
+	for _, ts := range req.Timeseries {
+		for _, l := range ts.Labels {
+			if l.Name == "__name__" && l.Value == name && len(ts.Samples) == 1 {
+				return ts.Samples[0], true
+			}
+		}
+	}
+	return prompb.Sample{}, false
+}
+
+func TestRemoteWritePush(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	g, err := e.Gatherer(context.Background(), prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writeSecret(t, passwordFile, "secret\n")
+	rw := newRemoteWriteServer(t, "prometheus", "secret")
+	w, err := newRemoteWriter(rw.URL, "prometheus", passwordFile, time.Minute, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	err = w.Push(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rw.requests) != 1 {
+		t.Fatalf("got %d write requests, want 1", len(rw.requests))
+	}
+	for name, want := range map[string]float64{"uls_up": 1, "uls_leases": 2} {
+		s, ok := seriesValue(rw.requests[0], name)
+		if !ok {
+			t.Errorf("series %s not written", name)
+			continue
+		}
+		if s.Value != want || s.Timestamp != now.UnixNano()/int64(time.Millisecond) {
+			t.Errorf("%s = %+v, want %v at %s", name, s, want, now)
+		}
+	}
+}
+
+func TestRemoteWriteUnauthorized(t *testing.T) {
+	rw := newRemoteWriteServer(t, "prometheus", "secret")
+	w, err := newRemoteWriter(rw.URL, "", "", 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Push(context.Background(), prometheus.NewRegistry())
+	if err == nil {
+		t.Fatal("expected an error without credentials")
+	}
+}
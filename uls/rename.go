@@ -0,0 +1,115 @@
+package uls
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// LabelRename renames the label From of the exporter's metrics to To.
+type LabelRename struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// descInfos maps the descriptors created with newDesc to their metric info,
+// so they can be created again with renamed labels.
+var descInfos = map[*prometheus.Desc]MetricInfo{}
+
+// reservedLabels cannot be renamed to or from: le and quantile are set by
+// histograms and summaries, and instance is added to all metrics.
+var reservedLabels = map[string]bool{"le": true, "quantile": true, "instance": true}
+
+func validateLabelRenames(renames []LabelRename) error {
+	from := map[string]bool{}
+	for _, r := range renames {
+		for _, name := range []string{r.From, r.To} {
+			if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("label rename %s to %s: invalid label name %q", r.From, r.To, name)
+			}
+			if reservedLabels[name] {
+				return fmt.Errorf("label rename %s to %s: label %s is reserved", r.From, r.To, name)
+			}
+		}
+		if from[r.From] {
+			return fmt.Errorf("label %s is renamed more than once", r.From)
+		}
+		from[r.From] = true
+	}
+	return nil
+}
+
+// labelRenamer holds the exporter's descriptors with renamed labels.
+type labelRenamer struct {
+	names map[string]string
+	descs map[*prometheus.Desc]*prometheus.Desc
+}
+
+// newLabelRenamer renames labels in the descriptors created with newDesc and
+// in extra, the labels of the exporter's other metrics. Renaming a label no
+// metric has, or to a label that is already in use, is an error.
+func newLabelRenamer(renames []LabelRename, extra ...string) (*labelRenamer, error) {
+	r := &labelRenamer{names: map[string]string{}, descs: map[*prometheus.Desc]*prometheus.Desc{}}
+	if len(renames) == 0 {
+		return r, nil
+	}
+	err := validateLabelRenames(renames)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, name := range extra {
+		known[name] = true
+	}
+	for _, info := range descInfos {
+		for _, name := range info.Labels {
+			known[name] = true
+		}
+	}
+	to := map[string]bool{}
+	for _, rename := range renames {
+		r.names[rename.From] = rename.To
+		if !known[rename.From] {
+			return nil, fmt.Errorf("label rename %s to %s: no metric has label %s", rename.From, rename.To, rename.From)
+		}
+		if to[rename.To] {
+			return nil, fmt.Errorf("label rename %s to %s: more than one label renamed to %s", rename.From, rename.To, rename.To)
+		}
+		to[rename.To] = true
+	}
+	for _, rename := range renames {
+		if _, renamed := r.names[rename.To]; known[rename.To] && !renamed {
+			return nil, fmt.Errorf("label rename %s to %s: label %s is already in use", rename.From, rename.To, rename.To)
+		}
+	}
+	for desc, info := range descInfos {
+		labels := make([]string, len(info.Labels))
+		renamed := false
+		for i, name := range info.Labels {
+			labels[i] = r.Label(name)
+			renamed = renamed || labels[i] != name
+		}
+		if renamed {
+			r.descs[desc] = prometheus.NewDesc(info.Name, info.Help, labels, nil)
+		}
+	}
+	return r, nil
+}
+
+// Label returns the name to use for label name.
+func (r *labelRenamer) Label(name string) string {
+	if to, ok := r.names[name]; ok {
+		return to
+	}
+	return name
+}
+
+// Desc returns desc, or its copy with renamed labels.
+func (r *labelRenamer) Desc(desc *prometheus.Desc) *prometheus.Desc {
+	if renamed, ok := r.descs[desc]; ok {
+		return renamed
+	}
+	return desc
+}
@@ -0,0 +1,60 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestLabelRename(t *testing.T) {
+	config, err := parseConfig([]byte(`
+label_rename:
+  - from: reason
+    to: cause
+  - from: entitlement_group_id
+    to: group
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{LabelRenames: config.LabelRenames})
+
+	families := gather(t, e)
+	if got := labeledValues(t, families, "uls_scrape_errors_total", "cause"); len(got) != len(scrapeErrorReasons) {
+		t.Errorf("uls_scrape_errors_total by cause: %v", got)
+	}
+	if got := labeledValues(t, families, "uls_scrape_errors_total", "reason"); len(got) != 1 || got[""] != 0 {
+		t.Errorf("uls_scrape_errors_total still has the reason label: %v", got)
+	}
+	if got := labeledValues(t, families, "uls_lease_age_seconds_by_group", "group"); len(got) == 0 {
+		t.Error("uls_lease_age_seconds_by_group has no group label")
+	}
+}
+
+func TestLabelRenameValidation(t *testing.T) {
+	for name, renames := range map[string][]LabelRename{
+		"unknown label":     {{From: "environment_hostname", To: "host"}},
+		"existing label":    {{From: "reason", To: "event"}},
+		"same target":       {{From: "reason", To: "kind"}, {From: "event", To: "kind"}},
+		"renamed twice":     {{From: "reason", To: "cause"}, {From: "reason", To: "kind"}},
+		"reserved label":    {{From: "reason", To: "instance"}},
+		"invalid label":     {{From: "reason", To: "bad-name"}},
+		"histogram buckets": {{From: "le", To: "bucket"}},
+	} {
+		_, err := NewULSExporter("http://localhost", ExporterOptions{LabelRenames: renames})
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+	_, err := NewULSExporter("http://localhost", ExporterOptions{LabelRenames: []LabelRename{{From: "reason", To: "event"}, {From: "event", To: "reason"}}})
+	if err != nil {
+		t.Errorf("swapping labels: %s", err)
+	}
+	_, err = parseConfig([]byte("label_rename:\n  - from: reason\n    to: __name\n"))
+	if err == nil {
+		t.Error("config with an invalid label rename: got no error")
+	}
+}
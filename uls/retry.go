@@ -0,0 +1,139 @@
+package uls
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxRetryAfter = 30 * time.Second
+	// maxUnavailableRetries covers a ULS server restart, which answers 503
+	// for a few seconds.
+	maxUnavailableRetries = 3
+	// minRetryBackoff is the first delay of a retry without Retry-After,
+	// doubled on each further retry.
+	minRetryBackoff = time.Second
+)
+
+// retries returns how many times a request answered with code is retried.
+func (e *ULSExporter) retries(code int) int {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return 1
+	case code == http.StatusServiceUnavailable && e.retryOn503:
+		return maxUnavailableRetries
+	}
+	return 0
+}
+
+// doRetrying sends req, retrying 429 and, unless disabled, 503 responses
+// after a random delay of up to their Retry-After, or of an exponential
+// backoff without one.
+func (e *ULSExporter) doRetrying(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := e.do(req)
+		if err != nil {
+			return nil, &ULSNetworkError{Err: err}
+		}
+		if res.StatusCode == http.StatusTooManyRequests {
+			atomic.AddUint64(&e.rateLimited, 1)
+		}
+		retries := e.retries(res.StatusCode)
+		if retries == 0 {
+			return res, nil
+		}
+		if attempt >= retries {
+			err := newHTTPError(res)
+			res.Body.Close()
+			return nil, fmt.Errorf("%w after %d retries", err, attempt)
+		}
+		res.Body.Close()
+		delay := e.jitter(retryAfter(res.Header.Get("Retry-After"), e.now()))
+		if delay == 0 {
+			// Half the backoff is jittered so that retries never follow
+			// each other immediately.
+			backoff := retryBackoff(attempt)
+			delay = backoff/2 + e.jitter(backoff/2)
+		}
+		err = e.sleep(req.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type jitterSource struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newJitterSource() *jitterSource {
+	var seed int64
+	err := binary.Read(cryptorand.Reader, binary.LittleEndian, &seed)
+	if err != nil {
+		seed = time.Now().UnixNano()
+	}
+	return &jitterSource{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Duration returns a random duration in [0, max].
+func (j *jitterSource) Duration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return time.Duration(j.rand.Int63n(int64(max) + 1))
+}
+
+func (e *ULSExporter) jitter(d time.Duration) time.Duration {
+	return e.jitterSource.Duration(d)
+}
+
+// retryBackoff returns the delay before retry attempt+1 of a response
+// without Retry-After, capped at maxRetryAfter.
+func retryBackoff(attempt int) time.Duration {
+	d := minRetryBackoff
+	for i := 0; i < attempt && d < maxRetryAfter; i++ {
+		d *= 2
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+func retryAfter(s string, now time.Time) time.Duration {
+	var d time.Duration
+	if seconds, err := strconv.Atoi(s); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(s); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,212 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetLeasesRetriesRateLimited(t *testing.T) {
+	var calls int32
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	var slept []time.Duration
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+	if len(slept) != 1 || slept[0] < 0 || slept[0] > 7*time.Second {
+		t.Errorf("slept %v, want one delay of at most 7s", slept)
+	}
+	if got := metricValue(t, gather(t, e), "uls_api_rate_limited_total"); got != 1 {
+		t.Errorf("uls_api_rate_limited_total = %v, want 1", got)
+	}
+}
+
+func TestGetLeasesRateLimitedAfterRetry(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	var slept []time.Duration
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("expected an error after the retry")
+	}
+	if s.Requests() != 2 {
+		t.Errorf("got %d requests, want 2", s.Requests())
+	}
+	if len(slept) != 1 || slept[0] > maxRetryAfter {
+		t.Errorf("slept %v, want one delay of at most %s", slept, maxRetryAfter)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for header, want := range map[string]time.Duration{
+		"3":                             3 * time.Second,
+		"Fri, 01 Jan 2021 00:00:10 GMT": 10 * time.Second,
+		"Thu, 31 Dec 2020 23:00:00 GMT": 0,
+		"3600":                          maxRetryAfter,
+		"":                              0,
+	} {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("%q: got %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestRetryJitterDiffersBetweenExporters(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	var delays []time.Duration
+	for i := 0; i < 2; i++ {
+		e := newTestExporter(t, s.URL, ExporterOptions{})
+		e.sleep = func(ctx context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+		_, err := e.GetLeases()
+		if err == nil {
+			t.Fatal("expected an error after the retry")
+		}
+	}
+	if len(delays) != 2 {
+		t.Fatalf("got delays %v, want 2", delays)
+	}
+	if delays[0] == delays[1] {
+		t.Errorf("both exporters waited %s", delays[0])
+	}
+	for _, d := range delays {
+		if d < 0 || d > 30*time.Second {
+			t.Errorf("delay %s outside [0, 30s]", d)
+		}
+	}
+}
+
+func TestGetLeasesRetriesUnavailable(t *testing.T) {
+	var calls int32
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	var slept []time.Duration
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 3 {
+		t.Errorf("got %d leases, want the 3 from the 200 response", len(leases))
+	}
+	if s.Requests() != 3 {
+		t.Errorf("got %d requests, want 3", s.Requests())
+	}
+	if len(slept) != 2 || slept[0] > 2*time.Second || slept[1] > 2*time.Second {
+		t.Errorf("slept %v, want two delays of at most 2s", slept)
+	}
+}
+
+func TestGetLeasesUnavailableRetriesExhausted(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	e.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("expected an error after the retries")
+	}
+	if want := int32(1 + maxUnavailableRetries); s.Requests() != want {
+		t.Errorf("got %d requests, want %d", s.Requests(), want)
+	}
+}
+
+func TestGetLeasesUnavailableBackoff(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	var slept []time.Duration
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("expected an error after the retries")
+	}
+	if len(slept) != maxUnavailableRetries {
+		t.Fatalf("slept %v, want %d delays", slept, maxUnavailableRetries)
+	}
+	for i, d := range slept {
+		backoff := retryBackoff(i)
+		if d < backoff/2 || d > backoff {
+			t.Errorf("retry %d: slept %s, want [%s, %s]", i+1, d, backoff/2, backoff)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, maxRetryAfter, maxRetryAfter} {
+		if got := retryBackoff(attempt); got != want {
+			t.Errorf("attempt %d: got %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestGetLeasesRetryOn503Disabled(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{DisableRetryOn503: true})
+	e.sleep = func(ctx context.Context, d time.Duration) error {
+		t.Error("slept before a retry")
+		return nil
+	}
+
+	_, err := e.GetLeases()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if s.Requests() != 1 {
+		t.Errorf("got %d requests, want 1", s.Requests())
+	}
+}
@@ -0,0 +1,35 @@
+package uls
+
+import "sync"
+
+const defaultRollingAvgWindow = 5
+
+// rollingAverage averages the last values observed, up to the size of its
+// buffer.
+type rollingAverage struct {
+	mu     sync.Mutex
+	values []float64
+	next   int
+	n      int
+}
+
+func newRollingAverage(window int) *rollingAverage {
+	return &rollingAverage{values: make([]float64, window)}
+}
+
+// Observe adds v, replacing the oldest value once the buffer is full, and
+// returns the average.
+func (r *rollingAverage) Observe(v float64) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[r.next] = v
+	r.next = (r.next + 1) % len(r.values)
+	if r.n < len(r.values) {
+		r.n++
+	}
+	sum := 0.0
+	for _, v := range r.values[:r.n] {
+		sum += v
+	}
+	return sum / float64(r.n)
+}
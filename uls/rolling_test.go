@@ -0,0 +1,64 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRollingAverage(t *testing.T) {
+	r := newRollingAverage(3)
+	for i, tc := range []struct {
+		v, want float64
+	}{
+		{3, 3},
+		{6, 4.5},
+		{9, 6},
+		{12, 9},
+		{12, 11},
+		{12, 12},
+		{0, 8},
+	} {
+		if got := r.Observe(tc.v); got != tc.want {
+			t.Errorf("observation %d of %v: got average %v, want %v", i, tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestLeasesRollingAvg(t *testing.T) {
+	counts := []int{10, 20, 30, 0, 40, 50, 50, 50, 50, 50}
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&scrape, 1) - 1
+		if counts[i] == 0 {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(counts[i]))
+	})
+	captureLog(t)
+	e := newTestExporter(t, uls.URL, ExporterOptions{RollingAvgWindow: 3})
+
+	// The failed fourth scrape is left out of the average.
+	want := []float64{10, 15, 20, -1, 30, 40, 140.0 / 3, 50, 50, 50}
+	for i := range counts {
+		families := gather(t, e)
+		if want[i] < 0 {
+			if _, ok := families["uls_leases_rolling_avg"]; ok {
+				t.Errorf("scrape %d failed but uls_leases_rolling_avg is exported", i)
+			}
+			continue
+		}
+		if got := metricValue(t, families, "uls_leases_rolling_avg"); got != want[i] {
+			t.Errorf("scrape %d: uls_leases_rolling_avg = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestRollingAvgWindowNegative(t *testing.T) {
+	_, err := NewULSExporter("http://localhost:8080", ExporterOptions{RollingAvgWindow: -1})
+	if err == nil {
+		t.Error("expected an error for a negative rolling average window")
+	}
+}
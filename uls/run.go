@@ -0,0 +1,107 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long Main waits for in-flight requests on a
+// shutdown signal.
+const shutdownTimeout = 10 * time.Second
+
+// Start starts the exporter and its HTTP server and returns once the server
+// is listening. Unless Main configured the App, Start parses Args first. Each
+// App has its own HTTP handlers and metrics registry, so several can run in
+// one process.
+func (app *App) Start() error {
+	return app.StartContext(context.Background())
+}
+
+// StartContext is Start with a context that ends the -startup-jitter-max
+// delay early, in which case it returns the context's error.
+func (app *App) StartContext(ctx context.Context) error {
+	if app.httpServer != nil {
+		return errors.New("already started")
+	}
+	if app.config == nil {
+		fs := flag.NewFlagSet("uls_exporter", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		config, err := app.configure(fs, app.Args)
+		if err != nil {
+			return err
+		}
+		app.config = config
+	}
+	if app.StartupJitterMax > 0 {
+		d := newJitterSource().Duration(app.StartupJitterMax)
+		log.Printf("delaying startup by %s", d)
+		err := sleepContext(ctx, d)
+		if err != nil {
+			return err
+		}
+	}
+	var (
+		server *http.Server
+		stop   func()
+		ln     net.Listener
+	)
+	err := startupWithin(app.StartupTimeout, func(context.Context) error {
+		var err error
+		server, stop, err = app.start(app.config)
+		if err != nil {
+			return err
+		}
+		addr := server.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			stop()
+		}
+		return err
+	}, func() {
+		ln.Close()
+		stop()
+	})
+	if err != nil {
+		return err
+	}
+	app.logBanner(app.config)
+	app.httpServer, app.stop, app.listener = server, stop, ln
+	app.served = make(chan struct{})
+	go func() {
+		defer close(app.served)
+		err := app.serve(server, ln)
+		if !errors.Is(err, http.ErrServerClosed) {
+			app.serveErr = err
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the App listens on once started.
+func (app *App) Addr() net.Addr {
+	return app.listener.Addr()
+}
+
+// Stop shuts the HTTP server down, waiting for in-flight requests until ctx
+// is done, and releases what Start acquired.
+func (app *App) Stop(ctx context.Context) error {
+	if app.httpServer == nil {
+		return errors.New("not started")
+	}
+	err := app.httpServer.Shutdown(ctx)
+	if err != nil {
+		app.httpServer.Close()
+	}
+	<-app.served
+	app.stop()
+	return err
+}
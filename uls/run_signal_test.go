@@ -0,0 +1,63 @@
+//go:build !windows
+// +build !windows
+
+package uls
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMainStopsOnSignal(t *testing.T) {
+	if os.Getenv("GO_TEST_MAIN") == "1" {
+		os.Args = []string{"uls_exporter", "-listen=127.0.0.1:0", "-skip-health-scrape"}
+		err := (&App{}).Main()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestMainStopsOnSignal$")
+	cmd.Env = append(os.Environ(), "GO_TEST_MAIN=1")
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The startup banner is logged once the server is listening.
+	var out bytes.Buffer
+	lines := bufio.NewScanner(stderr)
+	for lines.Scan() {
+		out.WriteString(lines.Text() + "\n")
+		if strings.Contains(lines.Text(), `"version"`) {
+			break
+		}
+	}
+	err = cmd.Process.Signal(syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lines.Scan() {
+		out.WriteString(lines.Text() + "\n")
+	}
+	err = cmd.Wait()
+	if err != nil {
+		t.Fatalf("exporter exited with %s:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "shutting down") {
+		t.Errorf("output does not report the shutdown:\n%s", out.String())
+	}
+}
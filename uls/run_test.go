@@ -0,0 +1,199 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startApp(t *testing.T, args ...string) *App {
+	t.Helper()
+	app := &App{Args: append([]string{"-listen=127.0.0.1:0", "-skip-health-scrape"}, args...)}
+	err := app.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func scrapeApp(t *testing.T, client *http.Client, app *App) string {
+	t.Helper()
+	res, err := client.Get("http://" + app.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestAppsInProcess(t *testing.T) {
+	before := runtime.NumGoroutine()
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	a := startApp(t, "-uri="+uls.URL, "-instance-label=a")
+	b := startApp(t, "-uri="+uls.URL, "-instance-label=b", "-collect-go-metrics=false")
+	for _, tc := range []struct {
+		app      *App
+		instance string
+		goStats  bool
+	}{{a, "a", true}, {b, "b", false}} {
+		out := scrapeApp(t, client, tc.app)
+		if !strings.Contains(out, `uls_leases{instance="`+tc.instance+`"} 2`) {
+			t.Errorf("%s: uls_leases not found:\n%s", tc.instance, out)
+		}
+		if strings.Contains(out, "go_goroutines") != tc.goStats {
+			t.Errorf("%s: go_goroutines exported %v, want %v", tc.instance, !tc.goStats, tc.goStats)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, app := range []*App{a, b} {
+		err := app.Stop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := client.Get("http://" + a.Addr().String() + "/metrics")
+	if err == nil {
+		t.Error("stopped app still serving")
+	}
+
+	// Only the mock ULS may be left running.
+	uls.Close()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for runtime.NumGoroutine() > before {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines running after Stop, %d before:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+	}
+}
+
+func TestAppStartErrors(t *testing.T) {
+	a := startApp(t, "-uri=http://localhost")
+	t.Cleanup(func() { a.Stop(context.Background()) })
+	if err := a.Start(); err == nil {
+		t.Error("starting twice: got no error")
+	}
+
+	b := &App{Args: []string{"-listen=" + a.Addr().String(), "-skip-health-scrape"}}
+	if err := b.Start(); err == nil {
+		b.Stop(context.Background())
+		t.Error("listening on an address in use: got no error")
+	}
+	if err := b.Stop(context.Background()); err == nil {
+		t.Error("stopping an app that failed to start: got no error")
+	}
+
+	c := &App{Args: []string{"-no-such-flag"}}
+	if err := c.Start(); err == nil {
+		t.Error("unknown flag: got no error")
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&App{}).RunContext(ctx, []string{"-listen=" + addr, "-uri=" + uls.URL, "-skip-health-scrape"})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(5 * time.Second)
+	for {
+		res, err := client.Get("http://" + addr + "/metrics")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		select {
+		case <-ticker.C:
+		case err := <-done:
+			t.Fatalf("RunContext returned before serving: %v", err)
+		case <-deadline:
+			t.Fatal("exporter not serving after 5s")
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatalf("RunContext still running %s after cancel", shutdownTimeout)
+	}
+	_, err = client.Get("http://" + addr + "/metrics")
+	if err == nil {
+		t.Error("exporter still serving after RunContext returned")
+	}
+}
+
+func TestRunContextCancelJitter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&App{}).RunContext(ctx, []string{"-listen=" + addr, "-skip-health-scrape", "-startup-jitter-max=1h"})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext still delaying startup after cancel")
+	}
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("address bound by a cancelled startup: %s", err)
+	}
+	ln.Close()
+}
+
+func TestRunContextHelp(t *testing.T) {
+	err := (&App{}).RunContext(context.Background(), []string{"-h"})
+	if err != nil {
+		t.Errorf("-h: %s", err)
+	}
+	err = (&App{}).RunContext(context.Background(), []string{"-no-such-flag"})
+	if err == nil {
+		t.Error("unknown flag: got no error")
+	}
+}
@@ -0,0 +1,252 @@
+package uls
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"golang.org/x/net/html"
+)
+
+// samlExchangePath is where ULS takes a SAML response in exchange for a
+// session token. It is also the assertion consumer service URL in the
+// exporter's authentication requests.
+const samlExchangePath = "/v1/auth/saml"
+
+// samlTransport authenticates requests with a ULS session token obtained by
+// SP-initiated SAML: an authentication request is sent to the IdP with the
+// redirect binding, and the IdP's POST binding response is validated and
+// exchanged at ULS. A 401 from ULS discards the session and logs in again.
+type samlTransport struct {
+	base           http.RoundTripper
+	client         *http.Client
+	idpMetadataURL string
+	sp             *saml.ServiceProvider
+
+	mu    sync.Mutex
+	token string
+}
+
+func newSAMLTransport(base http.RoundTripper, baseURL *url.URL, paths *pathRewrite, opts ExporterOptions) (*samlTransport, error) {
+	pair, err := tls.LoadX509KeyPair(opts.SAMLSPCert, opts.SAMLSPKey)
+	if err != nil {
+		return nil, fmt.Errorf("SAML service provider key pair: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("SAML service provider key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	acs, err := paths.URL(baseURL, samlExchangePath)
+	if err != nil {
+		return nil, err
+	}
+	return &samlTransport{
+		base:           base,
+		client:         &http.Client{Transport: base, Timeout: opts.ScrapeTimeout},
+		idpMetadataURL: opts.SAMLIdPURL,
+		sp: &saml.ServiceProvider{
+			Key:             key,
+			Certificate:     cert,
+			MetadataURL:     *acs,
+			AcsURL:          *acs,
+			SignatureMethod: dsig.RSASHA256SignatureMethod,
+		},
+	}, nil
+}
+
+func (t *samlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.session(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("SAML login: %w", err)
+	}
+	res, err := t.roundTrip(req, token)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return res, err
+	}
+	res.Body.Close()
+	t.expire(token)
+	token, err = t.session(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("SAML login: %w", err)
+	}
+	if req.GetBody != nil {
+		req.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.roundTrip(req, token)
+}
+
+func (t *samlTransport) roundTrip(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+func (t *samlTransport) session(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" {
+		return t.token, nil
+	}
+	token, err := t.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
+
+// expire discards token unless another request has already replaced it.
+func (t *samlTransport) expire(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == token {
+		t.token = ""
+	}
+}
+
+func (t *samlTransport) login(ctx context.Context) (string, error) {
+	if t.sp.IDPMetadata == nil {
+		metadata, err := t.fetchMetadata(ctx)
+		if err != nil {
+			return "", err
+		}
+		t.sp.IDPMetadata = metadata
+	}
+	authnRequest, err := t.sp.MakeAuthenticationRequest(t.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+	redirect, err := authnRequest.Redirect("", t.sp)
+	if err != nil {
+		return "", err
+	}
+	page, err := t.get(ctx, redirect.String())
+	if err != nil {
+		return "", fmt.Errorf("IdP: %w", err)
+	}
+	response, err := formValue(page, "SAMLResponse")
+	if err != nil {
+		return "", fmt.Errorf("IdP: %w", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return "", fmt.Errorf("IdP: SAMLResponse: %w", err)
+	}
+	_, err = t.sp.ParseXMLResponse(decoded, []string{authnRequest.ID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return "", fmt.Errorf("IdP: invalid SAML response: %w", err)
+	}
+	return t.exchange(ctx, response)
+}
+
+func (t *samlTransport) fetchMetadata(ctx context.Context) (*saml.EntityDescriptor, error) {
+	b, err := t.get(ctx, t.idpMetadataURL)
+	if err != nil {
+		return nil, fmt.Errorf("IdP metadata: %w", err)
+	}
+	var metadata saml.EntityDescriptor
+	err = xml.Unmarshal(b, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("IdP metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// exchange trades a SAML response for a ULS session token.
+func (t *samlTransport) exchange(ctx context.Context, response string) (string, error) {
+	form := url.Values{"SAMLResponse": {response}}
+	acs := t.sp.AcsURL
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, acs.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ULS session exchange: %d %s", res.StatusCode, res.Status)
+	}
+	var session struct {
+		Token string `json:"token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&session)
+	if err != nil {
+		return "", fmt.Errorf("ULS session exchange: %w", err)
+	}
+	if session.Token == "" {
+		return "", errors.New("ULS session exchange: no token in response")
+	}
+	return session.Token, nil
+}
+
+func (t *samlTransport) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%d %s", res.StatusCode, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// formValue returns the value of the input named name in an HTML page, such
+// as an IdP's auto-submitting POST binding form.
+func formValue(page []byte, name string) (string, error) {
+	z := html.NewTokenizer(strings.NewReader(string(page)))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return "", fmt.Errorf("no %s in response", name)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := z.Token()
+			if tag.Data != "input" {
+				continue
+			}
+			var inputName, value string
+			for _, a := range tag.Attr {
+				switch a.Key {
+				case "name":
+					inputName = a.Val
+				case "value":
+					value = a.Val
+				}
+			}
+			if inputName == name {
+				return value, nil
+			}
+		}
+	}
+}
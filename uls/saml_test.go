@@ -0,0 +1,241 @@
+package uls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+type rsaTestCert struct {
+	cert     *x509.Certificate
+	key      *rsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+func newRSATestCert(t *testing.T, dir string, name string) *rsaTestCert {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &rsaTestCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	writePEM(t, c.certFile, "CERTIFICATE", der)
+	writePEM(t, c.keyFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	return c
+}
+
+type fixedSession struct{}
+
+func (fixedSession) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	return &saml.Session{ID: "session", NameID: "uls_exporter", CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour)}
+}
+
+type fixedServiceProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p fixedServiceProvider) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if serviceProviderID != p.metadata.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return p.metadata, nil
+}
+
+// samlULS is a mock ULS that issues session-1, session-2, ... for SAML
+// responses and only serves leases for the latest session until expired.
+type samlULS struct {
+	*countingServer
+	mu        sync.Mutex
+	sessions  int
+	current   string
+	exchanges []string
+}
+
+func newSAMLULS(t *testing.T) *samlULS {
+	t.Helper()
+	s := &samlULS{}
+	s.countingServer = newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.URL.Path == samlExchangePath {
+			if r.Method != http.MethodPost || r.FormValue("SAMLResponse") == "" {
+				http.Error(w, "bad exchange", http.StatusBadRequest)
+				return
+			}
+			s.sessions++
+			s.current = fmt.Sprintf("session-%d", s.sessions)
+			s.exchanges = append(s.exchanges, r.FormValue("SAMLResponse"))
+			fmt.Fprintf(w, `{"token":%q}`, s.current)
+			return
+		}
+		if s.current == "" || r.Header.Get("Authorization") != "Bearer "+s.current {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, nLeasesJSON(1))
+	})
+	return s
+}
+
+func (s *samlULS) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = ""
+}
+
+// newFakeIdP serves IdP metadata on /metadata and signed assertions for the
+// exporter's service provider on /sso.
+func newFakeIdP(t *testing.T, dir string, sp *rsaTestCert, ulsURL string) *httptest.Server {
+	t.Helper()
+	idpCert := newRSATestCert(t, dir, "idp")
+	acs, err := url.Parse(ulsURL + samlExchangePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spMetadata := (&saml.ServiceProvider{Key: sp.key, Certificate: sp.cert, MetadataURL: *acs, AcsURL: *acs}).Metadata()
+	idp := &saml.IdentityProvider{
+		Key:                     idpCert.key,
+		Certificate:             idpCert.cert,
+		Logger:                  log.New(io.Discard, "", 0),
+		ServiceProviderProvider: fixedServiceProvider{metadata: spMetadata},
+		SessionProvider:         fixedSession{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", idp.ServeMetadata)
+	mux.HandleFunc("/sso", idp.ServeSSO)
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.MetadataURL = *u.ResolveReference(&url.URL{Path: "/metadata"})
+	idp.SSOURL = *u.ResolveReference(&url.URL{Path: "/sso"})
+	return s
+}
+
+func TestSAMLSessionExchange(t *testing.T) {
+	dir := t.TempDir()
+	sp := newRSATestCert(t, dir, "sp")
+	uls := newSAMLULS(t)
+	idp := newFakeIdP(t, dir, sp, uls.URL)
+	e := newTestExporter(t, uls.URL, ExporterOptions{SAMLIdPURL: idp.URL + "/metadata", SAMLSPCert: sp.certFile, SAMLSPKey: sp.keyFile})
+
+	for i := 0; i < 2; i++ {
+		leases, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) != 1 {
+			t.Fatalf("got %d leases, want 1", len(leases))
+		}
+	}
+	uls.mu.Lock()
+	if uls.sessions != 1 {
+		t.Errorf("ULS issued %d sessions, want 1 reused across requests", uls.sessions)
+	}
+	uls.mu.Unlock()
+
+	uls.expire()
+	_, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uls.mu.Lock()
+	defer uls.mu.Unlock()
+	if uls.sessions != 2 {
+		t.Errorf("ULS issued %d sessions, want a new one after 401", uls.sessions)
+	}
+	if len(uls.exchanges) == 2 && uls.exchanges[0] == uls.exchanges[1] {
+		t.Error("both sessions were exchanged with the same SAML response")
+	}
+}
+
+func TestSAMLRejectsUntrustedAssertion(t *testing.T) {
+	dir := t.TempDir()
+	sp := newRSATestCert(t, dir, "sp")
+	uls := newSAMLULS(t)
+	idp := newFakeIdP(t, dir, sp, uls.URL)
+	// Metadata from a different IdP, so the assertion signature does not
+	// verify against the certificate the exporter trusts.
+	other := newFakeIdP(t, t.TempDir(), sp, uls.URL)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := http.Get(other.URL + "/metadata")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		io.WriteString(w, strings.ReplaceAll(string(b), other.URL, idp.URL))
+	}))
+	t.Cleanup(proxy.Close)
+	e := newTestExporter(t, uls.URL, ExporterOptions{SAMLIdPURL: proxy.URL, SAMLSPCert: sp.certFile, SAMLSPKey: sp.keyFile})
+
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "invalid SAML response") {
+		t.Fatalf("got error %v, want invalid SAML response", err)
+	}
+	uls.mu.Lock()
+	defer uls.mu.Unlock()
+	if uls.sessions != 0 {
+		t.Errorf("ULS issued %d sessions for an untrusted assertion, want 0", uls.sessions)
+	}
+}
+
+func TestSAMLOptionErrors(t *testing.T) {
+	dir := t.TempDir()
+	ec := newTestCert(t, dir, "ec", nil, false)
+	for name, opts := range map[string]ExporterOptions{
+		"missing key pair": {SAMLIdPURL: "http://idp/metadata", SAMLSPCert: filepath.Join(dir, "none.crt"), SAMLSPKey: filepath.Join(dir, "none.key")},
+		"non-RSA key":      {SAMLIdPURL: "http://idp/metadata", SAMLSPCert: ec.certFile, SAMLSPKey: ec.keyFile},
+		"with OIDC":        {SAMLIdPURL: "http://idp/metadata", OIDCTokenURL: "http://idp/token"},
+	} {
+		_, err := NewULSExporter("http://localhost", opts)
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
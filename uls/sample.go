@@ -0,0 +1,22 @@
+package uls
+
+import (
+	"math/rand"
+	"time"
+)
+
+// sampleLeases returns a random fraction of leases, picked with a seed
+// derived from the scrape time so that a scrape is reproducible.
+func sampleLeases(leases []ULSLease, fraction float64, scrape time.Time) []ULSLease {
+	if fraction >= 1 {
+		return leases
+	}
+	r := rand.New(rand.NewSource(scrape.UnixNano()))
+	sampled := make([]ULSLease, 0, int(float64(len(leases))*fraction)+1)
+	for _, l := range leases {
+		if r.Float64() < fraction {
+			sampled = append(sampled, l)
+		}
+	}
+	return sampled
+}
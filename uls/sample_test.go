@@ -0,0 +1,59 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSampleFraction(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1000))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{SampleFraction: 0.1})
+	e.now = func() time.Time { return time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	families := gather(t, e)
+
+	if got := metricValue(t, families, "uls_leases"); got != 1000 {
+		t.Errorf("uls_leases = %v, want all 1000 leases", got)
+	}
+	if got := metricValue(t, families, "uls_sample_fraction"); got != 0.1 {
+		t.Errorf("uls_sample_fraction = %v, want 0.1", got)
+	}
+	observed := labeledValues(t, families, "uls_lease_age_seconds_by_group", "entitlement_group_id")["group"]
+	if observed < 70 || observed > 130 {
+		t.Errorf("observed %v lease ages, want about 100", observed)
+	}
+}
+
+func TestSampleLeasesDeterministic(t *testing.T) {
+	leases := make([]ULSLease, 1000)
+	for i := range leases {
+		leases[i].FloatingLeaseID = i
+	}
+	scrape := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := sampleLeases(leases, 0.1, scrape)
+	b := sampleLeases(leases, 0.1, scrape)
+	if len(a) != len(b) {
+		t.Fatalf("same scrape sampled %d and %d leases", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].FloatingLeaseID != b[i].FloatingLeaseID {
+			t.Fatalf("same scrape sampled different leases at %d", i)
+		}
+	}
+	if all := sampleLeases(leases, 1, scrape); len(all) != len(leases) {
+		t.Errorf("fraction 1 sampled %d of %d leases", len(all), len(leases))
+	}
+}
+
+func TestSampleFractionOutOfRange(t *testing.T) {
+	for _, f := range []float64{-0.5, 1.5} {
+		_, err := NewULSExporter("http://localhost:8080", ExporterOptions{SampleFraction: f})
+		if err == nil {
+			t.Errorf("sample fraction %v: expected an error", f)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package uls
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// durationPattern matches the durations time.ParseDuration accepts.
+const durationPattern = `^(0|[-+]?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`
+
+// schemaRules adds the validation performed at startup to the schema of
+// some options.
+var schemaRules = map[string]map[string]interface{}{
+	"sample-fraction":         {"exclusiveMinimum": 0, "maximum": 1},
+	"max-leases":              {"minimum": 0},
+	"rate-limit-requests":     {"minimum": 0},
+	"rolling-avg-window":      {"minimum": 0},
+	"max-group-domain-series": {"minimum": 0},
+	"max-concurrent-fetches":  {"minimum": 0},
+	"log-sample-rate":         {"minimum": 0, "maximum": 1},
+	"log-sample-burst":        {"minimum": 0},
+	"max-response-size":       {"minimum": 0},
+	"http-max-redirects":      {"minimum": 0},
+	"min-tls-version":         {"enum": []string{"1.0", "1.1", "1.2", "1.3"}},
+	"list-metrics-format":     {"enum": []string{"text", "json"}},
+	"generate-completion":     {"enum": []string{"bash", "zsh", "fish"}},
+	"log-http-requests":       {"enum": []string{"info", "debug", "trace"}},
+}
+
+// configSchema returns a JSON Schema for -config files. Options are
+// described from the flags, with their defaults from the embedded default
+// config, and the other sections from the Config struct.
+func configSchema() (map[string]interface{}, error) {
+	config, err := parseConfig(defaultConfig)
+	if err != nil {
+		return nil, err
+	}
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	(&App{}).flags(fs)
+	properties := map[string]interface{}{}
+	var ferr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if def, ok := config.Options[f.Name]; ok {
+			err := f.Value.Set(def)
+			if err != nil && ferr == nil {
+				ferr = err
+			}
+		}
+		properties[f.Name] = flagSchema(f)
+	})
+	if ferr != nil {
+		return nil, ferr
+	}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _ := yamlName(t.Field(i))
+		if name != "" {
+			properties[name] = typeSchema(t.Field(i).Type)
+		}
+	}
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "uls_exporter configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, nil
+}
+
+func flagSchema(f *flag.Flag) map[string]interface{} {
+	s := map[string]interface{}{"description": f.Usage}
+	v := f.Value.(flag.Getter).Get()
+	switch v := v.(type) {
+	case bool:
+		s["type"] = "boolean"
+		s["default"] = v
+	case int, int64, uint, uint64:
+		s["type"] = "integer"
+		s["default"] = v
+	case float64:
+		s["type"] = "number"
+		s["default"] = v
+	case time.Duration:
+		s["type"] = "string"
+		s["pattern"] = durationPattern
+		s["default"] = v.String()
+	default:
+		s["type"] = "string"
+		s["default"] = f.Value.String()
+	}
+	for k, v := range schemaRules[f.Name] {
+		s[k] = v
+	}
+	return s
+}
+
+// typeSchema describes the YAML form of t.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			name, omitempty := yamlName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			properties[name] = typeSchema(t.Field(i).Type)
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	}
+	return map[string]interface{}{}
+}
+
+// yamlName returns the YAML key of field, or "" for inline fields.
+func yamlName(field reflect.StructField) (name string, omitempty bool) {
+	parts := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			return "", false
+		}
+		omitempty = omitempty || opt == "omitempty"
+	}
+	return parts[0], omitempty
+}
+
+// SchemaHandler serves the JSON Schema of the -config file.
+func SchemaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		schema, err := configSchema()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(schema)
+	})
+}
@@ -0,0 +1,105 @@
+package uls
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+func compileSchema(t *testing.T, b []byte) *jsonschema.Schema {
+	t.Helper()
+	c := jsonschema.NewCompiler()
+	// Compiling validates the document against the draft 2020-12 metaschema.
+	err := c.AddResource("schema.json", strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := c.Compile("schema.json")
+	if err != nil {
+		t.Fatalf("invalid JSON Schema: %s", err)
+	}
+	return schema
+}
+
+// yamlValue decodes a YAML document to the types encoding/json produces.
+func yamlValue(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	err := yaml.Unmarshal([]byte(s), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestSchemaHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	SchemaHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schema", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/schema+json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	schema := compileSchema(t, rec.Body.Bytes())
+
+	var doc struct {
+		Properties map[string]struct {
+			Type    string      `json:"type"`
+			Default interface{} `json:"default"`
+		} `json:"properties"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	(&App{}).flags(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := doc.Properties[f.Name]; !ok {
+			t.Errorf("schema has no property %s", f.Name)
+		}
+	})
+	for _, name := range []string{"recording_rules", "label_rename"} {
+		if _, ok := doc.Properties[name]; !ok {
+			t.Errorf("schema has no property %s", name)
+		}
+	}
+	if p := doc.Properties["scrape-timeout"]; p.Type != "string" || p.Default != "10s" {
+		t.Errorf("scrape-timeout: %+v", p)
+	}
+	if p := doc.Properties["http-max-redirects"]; p.Type != "integer" || p.Default != float64(5) {
+		t.Errorf("http-max-redirects: %+v", p)
+	}
+
+	err = schema.Validate(yamlValue(t, string(defaultConfig)))
+	if err != nil {
+		t.Errorf("default config does not match the schema: %#v", err)
+	}
+	for _, invalid := range []string{
+		"scrape-timeout: soon\n",
+		"sample-fraction: 2\n",
+		"retry-on-503: maybe\n",
+		"no-such-option: 1\n",
+		"label_rename:\n  - from: reason\n",
+		"recording_rules:\n  - record: x\n    expr: up\n    extra: 1\n",
+	} {
+		if schema.Validate(yamlValue(t, invalid)) == nil {
+			t.Errorf("%q matches the schema", invalid)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package uls
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+type scrapeCollector struct {
+	*ULSExporter
+	ctx context.Context
+}
+
+func (c scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(c.ctx, ch)
+}
+
+// MetricsHandler serves g together with the exporter's own metrics, fetching
+// leases under the timeout Prometheus sends with each scrape.
+func (e *ULSExporter) MetricsHandler(g prometheus.Gatherer, wrap func(prometheus.Gatherer) prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, ok := parseScrapeTimeout(r.Header)
+		if ok {
+			atomic.StoreInt64(&e.lastScrapeTimeoutN, int64(timeout))
+		}
+		ctx, cancel := e.scrapeContext(r.Context(), timeout, ok)
+		defer cancel()
+		scrape, err := e.Gatherer(ctx, g)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(wrap(scrape), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// Gatherer gathers g together with the exporter's own metrics, and those of
+// its targets, fetching leases with ctx.
+func (e *ULSExporter) Gatherer(ctx context.Context, g prometheus.Gatherer) (prometheus.Gatherer, error) {
+	if len(e.targets) > 0 {
+		targets, err := targetsGatherer(ctx, append([]*ULSExporter{e}, e.targets...), e.maxConcurrentFetches)
+		if err != nil {
+			return nil, err
+		}
+		return prometheus.Gatherers{g, targets}, nil
+	}
+	reg := prometheus.NewRegistry()
+	err := reg.Register(scrapeCollector{ULSExporter: e, ctx: ctx})
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.Gatherers{g, reg}, nil
+}
+
+func (e *ULSExporter) scrapeContext(ctx context.Context, timeout time.Duration, ok bool) (context.Context, context.CancelFunc) {
+	if ok {
+		if timeout > scrapeTimeoutOffset {
+			timeout -= scrapeTimeoutOffset
+		}
+	} else {
+		timeout = e.scrapeTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (e *ULSExporter) lastScrapeTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.lastScrapeTimeoutN))
+}
+
+func parseScrapeTimeout(h http.Header) (time.Duration, bool) {
+	s := h.Get(scrapeTimeoutHeader)
+	if s == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
@@ -0,0 +1,73 @@
+package uls
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScrapeContextDefaultTimeout(t *testing.T) {
+	e := newTestExporter(t, "http://localhost:8080", ExporterOptions{ScrapeTimeout: 10 * time.Second})
+	timeout, ok := parseScrapeTimeout(http.Header{})
+	if ok {
+		t.Fatalf("parsed timeout %s from missing header", timeout)
+	}
+	before := time.Now()
+	ctx, cancel := e.scrapeContext(context.Background(), timeout, ok)
+	defer cancel()
+	after := time.Now()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("scrape context has no deadline")
+	}
+	if deadline.Before(before.Add(10*time.Second)) || deadline.After(after.Add(10*time.Second)) {
+		t.Fatalf("deadline %s is not the 10s default from %s", deadline, before)
+	}
+}
+
+func TestParseScrapeTimeout(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"10.0": 10 * time.Second,
+		"0.25": 250 * time.Millisecond,
+		"":     0,
+		"abc":  0,
+		"-1":   0,
+	} {
+		h := http.Header{}
+		if header != "" {
+			h.Set(scrapeTimeoutHeader, header)
+		}
+		got, _ := parseScrapeTimeout(h)
+		if got != want {
+			t.Errorf("%q: got %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestMetricsHandlerScrapeTimeoutHeader(t *testing.T) {
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+	handler := e.MetricsHandler(prometheus.NewRegistry(), func(g prometheus.Gatherer) prometheus.Gatherer { return g })
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(scrapeTimeoutHeader, "0.6")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("scrape took %s, header timeout was not applied", elapsed)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"uls_up 0", "uls_scrape_timeout_seconds 0.6"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("response missing %q:\n%s", want, body)
+		}
+	}
+}
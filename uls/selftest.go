@@ -0,0 +1,26 @@
+package uls
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// selfTest pushes a single synthetic sample to a Prometheus remote write
+// endpoint and reports whether it was accepted.
+func selfTest(ctx context.Context, w *remoteWriter, now time.Time) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	return w.Write(ctx, []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: namespace + "_self_test"},
+			{Name: "instance", Value: hostname},
+			{Name: "job", Value: "uls_exporter"},
+		},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixNano() / int64(time.Millisecond)}},
+	}})
+}
@@ -0,0 +1,72 @@
+package uls
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestSelfTest(t *testing.T) {
+	var got prompb.WriteRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("Content-Encoding = %q", r.Header.Get("Content-Encoding"))
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		b, err = snappy.Decode(nil, b)
+		if err != nil {
+			t.Error(err)
+		}
+		err = got.Unmarshal(b)
+		if err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	w, err := newRemoteWriter(s.URL, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = selfTest(context.Background(), w, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Timeseries) != 1 {
+		t.Fatalf("got %d series, want 1", len(got.Timeseries))
+	}
+	ts := got.Timeseries[0]
+	if ts.Labels[0].Value != "uls_self_test" {
+		t.Errorf("metric name = %q", ts.Labels[0].Value)
+	}
+	if len(ts.Samples) != 1 || ts.Samples[0].Value != 1 || ts.Samples[0].Timestamp != now.UnixNano()/int64(time.Millisecond) {
+		t.Errorf("samples = %v", ts.Samples)
+	}
+}
+
+func TestSelfTestRejected(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer s.Close()
+
+	w, err := newRemoteWriter(s.URL, "", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = selfTest(context.Background(), w, time.Now())
+	if err == nil {
+		t.Fatal("expected an error for a rejected write")
+	}
+}
@@ -0,0 +1,60 @@
+package uls
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// responseSizeBuckets span 100 bytes to 10 MB.
+var responseSizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+
+// serverMetrics instruments the exporter's own HTTP handlers, by the path
+// they are served on.
+type serverMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+}
+
+func newServerMetrics(native bool) *serverMetrics {
+	return &serverMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_server_requests_total",
+			Help:      "Number of requests to the exporter's HTTP server",
+		}, []string{"path", "code"}),
+		duration: prometheus.NewHistogramVec(histogramOpts("http_server_request_duration_seconds", "Duration of requests to the exporter's HTTP server", prometheus.DefBuckets, native), []string{"path"}),
+		size:     prometheus.NewHistogramVec(histogramOpts("http_server_response_size_bytes", "Size of responses from the exporter's HTTP server", responseSizeBuckets, native), []string{"path"}),
+	}
+}
+
+func (m *serverMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+	m.size.Describe(ch)
+}
+
+func (m *serverMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+	m.size.Collect(ch)
+}
+
+// Handler instruments h, served on path.
+func (m *serverMetrics) Handler(path string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"path": path}
+	h = promhttp.InstrumentHandlerResponseSize(m.size.MustCurryWith(labels), h)
+	h = promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels), h)
+	return promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), h)
+}
+
+// healthzHandler answers liveness checks of the exporter itself, without
+// contacting ULS.
+func healthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,63 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getApp(t *testing.T, app *App, path string) string {
+	t.Helper()
+	res, err := http.Get("http://" + app.Addr().String() + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", path, res.Status)
+	}
+	return string(b)
+}
+
+func TestServerMetrics(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+	app := startApp(t, "-uri="+uls.URL, "-instance-label=test")
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		app.Stop(ctx)
+	})
+
+	if got := getApp(t, app, "/healthz"); got != "ok\n" {
+		t.Errorf("GET /healthz = %q, want ok", got)
+	}
+	getApp(t, app, "/healthz")
+	getApp(t, app, "/metrics")
+	out := getApp(t, app, "/metrics")
+
+	for _, want := range []string{
+		`uls_http_server_requests_total{code="200",instance="test",path="/healthz"} 2`,
+		`uls_http_server_requests_total{code="200",instance="test",path="/metrics"} 1`,
+		`uls_http_server_request_duration_seconds_count{instance="test",path="/healthz"} 2`,
+		`uls_http_server_request_duration_seconds_count{instance="test",path="/metrics"} 1`,
+		`uls_http_server_response_size_bytes_count{instance="test",path="/healthz"} 2`,
+		`uls_http_server_response_size_bytes_sum{instance="test",path="/healthz"} 6`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(out, `path="/schema"`) {
+		t.Error("metrics have a series for /schema, which was not requested")
+	}
+}
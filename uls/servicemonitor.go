@@ -0,0 +1,94 @@
+package uls
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+type serviceMonitor struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string            `yaml:"name"`
+		Namespace string            `yaml:"namespace"`
+		Labels    map[string]string `yaml:"labels,omitempty"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Selector struct {
+			MatchLabels map[string]string `yaml:"matchLabels"`
+		} `yaml:"selector"`
+		NamespaceSelector struct {
+			MatchNames []string `yaml:"matchNames"`
+		} `yaml:"namespaceSelector"`
+		Endpoints []serviceMonitorEndpoint `yaml:"endpoints"`
+	} `yaml:"spec"`
+}
+
+type serviceMonitorEndpoint struct {
+	TargetPort int    `yaml:"targetPort"`
+	Path       string `yaml:"path"`
+	Interval   string `yaml:"interval"`
+}
+
+// parseLabels parses comma-separated name=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("label %q must be name=value", pair)
+		}
+		labels[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return labels, nil
+}
+
+// writeServiceMonitor writes a Prometheus Operator ServiceMonitor that
+// scrapes the exporter on its -listen port and -path through its Service.
+// The ServiceMonitor selects the Service by its app.kubernetes.io/name
+// label, which must be the Service name.
+func (app *App) writeServiceMonitor(w io.Writer) error {
+	labels, err := parseLabels(app.GenerateServiceMonitorLabels)
+	if err != nil {
+		return fmt.Errorf("-generate-service-monitor-labels: %w", err)
+	}
+	_, port, err := net.SplitHostPort(app.Listen)
+	if err != nil {
+		return err
+	}
+	targetPort, err := net.LookupPort("tcp", port)
+	if err != nil {
+		return err
+	}
+	var sm serviceMonitor
+	sm.APIVersion = "monitoring.coreos.com/v1"
+	sm.Kind = "ServiceMonitor"
+	sm.Metadata.Name = app.GenerateServiceMonitorService
+	sm.Metadata.Namespace = app.GenerateServiceMonitorNamespace
+	if len(labels) > 0 {
+		sm.Metadata.Labels = labels
+	}
+	sm.Spec.Selector.MatchLabels = map[string]string{"app.kubernetes.io/name": app.GenerateServiceMonitorService}
+	sm.Spec.NamespaceSelector.MatchNames = []string{app.GenerateServiceMonitorNamespace}
+	sm.Spec.Endpoints = []serviceMonitorEndpoint{{
+		TargetPort: targetPort,
+		Path:       app.Path,
+		Interval:   model.Duration(app.GenerateServiceMonitorInterval).String(),
+	}}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(sm)
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,112 @@
+package uls
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+func TestServiceMonitor(t *testing.T) {
+	app := &App{
+		Listen:                          ":9200",
+		Path:                            "/uls/metrics",
+		GenerateServiceMonitorNamespace: "monitoring",
+		GenerateServiceMonitorService:   "uls",
+		GenerateServiceMonitorLabels:    "release=prometheus, app.kubernetes.io/part-of=licensing",
+		GenerateServiceMonitorInterval:  30 * time.Second,
+	}
+	var b bytes.Buffer
+	err := app.writeServiceMonitor(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sm unstructured.Unstructured
+	err = k8syaml.NewYAMLOrJSONDecoder(&b, 4096).Decode(&sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gvk := sm.GroupVersionKind(); gvk.Group != "monitoring.coreos.com" || gvk.Version != "v1" || gvk.Kind != "ServiceMonitor" {
+		t.Errorf("got %v, want a monitoring.coreos.com/v1 ServiceMonitor", gvk)
+	}
+	if sm.GetName() != "uls" || sm.GetNamespace() != "monitoring" {
+		t.Errorf("got ServiceMonitor %s/%s, want monitoring/uls", sm.GetNamespace(), sm.GetName())
+	}
+	for _, msg := range append(validation.IsDNS1123Subdomain(sm.GetName()), validation.IsDNS1123Label(sm.GetNamespace())...) {
+		t.Error(msg)
+	}
+	wantLabels := map[string]string{"release": "prometheus", "app.kubernetes.io/part-of": "licensing"}
+	if got := sm.GetLabels(); !reflect.DeepEqual(got, wantLabels) {
+		t.Errorf("got labels %v, want %v", got, wantLabels)
+	}
+	for name, value := range sm.GetLabels() {
+		for _, msg := range append(validation.IsQualifiedName(name), validation.IsValidLabelValue(value)...) {
+			t.Errorf("label %s=%s: %s", name, value, msg)
+		}
+	}
+
+	selector, _, err := unstructured.NestedStringMap(sm.Object, "spec", "selector", "matchLabels")
+	if err != nil || !reflect.DeepEqual(selector, map[string]string{"app.kubernetes.io/name": "uls"}) {
+		t.Errorf("got selector %v (%v), want the uls Service", selector, err)
+	}
+	namespaces, _, err := unstructured.NestedStringSlice(sm.Object, "spec", "namespaceSelector", "matchNames")
+	if err != nil || !reflect.DeepEqual(namespaces, []string{"monitoring"}) {
+		t.Errorf("got namespaces %v (%v), want monitoring", namespaces, err)
+	}
+	endpoints, _, err := unstructured.NestedSlice(sm.Object, "spec", "endpoints")
+	if err != nil || len(endpoints) != 1 {
+		t.Fatalf("got endpoints %v (%v), want one", endpoints, err)
+	}
+	want := map[string]interface{}{"targetPort": int64(9200), "path": "/uls/metrics", "interval": "30s"}
+	if !reflect.DeepEqual(endpoints[0], want) {
+		t.Errorf("got endpoint %v, want %v", endpoints[0], want)
+	}
+}
+
+func TestServiceMonitorDefaults(t *testing.T) {
+	app := &App{}
+	_, err := app.configure(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-generate-service-monitor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = app.writeServiceMonitor(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: uls-exporter
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: uls-exporter
+  namespaceSelector:
+    matchNames:
+      - default
+  endpoints:
+    - targetPort: 9101
+      path: /metrics
+      interval: 1m
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestServiceMonitorInvalidLabels(t *testing.T) {
+	app := &App{Listen: ":9101", GenerateServiceMonitorLabels: "release"}
+	err := app.writeServiceMonitor(&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `label "release" must be name=value`) {
+		t.Errorf("got error %v for a label without a value", err)
+	}
+}
@@ -0,0 +1,91 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const sseClientBuffer = 16
+
+type LeaseDelta struct {
+	Time   time.Time    `json:"time"`
+	Events []LeaseEvent `json:"events"`
+}
+
+type broadcaster struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{clients: map[chan []byte]struct{}{}}
+}
+
+func (b *broadcaster) Publish(msg []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		select {
+		case c <- msg:
+		default:
+			delete(b.clients, c)
+			close(c)
+		}
+	}
+}
+
+func (b *broadcaster) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+func (b *broadcaster) subscribe() chan []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := make(chan []byte, sseClientBuffer)
+	b.clients[c] = struct{}{}
+	return c
+}
+
+func (b *broadcaster) unsubscribe(c chan []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.clients[c]
+	if ok {
+		delete(b.clients, c)
+		close(c)
+	}
+}
+
+func (b *broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := b.subscribe()
+	defer b.unsubscribe(c)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-c:
+			if !ok {
+				return
+			}
+			_, err := fmt.Fprintf(w, "event: leases\ndata: %s\n\n", msg)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package uls
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEventsStreamsLeaseDelta(t *testing.T) {
+	const token = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	var scrape int32
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&scrape, 1) == 1 {
+			w.Write([]byte(leasesJSON()))
+			return
+		}
+		w.Write([]byte(leasesJSON(leaseJSON(1, token))))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+	srv := httptest.NewServer(e.EventsHandler())
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("got Content-Type %q, want text/event-stream", ct)
+	}
+
+	gather(t, e)
+	families := gather(t, e)
+	if v := metricValue(t, families, "uls_sse_connected_clients"); v != 1 {
+		t.Errorf("got uls_sse_connected_clients %v, want 1", v)
+	}
+
+	var data string
+	sc := bufio.NewScanner(res.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+			break
+		}
+	}
+	if data == "" {
+		t.Fatalf("no data line received: %v", sc.Err())
+	}
+	var delta LeaseDelta
+	err = json.Unmarshal([]byte(data), &delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Events) != 1 {
+		t.Fatalf("got %d events, want 1: %s", len(delta.Events), data)
+	}
+	ev := delta.Events[0]
+	if ev.Event != "created" || ev.Token != uuid.MustParse(token) || ev.FloatingLeaseID != 1 {
+		t.Errorf("got %+v, want created event for %s", ev, token)
+	}
+	if delta.Time.IsZero() || ev.Time.IsZero() {
+		t.Errorf("event time not set: %s", data)
+	}
+}
+
+func TestBroadcasterDropsSlowClients(t *testing.T) {
+	b := newBroadcaster()
+	slow := b.subscribe()
+	fast := b.subscribe()
+	for i := 0; i < sseClientBuffer; i++ {
+		b.Publish([]byte("msg"))
+		<-fast
+	}
+	if n := b.Clients(); n != 2 {
+		t.Fatalf("got %d clients with full buffer, want 2", n)
+	}
+
+	b.Publish([]byte("msg"))
+
+	if n := b.Clients(); n != 1 {
+		t.Errorf("got %d clients after overflow, want 1", n)
+	}
+	for i := 0; i < sseClientBuffer; i++ {
+		<-slow
+	}
+	if _, ok := <-slow; ok {
+		t.Error("slow client channel not closed")
+	}
+	if _, ok := <-fast; !ok {
+		t.Error("fast client dropped")
+	}
+	b.unsubscribe(fast)
+	if n := b.Clients(); n != 0 {
+		t.Errorf("got %d clients after unsubscribe, want 0", n)
+	}
+}
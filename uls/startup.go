@@ -0,0 +1,36 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startupWithin runs fn and returns its error, or an error once timeout has
+// passed if fn is still running. A timeout of 0 means no limit. fn's context
+// is cancelled at the timeout, but fn is abandoned rather than waited for
+// since a hung dependency, such as a plugin stuck in its init, may not honour
+// it. If an abandoned fn still succeeds, undo is called to release what it
+// acquired.
+func startupWithin(timeout time.Duration, fn func(context.Context) error, undo func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		go func() {
+			if err := <-done; err == nil && undo != nil {
+				undo()
+			}
+		}()
+		return fmt.Errorf("startup did not complete within %s", timeout)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package uls
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartupTimeoutExits(t *testing.T) {
+	if os.Getenv("GO_TEST_MAIN") == "1" {
+		os.Args = []string{"uls_exporter", "-listen=127.0.0.1:0", "-skip-health-scrape", "-startup-timeout=200ms",
+			"-server-tls-cert=" + os.Getenv("TEST_CERT"), "-server-tls-key=" + os.Getenv("TEST_CERT")}
+		err := (&App{}).Main()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	// Loading the certificate blocks until something writes to the FIFO,
+	// which never happens.
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	err := syscall.Mkfifo(cert, 0o600)
+	if err != nil {
+		t.Skipf("mkfifo: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^TestStartupTimeoutExits$")
+	cmd.Env = append(os.Environ(), "GO_TEST_MAIN=1", "TEST_CERT="+cert)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("exporter still running after 10s:\n%s", out)
+	}
+	if err == nil {
+		t.Fatalf("exporter exited successfully:\n%s", out)
+	}
+	if !strings.Contains(string(out), "startup did not complete within 200ms") {
+		t.Errorf("output does not report the startup timeout:\n%s", out)
+	}
+}
@@ -0,0 +1,94 @@
+package uls
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupWithinTimesOut(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	start := time.Now()
+	err := startupWithin(50*time.Millisecond, func(context.Context) error {
+		<-hang
+		return nil
+	}, nil)
+	if err == nil || !strings.Contains(err.Error(), "within 50ms") {
+		t.Fatalf("got error %v, want a startup timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("startup took %s to give up", elapsed)
+	}
+}
+
+func TestStartupWithinCancelsContext(t *testing.T) {
+	cancelled := make(chan error, 1)
+	err := startupWithin(10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return ctx.Err()
+	}, nil)
+	if err == nil {
+		t.Fatal("got nil error, want a startup timeout")
+	}
+	if got := <-cancelled; !errors.Is(got, context.DeadlineExceeded) {
+		t.Errorf("got context error %v, want deadline exceeded", got)
+	}
+}
+
+func TestStartupWithinReturnsResult(t *testing.T) {
+	want := errors.New("bad config")
+	err := startupWithin(time.Minute, func(context.Context) error {
+		return want
+	}, nil)
+	if err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+	err = startupWithin(time.Minute, func(context.Context) error {
+		return nil
+	}, nil)
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestStartupWithinNoTimeout(t *testing.T) {
+	err := startupWithin(0, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			return errors.New("context has a deadline")
+		}
+		return ctx.Err()
+	}, nil)
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestStartupWithinUndoesLateStart(t *testing.T) {
+	release := make(chan struct{})
+	undone := make(chan struct{})
+	acquired := false
+	err := startupWithin(10*time.Millisecond, func(ctx context.Context) error {
+		<-release
+		acquired = true
+		return nil
+	}, func() {
+		if !acquired {
+			t.Error("undo called before fn completed")
+		}
+		close(undone)
+	})
+	if err == nil {
+		t.Fatal("got nil error, want a startup timeout")
+	}
+	close(release)
+	select {
+	case <-undone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("undo not called after a late start")
+	}
+}
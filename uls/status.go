@@ -0,0 +1,23 @@
+package uls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseStatusCodes parses a comma-separated list of HTTP status codes.
+func parseStatusCodes(s string) (map[int]bool, error) {
+	codes := map[int]bool{}
+	for _, f := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, fmt.Errorf("success status code %q: %w", f, err)
+		}
+		if code < 100 || code > 599 {
+			return nil, fmt.Errorf("success status code %d must be between 100 and 599", code)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
@@ -0,0 +1,38 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSuccessStatusCodes(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, nLeasesJSON(2))
+	})
+
+	e := newTestExporter(t, uls.URL, ExporterOptions{SuccessStatusCodes: "200, 201"})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+
+	e = newTestExporter(t, uls.URL, ExporterOptions{})
+	_, err = e.GetLeases()
+	if err == nil {
+		t.Error("201 accepted with the default success status codes")
+	}
+}
+
+func TestSuccessStatusCodesValidation(t *testing.T) {
+	for _, s := range []string{"99", "600", "200,ok", "200,"} {
+		_, err := NewULSExporter("http://localhost", ExporterOptions{SuccessStatusCodes: s})
+		if err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package uls
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// countingReader counts the bytes read from r and keeps the first error
+// other than io.EOF, to tell read errors apart from parse errors.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// decodeLeases decodes the leases in a response body as it is read,
+// instead of reading it all into memory first. The body is JSON, or a
+// multipart body with JSON parts, and the JSON is a stream of leases and
+// arrays of leases, such as a single array.
+func (e *ULSExporter) decodeLeases(res *http.Response) ([]ULSLease, error) {
+	body, err := decompressedBody(res)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	r := &countingReader{r: io.LimitReader(body, e.maxResponseSize+1)}
+	leases, err := decodeLeaseParts(r, res.Header.Get("Content-Type"), e.fields)
+	e.responseBytes.Observe(float64(r.n))
+	switch {
+	case r.n > e.maxResponseSize:
+		return nil, e.tooLarge()
+	case r.err != nil:
+		return nil, &ULSNetworkError{Err: r.err}
+	case err != nil:
+		return nil, newParseError(err)
+	}
+	return leases, nil
+}
+
+func decodeLeaseParts(r io.Reader, contentType string, fields fieldMap) ([]ULSLease, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return decodeLeaseStream(r, nil, fields)
+	}
+	mr := multipart.NewReader(r, params["boundary"])
+	var leases []ULSLease
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return leases, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		leases, err = decodeLeaseStream(part, leases, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decodeLeaseStream appends the leases in the JSON stream r, with fields
+// mapped, to leases. The stream must not be empty.
+func decodeLeaseStream(r io.Reader, leases []ULSLease, fields fieldMap) ([]ULSLease, error) {
+	dec := json.NewDecoder(r)
+	values := 0
+	for ; dec.More(); values++ {
+		next, err := peekValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		if next != '[' {
+			var lease ULSLease
+			err := dec.Decode(fields.target(&lease))
+			if err != nil {
+				return nil, err
+			}
+			leases = append(leases, lease)
+			continue
+		}
+		_, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var lease ULSLease
+			err := dec.Decode(fields.target(&lease))
+			if err != nil {
+				return nil, err
+			}
+			leases = append(leases, lease)
+		}
+		_, err = dec.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err := dec.Token()
+	switch {
+	case err == io.EOF && values == 0:
+		return nil, io.ErrUnexpectedEOF
+	case err == io.EOF:
+		return leases, nil
+	case err == nil:
+		return nil, errors.New("unexpected end of array or object")
+	}
+	return nil, err
+}
+
+// peekValue returns the first byte of the next top-level value of dec,
+// which More has buffered.
+func peekValue(dec *json.Decoder) (byte, error) {
+	r := dec.Buffered()
+	var c [1]byte
+	for {
+		_, err := r.Read(c[:])
+		if err != nil {
+			return 0, err
+		}
+		switch c[0] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return c[0], nil
+	}
+}
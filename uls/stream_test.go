@@ -0,0 +1,153 @@
+package uls
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testLeaseJSON(i int) string {
+	return leaseJSON(i, fmt.Sprintf("00000000-0000-0000-0000-%012d", i))
+}
+
+func checkLeaseIDs(t *testing.T, leases []ULSLease, n int) {
+	t.Helper()
+	if len(leases) != n {
+		t.Fatalf("got %d leases, want %d", len(leases), n)
+	}
+	for i, l := range leases {
+		if l.FloatingLeaseID != i {
+			t.Errorf("lease %d has ID %d", i, l.FloatingLeaseID)
+		}
+	}
+}
+
+func TestStreamResponseChunked(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Flushing before the handler returns makes the response chunked.
+		fmt.Fprint(w, "[")
+		for i := 0; i < 50; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprint(w, testLeaseJSON(i))
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "]")
+	})
+	res, err := http.Get(uls.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	if len(res.TransferEncoding) != 1 || res.TransferEncoding[0] != "chunked" {
+		t.Fatalf("got transfer encoding %v, want chunked", res.TransferEncoding)
+	}
+
+	e := newTestExporter(t, uls.URL, ExporterOptions{StreamResponse: true})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 50)
+}
+
+func TestStreamResponseJSONStream(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, testLeaseJSON(0))
+		fmt.Fprintln(w, leasesJSON(testLeaseJSON(1), testLeaseJSON(2)))
+		fmt.Fprintln(w, "[]")
+		fmt.Fprint(w, testLeaseJSON(3), testLeaseJSON(4))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{StreamResponse: true})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 5)
+}
+
+func TestStreamResponseMultipart(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+		for _, leases := range [][]string{
+			{testLeaseJSON(0), testLeaseJSON(1)},
+			{testLeaseJSON(2)},
+			{testLeaseJSON(3), testLeaseJSON(4), testLeaseJSON(5)},
+		} {
+			part, err := mw.CreatePart(map[string][]string{"Content-Type": {"application/json"}})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fmt.Fprint(part, leasesJSON(leases...))
+			w.(http.Flusher).Flush()
+		}
+		mw.Close()
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{StreamResponse: true})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 6)
+}
+
+func TestStreamResponseGzip(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		fmt.Fprint(zw, nLeasesJSON(20))
+		zw.Close()
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{StreamResponse: true})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 20)
+}
+
+func TestStreamResponseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		body  string
+		check func(error) bool
+	}{
+		{"empty", "", isParseError},
+		{"truncated", "[" + testLeaseJSON(0) + ",", isParseError},
+		{"syntax", "[" + testLeaseJSON(0) + "}", isParseError},
+		{"trailing", testLeaseJSON(0) + "]", isParseError},
+		{"type", `[{"floatingLeaseId":"one"}]`, isParseError},
+		{"too large", nLeasesJSON(100), func(err error) bool {
+			return strings.Contains(err.Error(), "exceeds 1024 bytes")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.body)
+			})
+			e := newTestExporter(t, uls.URL, ExporterOptions{StreamResponse: true, MaxResponseSize: 1024})
+			_, err := e.GetLeases()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tc.check(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func isParseError(err error) bool {
+	var parse *ULSParseError
+	return errors.As(err, &parse)
+}
@@ -0,0 +1,83 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultMaxConcurrentFetches = 10
+
+// parseTargets parses a comma-separated list of ULS base URIs.
+func parseTargets(s string) []string {
+	var targets []string
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// newTargets creates an exporter for each of targets with opts, except for
+// the WAL and the rate limit journal, which only the exporter for -uri
+// keeps.
+func newTargets(targets []string, opts ExporterOptions) ([]*ULSExporter, error) {
+	opts.Targets = nil
+	opts.WALDir = ""
+	opts.RateLimitJournal = ""
+	var exporters []*ULSExporter
+	for _, t := range targets {
+		e, err := NewULSExporter(t, opts)
+		if err != nil {
+			for _, e := range exporters {
+				e.Close()
+			}
+			return nil, fmt.Errorf("target %s: %w", t, err)
+		}
+		exporters = append(exporters, e)
+	}
+	return exporters, nil
+}
+
+// targetsGatherer gathers the metrics of several exporters, each labelled
+// with its target. Leases are fetched from all targets in parallel, at most
+// max at a time, before any metrics are returned, and a failing target
+// only sets its own uls_up to 0.
+func targetsGatherer(ctx context.Context, exporters []*ULSExporter, max int) (prometheus.Gatherer, error) {
+	regs := make([]*prometheus.Registry, len(exporters))
+	for i, e := range exporters {
+		regs[i] = prometheus.NewRegistry()
+		err := prometheus.WrapRegistererWith(prometheus.Labels{"target": e.target}, regs[i]).Register(scrapeCollector{ULSExporter: e, ctx: ctx})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families := make([][]*dto.MetricFamily, len(regs))
+		errs := make([]error, len(regs))
+		var g errgroup.Group
+		g.SetLimit(max)
+		for i := range regs {
+			i := i
+			g.Go(func() error {
+				families[i], errs[i] = regs[i].Gather()
+				return nil
+			})
+		}
+		g.Wait()
+		var gatherers prometheus.Gatherers
+		for i := range regs {
+			mfs, err := families[i], errs[i]
+			gatherers = append(gatherers, prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return mfs, err
+			}))
+		}
+		return gatherers.Gather()
+	}), nil
+}
@@ -0,0 +1,115 @@
+package uls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gatherTargets(t *testing.T, e *ULSExporter) map[string]*dto.MetricFamily {
+	t.Helper()
+	g, err := e.Gatherer(context.Background(), prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		families[mf.GetName()] = mf
+	}
+	return families
+}
+
+func TestTargets(t *testing.T) {
+	var urls []string
+	want := map[string]float64{}
+	for i := 0; i < 5; i++ {
+		fail := i%2 == 1
+		uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				http.Error(w, "unavailable", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, nLeasesJSON(3))
+		})
+		urls = append(urls, uls.URL)
+		want[uls.URL] = 1
+		if fail {
+			want[uls.URL] = 0
+		}
+	}
+	e := newTestExporter(t, urls[0], ExporterOptions{Targets: urls[1:]})
+
+	families := gatherTargets(t, e)
+	if got := labeledValues(t, families, "uls_up", "target"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got uls_up %v, want %v", got, want)
+	}
+	leases := labeledValues(t, families, "uls_leases", "target")
+	if len(leases) != 3 {
+		t.Errorf("got uls_leases for %d targets, want the 3 that are up: %v", len(leases), leases)
+	}
+	for target, n := range leases {
+		if n != 3 {
+			t.Errorf("target %s: got %v leases, want 3", target, n)
+		}
+	}
+}
+
+func TestTargetsMaxConcurrentFetches(t *testing.T) {
+	var active, maxActive int64
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	var urls []string
+	for i := 0; i < 5; i++ {
+		uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt64(&active, 1)
+			for {
+				m := atomic.LoadInt64(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt64(&maxActive, m, n) {
+					break
+				}
+			}
+			arrived <- struct{}{}
+			<-release
+			atomic.AddInt64(&active, -1)
+			fmt.Fprint(w, "[]")
+		})
+		urls = append(urls, uls.URL)
+	}
+	e := newTestExporter(t, urls[0], ExporterOptions{Targets: urls[1:], MaxConcurrentFetches: 2})
+
+	go func() {
+		for i := 0; i < len(urls); i++ {
+			<-arrived
+			release <- struct{}{}
+		}
+	}()
+	families := gatherTargets(t, e)
+	if got := labeledValues(t, families, "uls_up", "target"); len(got) != 5 {
+		t.Errorf("got uls_up for %d targets, want 5", len(got))
+	}
+	if m := atomic.LoadInt64(&maxActive); m > 2 {
+		t.Errorf("%d targets were fetched at the same time, want at most 2", m)
+	}
+}
+
+func TestTargetsValidate(t *testing.T) {
+	app := App{Listen: ":9101", Path: "/metrics", URI: "http://localhost:8080", Targets: "http://uls-a:8080, uls-b"}
+	err := app.validate()
+	if err == nil {
+		t.Fatal("expected an error for a relative target")
+	}
+	if want := `ULS_TARGETS "uls-b"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not mention %s", err, want)
+	}
+}
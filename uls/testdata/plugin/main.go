@@ -0,0 +1,30 @@
+// Command plugin is a collector plugin for the plugin tests, built with
+// go build -buildmode=plugin.
+package main
+
+import (
+	"uls_exporter/uls"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leasesDesc = prometheus.NewDesc("uls_test_plugin_leases", "Leases seen by the test plugin", nil, nil)
+
+type testPlugin struct{}
+
+func (testPlugin) Name() string {
+	return "test"
+}
+
+func (testPlugin) Describe(ch chan<- *prometheus.Desc) {
+	ch <- leasesDesc
+}
+
+func (testPlugin) Collect(leases []uls.ULSLease, ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(leasesDesc, prometheus.GaugeValue, float64(len(leases)))
+}
+
+// Plugin is the symbol the exporter loads.
+var Plugin uls.Plugin = testPlugin{}
+
+func main() {}
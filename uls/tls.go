@@ -0,0 +1,133 @@
+package uls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	now      func() time.Time
+	errors   uint64
+
+	mu     sync.Mutex
+	cert   *tls.Certificate
+	loaded time.Time
+}
+
+func newCertReloader(certFile string, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, now: time.Now}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.cert, r.loaded = &cert, r.now()
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if now.Sub(r.loaded) < r.interval {
+		return r.cert, nil
+	}
+	r.loaded = now
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		atomic.AddUint64(&r.errors, 1)
+		log.Printf("reloading TLS certificate: %v", err)
+		return r.cert, nil
+	}
+	r.cert = &cert
+	return r.cert, nil
+}
+
+func (r *certReloader) Errors() uint64 {
+	return atomic.LoadUint64(&r.errors)
+}
+
+func (r *certReloader) Collector() prometheus.Collector {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tls_cert_reload_errors_total",
+		Help:      "Number of failed attempts to reload the server TLS certificate",
+	}, func() float64 {
+		return float64(r.Errors())
+	})
+}
+
+func serverTLSConfig(clientCA string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCA == "" {
+		return config, nil
+	}
+	b, err := ioutil.ReadFile(clientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s: no certificates found", clientCA)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+func requireClientCert(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (app *App) server(handler http.Handler) (*http.Server, error) {
+	server := &http.Server{Addr: app.Listen, Handler: handler}
+	if app.ServerTLSCert == "" && app.ServerTLSKey == "" {
+		if app.ServerTLSClientCA != "" {
+			return nil, errors.New("-server-tls-client-ca requires -server-tls-cert and -server-tls-key")
+		}
+		return server, nil
+	}
+	if app.ServerTLSCert == "" || app.ServerTLSKey == "" {
+		return nil, errors.New("-server-tls-cert and -server-tls-key must be set together")
+	}
+	config, err := serverTLSConfig(app.ServerTLSClientCA)
+	if err != nil {
+		return nil, err
+	}
+	app.certs, err = newCertReloader(app.ServerTLSCert, app.ServerTLSKey, app.TLSReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	config.GetCertificate = app.certs.GetCertificate
+	server.TLSConfig = config
+	if app.ServerTLSClientCA != "" {
+		server.Handler = requireClientCert(handler)
+	}
+	return server, nil
+}
+
+func (app *App) serve(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
@@ -0,0 +1,230 @@
+package uls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+var testSerial int64
+
+func newTestCert(t *testing.T, dir string, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	writePEM(t, c.certFile, "CERTIFICATE", der)
+	writePEM(t, c.keyFile, "EC PRIVATE KEY", keyDER)
+	return c
+}
+
+func writePEM(t *testing.T, path string, typ string, der []byte) {
+	t.Helper()
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+func startTLSApp(t *testing.T, app *App, handler http.Handler) string {
+	t.Helper()
+	server, err := app.server(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(ln, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+func TestServerRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true)
+	serverCert := newTestCert(t, dir, "localhost", ca, false)
+	client := newTestCert(t, dir, "prometheus", ca, false)
+	rogueCA := newTestCert(t, dir, "rogue-ca", nil, true)
+	rogue := newTestCert(t, dir, "rogue", rogueCA, false)
+
+	app := &App{
+		ServerTLSCert:     serverCert.certFile,
+		ServerTLSKey:      serverCert.keyFile,
+		ServerTLSClientCA: ca.certFile,
+	}
+	url := startTLSApp(t, app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		config := &tls.Config{RootCAs: ca.pool()}
+		if len(certs) > 0 {
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certs[0], nil
+			}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer c.CloseIdleConnections()
+		return c.Get(url)
+	}
+
+	res, err := get(client.tlsCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("valid certificate: got status %d, want 200", res.StatusCode)
+	}
+
+	res, err = get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("no certificate: got status %d, want 403", res.StatusCode)
+	}
+
+	res, err = get(rogue.tlsCertificate(t))
+	if err == nil {
+		res.Body.Close()
+		t.Errorf("invalid certificate: got status %d, want handshake failure", res.StatusCode)
+	}
+}
+
+func TestServerTLSFlagValidation(t *testing.T) {
+	for _, app := range []*App{
+		{ServerTLSCert: "server.crt"},
+		{ServerTLSKey: "server.key"},
+		{ServerTLSClientCA: "ca.crt"},
+	} {
+		_, err := app.server(http.NotFoundHandler())
+		if err == nil {
+			t.Errorf("%+v: got no error", app)
+		}
+	}
+}
+
+func TestServerReloadsRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true)
+	first := newTestCert(t, dir, "localhost", ca, false)
+
+	app := &App{
+		ServerTLSCert:     first.certFile,
+		ServerTLSKey:      first.keyFile,
+		TLSReloadInterval: 5 * time.Minute,
+	}
+	url := startTLSApp(t, app, http.NotFoundHandler())
+	now := time.Now()
+	app.certs.now = func() time.Time { return now }
+
+	serial := func() int64 {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: ca.pool()},
+			DisableKeepAlives: true,
+		}}
+		res, err := c.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if got := serial(); got != first.cert.SerialNumber.Int64() {
+		t.Fatalf("got serial %d, want %d", got, first.cert.SerialNumber.Int64())
+	}
+	second := newTestCert(t, dir, "localhost", ca, false)
+	if got := serial(); got != first.cert.SerialNumber.Int64() {
+		t.Errorf("within reload interval: got serial %d, want cached %d", got, first.cert.SerialNumber.Int64())
+	}
+
+	now = now.Add(5 * time.Minute)
+	if got := serial(); got != second.cert.SerialNumber.Int64() {
+		t.Errorf("after reload interval: got serial %d, want %d", got, second.cert.SerialNumber.Int64())
+	}
+
+	os.Remove(second.keyFile)
+	now = now.Add(5 * time.Minute)
+	if got := serial(); got != second.cert.SerialNumber.Int64() {
+		t.Errorf("after failed reload: got serial %d, want last good %d", got, second.cert.SerialNumber.Int64())
+	}
+	if n := app.certs.Errors(); n != 1 {
+		t.Errorf("got %d reload errors, want 1", n)
+	}
+}
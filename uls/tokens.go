@@ -0,0 +1,48 @@
+package uls
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+type tokenHistory struct {
+	max int
+
+	mu     sync.Mutex
+	seen   map[uuid.UUID]struct{}
+	order  []uuid.UUID
+	unique uint64
+}
+
+func newTokenHistory(max int) *tokenHistory {
+	return &tokenHistory{max: max, seen: map[uuid.UUID]struct{}{}}
+}
+
+// Observe records the lease tokens, forgetting the oldest tokens once more
+// than max are tracked.
+func (h *tokenHistory) Observe(leases []ULSLease) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, l := range leases {
+		if _, ok := h.seen[l.Token]; ok {
+			continue
+		}
+		h.seen[l.Token] = struct{}{}
+		h.unique++
+		if h.max <= 0 {
+			continue
+		}
+		h.order = append(h.order, l.Token)
+		if len(h.order) > h.max {
+			delete(h.seen, h.order[0])
+			h.order = h.order[1:]
+		}
+	}
+}
+
+func (h *tokenHistory) Unique() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.unique
+}
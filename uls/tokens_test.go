@@ -0,0 +1,52 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func tokenString(n int) string {
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+}
+
+func tokenJSON(n int) string {
+	return leaseJSON(n, tokenString(n))
+}
+
+func TestUniqueTokensLifetime(t *testing.T) {
+	responses := []string{
+		leasesJSON(tokenJSON(1), tokenJSON(2)),
+		leasesJSON(tokenJSON(2), tokenJSON(3)),
+		leasesJSON(tokenJSON(1)),
+		leasesJSON(tokenJSON(4), tokenJSON(5)),
+	}
+	var scrape int32
+	s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, responses[atomic.AddInt32(&scrape, 1)-1])
+	})
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	for i, want := range []float64{2, 3, 3, 5} {
+		got := metricValue(t, gather(t, e), "uls_unique_tokens_lifetime_total")
+		if got != want {
+			t.Errorf("scrape %d: uls_unique_tokens_lifetime_total = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestTokenHistoryBounded(t *testing.T) {
+	h := newTokenHistory(2)
+	for _, n := range []int{1, 2, 3, 1} {
+		h.Observe([]ULSLease{{Token: uuid.MustParse(tokenString(n))}})
+	}
+	if got := h.Unique(); got != 4 {
+		t.Errorf("Unique() = %d, want 4 after token 1 was forgotten", got)
+	}
+	if len(h.seen) != 2 {
+		t.Errorf("tracking %d tokens, want 2", len(h.seen))
+	}
+}
@@ -0,0 +1,122 @@
+package uls
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+const (
+	defaultKeepAliveInterval = 30 * time.Second
+	defaultDialTimeout       = 5 * time.Second
+	defaultIdleConnTimeout   = 90 * time.Second
+)
+
+// UnixSocketDialer connects to the Unix domain socket at Path whatever the
+// address asked for, so that HTTP requests for any host go to the socket.
+type UnixSocketDialer struct {
+	Path   string
+	Dialer *net.Dialer
+}
+
+func (d *UnixSocketDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.Dialer.DialContext(ctx, "unix", d.Path)
+}
+
+func newTransport(opts ExporterOptions) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DisableCompression = false
+	keepAlive := opts.KeepAliveInterval
+	if keepAlive == 0 {
+		keepAlive = defaultKeepAliveInterval
+	}
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	d := &net.Dialer{Timeout: dialTimeout, KeepAlive: keepAlive}
+	t.DialContext = d.DialContext
+	// Idle connections are closed before network equipment that discards
+	// quiet connections does it silently.
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	if t.IdleConnTimeout == 0 {
+		t.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if opts.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.ProxyUsername != "" || opts.ProxyPassword != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(opts.ProxyUsername + ":" + opts.ProxyPassword))
+		t.ProxyConnectHeader = http.Header{"Proxy-Authorization": {"Basic " + auth}}
+	}
+	if opts.UnixSocket != "" {
+		// Requests still use the host in the base URL, but every connection
+		// goes to the socket.
+		t.Proxy = nil
+		t.DialContext = (&UnixSocketDialer{Path: opts.UnixSocket, Dialer: d}).DialContext
+	}
+	t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, ServerName: opts.TLSServerName}
+	if opts.MinTLSVersion != "" {
+		v, ok := tlsVersions[opts.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q, want 1.0, 1.1, 1.2 or 1.3", opts.MinTLSVersion)
+		}
+		t.TLSClientConfig.MinVersion = v
+	}
+	if opts.CipherSuites != "" {
+		suites, err := parseCipherSuites(opts.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.CipherSuites = suites
+	}
+	return t, nil
+}
+
+func parseCipherSuites(s string) ([]uint16, error) {
+	ids := map[string]uint16{}
+	for _, c := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids[c.Name] = c.ID
+	}
+	var suites []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+const defaultMaxRedirects = 5
+
+// checkRedirect stops following redirects after max of them, or at the first
+// one if disabled.
+func checkRedirect(max int, disabled bool) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if disabled {
+			return fmt.Errorf("redirected to %s, but redirects are disabled", req.URL)
+		}
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects, last to %s", max, req.URL)
+		}
+		return nil
+	}
+}
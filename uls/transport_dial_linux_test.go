@@ -0,0 +1,122 @@
+//go:build linux
+// +build linux
+
+package uls
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// slowListener delays Accept until release is closed.
+type slowListener struct {
+	net.Listener
+	release chan struct{}
+}
+
+func (l *slowListener) Accept() (net.Conn, error) {
+	<-l.release
+	return l.Listener.Accept()
+}
+
+// listenBacklog listens on 127.0.0.1 with the smallest accept queue the
+// kernel allows, so that connections not accepted soon fill it up.
+func listenBacklog(t *testing.T) net.Listener {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	err = syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syscall.Listen(fd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.FileListener(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestDialTimeout(t *testing.T) {
+	captureLog(t)
+	sl := &slowListener{Listener: listenBacklog(t), release: make(chan struct{})}
+	accepted := make(chan struct{}, 16)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, nLeasesJSON(1))
+		}),
+		ConnState: func(c net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				accepted <- struct{}{}
+			}
+		},
+	}
+	go srv.Serve(sl)
+	var queued []net.Conn
+	released := false
+	t.Cleanup(func() {
+		if !released {
+			close(sl.release)
+		}
+		srv.Close()
+		for _, c := range queued {
+			c.Close()
+		}
+	})
+
+	// Fill the accept queue, after which the kernel drops new connection
+	// attempts instead of completing them.
+	addr := sl.Addr().String()
+	full := false
+	for i := 0; i < 16 && !full; i++ {
+		c, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			full = true
+		case err != nil:
+			t.Fatal(err)
+		default:
+			queued = append(queued, c)
+		}
+	}
+	if !full {
+		t.Skip("the accept queue did not fill up")
+	}
+
+	e := newTestExporter(t, "http://"+addr, ExporterOptions{ScrapeTimeout: time.Minute, DialTimeout: 50 * time.Millisecond})
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "dial tcp") || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Fatalf("got error %v, want a dial timeout", err)
+	}
+
+	// Once the server has emptied the accept queue, the exporter connects
+	// again.
+	close(sl.release)
+	released = true
+	for range queued {
+		<-accepted
+	}
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 1 {
+		t.Errorf("got %d leases, want 1", len(leases))
+	}
+}
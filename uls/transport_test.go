@@ -0,0 +1,440 @@
+package uls
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newConnectProxy(t *testing.T, username, password string) *url.URL {
+	t.Helper()
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func getThroughProxy(t *testing.T, proxy *url.URL, opts ExporterOptions) (*http.Response, error) {
+	t.Helper()
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	}))
+	t.Cleanup(target.Close)
+	transport, err := newTransport(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.Proxy = http.ProxyURL(proxy)
+	transport.TLSClientConfig.RootCAs = target.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	t.Cleanup(transport.CloseIdleConnections)
+	return (&http.Client{Transport: transport}).Get(target.URL + "/v1/admin/lease")
+}
+
+func TestProxyAuthorization(t *testing.T) {
+	proxy := newConnectProxy(t, "user", "secret")
+
+	res, err := getThroughProxy(t, proxy, ExporterOptions{ProxyUsername: "user", ProxyPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got %d through authenticated proxy, want 200", res.StatusCode)
+	}
+}
+
+func TestProxyAuthorizationMissing(t *testing.T) {
+	proxy := newConnectProxy(t, "user", "secret")
+
+	res, err := getThroughProxy(t, proxy, ExporterOptions{})
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected the proxy to reject the CONNECT without credentials")
+	}
+}
+
+func getWithTLS(t *testing.T, serverTLS *tls.Config, opts ExporterOptions) error {
+	t.Helper()
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	}))
+	s.TLS = serverTLS
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	transport, err := newTransport(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.TLSClientConfig.RootCAs = s.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	t.Cleanup(transport.CloseIdleConnections)
+	res, err := (&http.Client{Transport: transport}).Get(s.URL)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	tls12 := &tls.Config{MaxVersion: tls.VersionTLS12}
+	tls13 := &tls.Config{MinVersion: tls.VersionTLS13}
+
+	if err := getWithTLS(t, tls12, ExporterOptions{MinTLSVersion: "1.3"}); err == nil {
+		t.Error("TLS 1.2 server accepted a client requiring TLS 1.3")
+	}
+	if err := getWithTLS(t, tls12, ExporterOptions{MinTLSVersion: "1.2"}); err != nil {
+		t.Errorf("TLS 1.2 server with minimum 1.2: %s", err)
+	}
+	if err := getWithTLS(t, tls13, ExporterOptions{MinTLSVersion: "1.2"}); err != nil {
+		t.Errorf("TLS 1.3 only server with minimum 1.2: %s", err)
+	}
+	if err := getWithTLS(t, tls13, ExporterOptions{MinTLSVersion: "1.2", CipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}); err != nil {
+		t.Errorf("TLS 1.3 only server with TLS 1.2 cipher suites: %s", err)
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil, true)
+	cert := newTestCert(t, dir, "uls.internal", ca, false)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(1))
+	}))
+	s.TLS = &tls.Config{Certificates: []tls.Certificate{cert.tlsCertificate(t)}}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	// localhost is not a name in the certificate.
+	u := fmt.Sprintf("https://localhost:%d", s.Listener.Addr().(*net.TCPAddr).Port)
+
+	get := func(opts ExporterOptions) error {
+		transport, err := newTransport(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport.TLSClientConfig.RootCAs = ca.pool()
+		t.Cleanup(transport.CloseIdleConnections)
+		res, err := (&http.Client{Transport: transport}).Get(u)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	}
+	if err := get(ExporterOptions{}); err == nil {
+		t.Error("certificate for uls.internal accepted for localhost")
+	}
+	if err := get(ExporterOptions{TLSServerName: "uls.internal"}); err != nil {
+		t.Errorf("with -tls-server-name uls.internal: %s", err)
+	}
+	if err := get(ExporterOptions{TLSServerName: "other.internal"}); err == nil {
+		t.Error("certificate for uls.internal accepted for other.internal")
+	}
+}
+
+func TestTLSOptionErrors(t *testing.T) {
+	for _, opts := range []ExporterOptions{
+		{MinTLSVersion: "1.4"},
+		{MinTLSVersion: "tls1.2"},
+		{CipherSuites: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,NOT_A_SUITE"},
+	} {
+		_, err := NewULSExporter("http://localhost:8080", opts)
+		if err == nil {
+			t.Errorf("%+v: expected an error", opts)
+		}
+	}
+}
+
+// newUnixSocketServer serves handler on a Unix socket and returns its path.
+func newUnixSocketServer(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	// Socket paths are limited to around 100 bytes, which t.TempDir can exceed.
+	dir, err := os.MkdirTemp("", "uls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "uls.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unsupported: %s", err)
+	}
+	uls := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	uls.Listener.Close()
+	uls.Listener = l
+	uls.Start()
+	t.Cleanup(uls.Close)
+	return socket
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := newUnixSocketServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	e := newTestExporter(t, "http://localhost", ExporterOptions{UnixSocket: socket})
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 3 {
+		t.Errorf("got %d leases, want 3", len(leases))
+	}
+}
+
+func TestUnixSocketURL(t *testing.T) {
+	var host atomic.Value
+	socket := newUnixSocketServer(t, func(w http.ResponseWriter, r *http.Request) {
+		host.Store(r.Host)
+		fmt.Fprint(w, nLeasesJSON(3))
+	})
+	e := newTestExporter(t, "unix://"+socket, ExporterOptions{})
+	if e.socketPath != socket {
+		t.Errorf("socket path is %q, want %q", e.socketPath, socket)
+	}
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaseIDs(t, leases, 3)
+	if got := host.Load(); got != "localhost" {
+		t.Errorf("got Host %v, want localhost", got)
+	}
+
+	_, err = NewULSExporter("unix://"+socket, ExporterOptions{UnixSocket: socket})
+	if err == nil {
+		t.Error("expected an error for a unix:// URL with a Unix socket option")
+	}
+}
+
+func TestIdleConnTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		opts ExporterOptions
+		want time.Duration
+	}{
+		{ExporterOptions{}, 90 * time.Second},
+		{ExporterOptions{IdleConnTimeout: 42 * time.Second}, 42 * time.Second},
+		// The keepalive interval no longer sets the idle timeout.
+		{ExporterOptions{KeepAliveInterval: 42 * time.Second}, 90 * time.Second},
+	} {
+		transport, err := newTransport(tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if transport.IdleConnTimeout != tc.want {
+			t.Errorf("%+v: IdleConnTimeout = %s, want %s", tc.opts, transport.IdleConnTimeout, tc.want)
+		}
+	}
+}
+
+func TestReconnectAfterIdleTimeout(t *testing.T) {
+	var conns int32
+	closed := make(chan struct{}, 2)
+	uls := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, nLeasesJSON(2))
+	}))
+	uls.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			atomic.AddInt32(&conns, 1)
+		case http.StateClosed:
+			closed <- struct{}{}
+		}
+	}
+	uls.Start()
+	t.Cleanup(uls.Close)
+	e := newTestExporter(t, uls.URL, ExporterOptions{IdleConnTimeout: 10 * time.Millisecond})
+
+	_, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The exporter closes the idle connection after the idle timeout.
+	<-closed
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatalf("request after the idle timeout: %s", err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+	if got := atomic.LoadInt32(&conns); got != 2 {
+		t.Errorf("server saw %d connections, want 2", got)
+	}
+}
+
+func TestReconnectAfterReset(t *testing.T) {
+	var conns int32
+	uls := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, nLeasesJSON(2))
+	}))
+	uls.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	uls.Start()
+	t.Cleanup(uls.Close)
+	e := newTestExporter(t, uls.URL, ExporterOptions{})
+
+	_, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Drop the idle keep-alive connection, as a firewall timing it out would.
+	uls.CloseClientConnections()
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatalf("request after the connection reset: %s", err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+	if got := atomic.LoadInt32(&conns); got != 2 {
+		t.Errorf("server saw %d connections, want 2", got)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	uls := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(uls.Close)
+	t.Cleanup(func() { close(release) })
+	e := newTestExporter(t, uls.URL, ExporterOptions{ScrapeTimeout: time.Minute, ResponseHeaderTimeout: 50 * time.Millisecond})
+
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("got error %v, want a response header timeout", err)
+	}
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// A listener that accepts connections but never answers the ClientHello.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			conns <- c
+		}
+		close(conns)
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		for c := range conns {
+			c.Close()
+		}
+	})
+	e := newTestExporter(t, "https://"+l.Addr().String(), ExporterOptions{ScrapeTimeout: time.Minute, TLSHandshakeTimeout: 50 * time.Millisecond})
+
+	_, err = e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake timeout") {
+		t.Fatalf("got error %v, want a TLS handshake timeout", err)
+	}
+}
+
+func redirectingServer(t *testing.T) *countingServer {
+	t.Helper()
+	return newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/admin/lease":
+			http.Redirect(w, r, "/v2/leases", http.StatusFound)
+		case "/v2/leases":
+			fmt.Fprint(w, nLeasesJSON(2))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	})
+}
+
+func TestRedirectFollowed(t *testing.T) {
+	s := redirectingServer(t)
+	e := newTestExporter(t, s.URL, ExporterOptions{})
+
+	leases, err := e.GetLeases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 2 {
+		t.Errorf("got %d leases, want 2", len(leases))
+	}
+}
+
+func TestRedirectsDisabled(t *testing.T) {
+	s := redirectingServer(t)
+	e := newTestExporter(t, s.URL, ExporterOptions{DisableRedirects: true})
+
+	_, err := e.GetLeases()
+	if err == nil || !strings.Contains(err.Error(), "redirects are disabled") {
+		t.Fatalf("got error %v, want redirects disabled", err)
+	}
+	if s.Requests() != 1 {
+		t.Errorf("got %d requests, want 1", s.Requests())
+	}
+}
+
+func TestMaxRedirects(t *testing.T) {
+	s := redirectingServer(t)
+	e := newTestExporter(t, s.URL, ExporterOptions{MaxRedirects: 2})
+
+	res, err := e.client.Get(s.URL + "/loop")
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("followed a redirect loop")
+	}
+	if !strings.Contains(err.Error(), "stopped after 2 redirects") {
+		t.Errorf("got error %v, want the redirect limit", err)
+	}
+	if s.Requests() != 3 {
+		t.Errorf("got %d requests, want 3", s.Requests())
+	}
+}
@@ -0,0 +1,50 @@
+package uls
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		option, want string
+	}{
+		{"", "uls_exporter/dev"},
+		{"acme-monitoring/1.0", "acme-monitoring/1.0"},
+	} {
+		var (
+			mu     sync.Mutex
+			agents = map[string]string{}
+		)
+		s := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			agents[r.URL.Path] = r.UserAgent()
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/v1/admin/lease":
+				fmt.Fprint(w, nLeasesJSON(1))
+			case "/v1/health":
+				fmt.Fprint(w, `{}`)
+			}
+		})
+		e := newTestExporter(t, s.URL, ExporterOptions{UserAgent: tc.option})
+
+		_, err := e.GetLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = e.GetHealth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		for _, path := range []string{"/v1/admin/lease", "/v1/health"} {
+			if agents[path] != tc.want {
+				t.Errorf("UserAgent %q: %s got User-Agent %q, want %q", tc.option, path, agents[path], tc.want)
+			}
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,50 @@
+package uls
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// validate checks the listen address, metrics path, ULS URIs and cron
+// interval, reporting every invalid value by the environment variable that
+// sets it.
+func (app *App) validate() error {
+	var problems []string
+	for _, uri := range append([]string{app.URI}, parseTargets(app.Targets)...) {
+		env := "ULS_URI"
+		if uri != app.URI {
+			env = "ULS_TARGETS"
+		}
+		u, err := url.Parse(uri)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s %q: %s", env, uri, err))
+		case u.Scheme == "unix":
+			if u.Host != "" || u.Path == "" {
+				problems = append(problems, fmt.Sprintf("%s %q: must be unix:// followed by an absolute socket path", env, uri))
+			}
+		case !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			problems = append(problems, fmt.Sprintf("%s %q: must be an absolute http or https URL or a unix:// socket path", env, uri))
+		}
+	}
+	_, port, err := net.SplitHostPort(app.Listen)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("ULS_LISTEN %q: %s", app.Listen, err))
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		problems = append(problems, fmt.Sprintf("ULS_LISTEN %q: invalid port %q", app.Listen, port))
+	}
+	if !strings.HasPrefix(app.Path, "/") {
+		problems = append(problems, fmt.Sprintf("ULS_PATH %q: must start with /", app.Path))
+	}
+	if app.CronInterval < 0 {
+		problems = append(problems, fmt.Sprintf("ULS_CRON_INTERVAL %s: must not be negative", app.CronInterval))
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package uls
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validApp() *App {
+	return &App{Listen: ":9101", Path: "/metrics", URI: "http://localhost:8080"}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validApp().validate(); err != nil {
+		t.Fatal(err)
+	}
+	app := validApp()
+	app.URI = "unix:///run/uls.sock"
+	if err := app.validate(); err != nil {
+		t.Errorf("unix:// URI: %s", err)
+	}
+	for name, tc := range map[string]struct {
+		modify func(*App)
+		env    string
+	}{
+		"relative uri":   {func(a *App) { a.URI = "localhost:8080" }, "ULS_URI"},
+		"ftp uri":        {func(a *App) { a.URI = "ftp://localhost" }, "ULS_URI"},
+		"malformed uri":  {func(a *App) { a.URI = "http://[::1" }, "ULS_URI"},
+		"no port":        {func(a *App) { a.Listen = "localhost" }, "ULS_LISTEN"},
+		"bad port":       {func(a *App) { a.Listen = ":http-alt" }, "ULS_LISTEN"},
+		"port too large": {func(a *App) { a.Listen = ":70000" }, "ULS_LISTEN"},
+		"relative path":  {func(a *App) { a.Path = "metrics" }, "ULS_PATH"},
+		"unix uri host":  {func(a *App) { a.URI = "unix://uls.sock" }, "ULS_URI"},
+		"unix uri":       {func(a *App) { a.URI = "unix:" }, "ULS_URI"},
+		"cron interval":  {func(a *App) { a.CronInterval = -time.Second }, "ULS_CRON_INTERVAL"},
+	} {
+		app := validApp()
+		tc.modify(app)
+		err := app.validate()
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.env) {
+			t.Errorf("%s: error %q does not name %s", name, err, tc.env)
+		}
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	app := &App{Listen: "nope", Path: "metrics", URI: "nope"}
+	err := app.validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, env := range []string{"ULS_URI", "ULS_LISTEN", "ULS_PATH"} {
+		if !strings.Contains(err.Error(), env) {
+			t.Errorf("error %q does not name %s", err, env)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+)
+
+// Set at build time with -ldflags "-X uls_exporter/uls.version=... -X uls_exporter/uls.commit=... -X uls_exporter/uls.buildDate=...".
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+func defaultUserAgent() string {
+	return "uls_exporter/" + version
+}
+
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "uls_exporter %s (commit %s, built %s, %s)\n", version, commit, buildDate, runtime.Version())
+}
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// VersionHandler serves the version information of -version as JSON.
+func VersionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildInfo{
+			Version:   version,
+			Commit:    commit,
+			BuildDate: buildDate,
+			GoVersion: runtime.Version(),
+		})
+	})
+}
+
+type startupBanner struct {
+	Level     string   `json:"level"`
+	Msg       string   `json:"msg"`
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildDate string   `json:"build_date"`
+	GoVersion string   `json:"go_version"`
+	Listen    string   `json:"listen"`
+	Path      string   `json:"path"`
+	URI       string   `json:"uri"`
+	Features  []string `json:"features"`
+}
+
+func (app *App) banner(config *Config) startupBanner {
+	features := []string{}
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"tls", app.ServerTLSCert != ""},
+		{"client_auth", app.ServerTLSClientCA != ""},
+		{"bearer_auth", app.AuthTokenFile != ""},
+		{"basic_auth", app.BasicAuthPasswordFile != ""},
+		{"oidc", app.OIDCTokenURL != ""},
+		{"saml", app.SAMLIdPURL != ""},
+		{"unix_socket", app.ULSUnixSocket != ""},
+		{"proxy_auth", app.ProxyUsername != "" || app.ProxyPassword != ""},
+		{"auto_revocation", app.AdminTokenFile != ""},
+		{"metrics_basic_auth", app.MetricsAuthUsername != "" || app.MetricsAuthPassword != ""},
+		{"metrics_api_key", app.MetricsAPIKey != ""},
+		{"health_scrape", !app.SkipHealthScrape},
+		{"hashed_group_ids", app.HashEntitlementGroupIDs},
+		{"wal", app.WALDir != ""},
+		{"plugins", app.PluginDir != ""},
+		{"plugin_sandbox", app.PluginDir != "" && app.PluginSandbox},
+		{"recording_rules", len(config.RecordingRules) > 0},
+		{"remote_write", app.RemoteWriteURL != ""},
+		{"cron", app.CronInterval > 0},
+		{"lease_thresholds", app.LeaseWarningThreshold > 0 || app.LeaseCriticalThreshold > 0},
+	} {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	return startupBanner{
+		Level:     "info",
+		Msg:       "starting uls_exporter",
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Listen:    app.Listen,
+		Path:      app.Path,
+		URI:       app.URI,
+		Features:  features,
+	}
+}
+
+func (app *App) logBanner(config *Config) {
+	b, err := json.Marshal(app.banner(config))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println(string(b))
+}
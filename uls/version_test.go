@@ -0,0 +1,83 @@
+package uls
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersionFlag(t *testing.T) {
+	if os.Getenv("GO_TEST_MAIN") == "1" {
+		os.Args = []string{"uls_exporter", "--version"}
+		err := (&App{}).Main()
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestVersionFlag$")
+	cmd.Env = append(os.Environ(), "GO_TEST_MAIN=1")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("--version: %s\n%s", err, stderr.String())
+	}
+	want := "uls_exporter dev (commit unknown, built unknown, " + runtime.Version() + ")\n"
+	if string(out) != want {
+		t.Errorf("stdout = %q, want %q", out, want)
+	}
+}
+
+func TestStartupBanner(t *testing.T) {
+	app := &App{Listen: ":9101", Path: "/metrics", URI: "http://uls:8080", WALDir: "/var/lib/uls", SkipHealthScrape: true}
+	b, err := json.Marshal(app.banner(&Config{RecordingRules: []RecordingRule{{Record: "r", Expr: "up"}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var banner map[string]interface{}
+	err = json.Unmarshal(b, &banner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{
+		"level":      "info",
+		"version":    "dev",
+		"go_version": runtime.Version(),
+		"listen":     ":9101",
+		"path":       "/metrics",
+		"uri":        "http://uls:8080",
+		"features":   []interface{}{"wal", "recording_rules"},
+	} {
+		if !reflect.DeepEqual(banner[key], want) {
+			t.Errorf("%s = %v, want %v", key, banner[key], want)
+		}
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	VersionHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	var got map[string]string
+	err := json.Unmarshal(rec.Body.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "dev", "commit": "unknown", "build_date": "unknown", "go_version": runtime.Version()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package uls
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const walMaxFileSize = 64 << 20
+
+type leaseWAL struct {
+	dir string
+
+	mu     sync.Mutex
+	file   *os.File
+	day    string
+	index  int
+	size   int64
+	events map[string]uint64
+}
+
+func newLeaseWAL(dir string) (*leaseWAL, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &leaseWAL{dir: dir, events: map[string]uint64{}}, nil
+}
+
+func (w *leaseWAL) Record(events []LeaseEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+	for _, ev := range events {
+		err := w.append(ev)
+		if err != nil {
+			return err
+		}
+		w.events[ev.Event]++
+	}
+	return w.file.Sync()
+}
+
+func (w *leaseWAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *leaseWAL) Events() map[string]uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	events := make(map[string]uint64, len(w.events))
+	for k, v := range w.events {
+		events[k] = v
+	}
+	return events
+}
+
+func (w *leaseWAL) append(ev LeaseEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	err = w.rotate(ev.Time, int64(len(b)))
+	if err != nil {
+		return err
+	}
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	return err
+}
+
+func (w *leaseWAL) rotate(t time.Time, next int64) error {
+	day := t.Format("2006-01-02")
+	if w.file != nil && w.day == day && w.size+next <= walMaxFileSize {
+		return nil
+	}
+	if w.file != nil {
+		err := w.file.Close()
+		w.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if w.day != day {
+		w.day = day
+		w.index = 0
+	}
+	for {
+		path := filepath.Join(w.dir, fmt.Sprintf("leases-%s.%d.log", w.day, w.index))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if st.Size() > 0 && st.Size()+next > walMaxFileSize {
+			f.Close()
+			w.index++
+			continue
+		}
+		w.file = f
+		w.size = st.Size()
+		return nil
+	}
+}
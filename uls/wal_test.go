@@ -0,0 +1,73 @@
+package uls
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func readWAL(t *testing.T, dir string, day time.Time) []LeaseEvent {
+	t.Helper()
+	path := filepath.Join(dir, "leases-"+day.UTC().Format("2006-01-02")+".0.log")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []LeaseEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var ev LeaseEvent
+		err := json.Unmarshal(sc.Bytes(), &ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestWALRecordsCreatedLease(t *testing.T) {
+	const first = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	const second = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+	var scrape int32
+	srv := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&scrape, 1) == 1 {
+			w.Write([]byte(leasesJSON(leaseJSON(1, first))))
+			return
+		}
+		w.Write([]byte(leasesJSON(leaseJSON(1, first), leaseJSON(2, second))))
+	})
+	dir := t.TempDir()
+	e := newTestExporter(t, srv.URL, ExporterOptions{WALDir: dir})
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	gather(t, e)
+	gather(t, e)
+
+	events := readWAL(t, dir, now)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1: %+v", len(events), events)
+	}
+	ev := events[0]
+	if ev.Event != "created" || ev.Token != uuid.MustParse(second) || ev.FloatingLeaseID != 2 {
+		t.Errorf("got %+v, want created event for lease 2", ev)
+	}
+	if !ev.Time.Equal(now) {
+		t.Errorf("got event time %s, want the scrape time %s", ev.Time, now)
+	}
+	if n := e.wal.Events()["created"]; n != 1 {
+		t.Errorf("got %d created events counted, want 1", n)
+	}
+}
@@ -0,0 +1,249 @@
+package uls
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	wsClientBuffer = 16
+	wsReadLimit    = 4096
+	wsWriteTimeout = 10 * time.Second
+)
+
+type MetricSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+type MetricsSnapshot struct {
+	Time    time.Time      `json:"time"`
+	Metrics []MetricSample `json:"metrics"`
+}
+
+type wsSubscription struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+type wsReply struct {
+	Subscribed []string `json:"subscribed,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+
+	mu         sync.Mutex
+	subscribed map[string]bool
+}
+
+func (c *wsClient) wants(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.subscribed) == 0 || c.subscribed[name]
+}
+
+type wsHub struct {
+	idleTimeout time.Duration
+	upgrader    websocket.Upgrader
+	goroutines  *goroutineGroup
+
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+}
+
+func newWSHub(idleTimeout time.Duration) *wsHub {
+	return &wsHub{idleTimeout: idleTimeout, clients: map[*wsClient]struct{}{}}
+}
+
+func (h *wsHub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+func (h *wsHub) Publish(mfs []*dto.MetricFamily) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	samples := metricSamples(mfs)
+	for c := range h.clients {
+		snapshot := MetricsSnapshot{Time: now, Metrics: []MetricSample{}}
+		for _, s := range samples {
+			if c.wants(s.Name) {
+				snapshot.Metrics = append(snapshot.Metrics, s)
+			}
+		}
+		b, err := json.Marshal(snapshot)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		h.enqueueLocked(c, b)
+	}
+}
+
+func (h *wsHub) enqueue(c *wsClient, msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.enqueueLocked(c, msg)
+}
+
+func (h *wsHub) enqueueLocked(c *wsClient, msg []byte) {
+	_, ok := h.clients[c]
+	if !ok {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		h.removeLocked(c)
+	}
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(c)
+}
+
+func (h *wsHub) removeLocked(c *wsClient) {
+	_, ok := h.clients[c]
+	if ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *wsHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsClient{conn: conn, send: make(chan []byte, wsClientBuffer)}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	done := make(chan struct{})
+	h.goroutines.Go(func() {
+		defer close(done)
+		h.writeLoop(c)
+	})
+	h.readLoop(c)
+	h.remove(c)
+	<-done
+}
+
+func (h *wsHub) readLoop(c *wsClient) {
+	c.conn.SetReadLimit(wsReadLimit)
+	extend := func() {
+		if h.idleTimeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(h.idleTimeout))
+		}
+	}
+	extend()
+	c.conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		extend()
+		var sub wsSubscription
+		reply := wsReply{}
+		err = json.Unmarshal(b, &sub)
+		if err != nil {
+			reply.Error = err.Error()
+		} else {
+			subscribed := make(map[string]bool, len(sub.Subscribe))
+			for _, name := range sub.Subscribe {
+				subscribed[name] = true
+			}
+			c.mu.Lock()
+			c.subscribed = subscribed
+			c.mu.Unlock()
+			reply.Subscribed = sub.Subscribe
+		}
+		msg, err := json.Marshal(reply)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		h.enqueue(c, msg)
+	}
+}
+
+func (h *wsHub) writeLoop(c *wsClient) {
+	defer c.conn.Close()
+	var ping <-chan time.Time
+	if h.idleTimeout > 0 {
+		ticker := time.NewTicker(h.idleTimeout / 2)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			err := c.conn.WriteMessage(websocket.TextMessage, msg)
+			if err != nil {
+				return
+			}
+		case <-ping:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func metricSamples(mfs []*dto.MetricFamily) []MetricSample {
+	var samples []MetricSample
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := make(map[string]string, len(m.Label))
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			sample := MetricSample{Name: mf.GetName(), Labels: labels}
+			switch {
+			case m.Gauge != nil:
+				sample.Value = m.Gauge.GetValue()
+			case m.Counter != nil:
+				sample.Value = m.Counter.GetValue()
+			case m.Untyped != nil:
+				sample.Value = m.Untyped.GetValue()
+			case m.Summary != nil:
+				sample.Name += "_sum"
+				sample.Value = m.Summary.GetSampleSum()
+			case m.Histogram != nil:
+				sample.Name += "_sum"
+				sample.Value = m.Histogram.GetSampleSum()
+			default:
+				continue
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
@@ -0,0 +1,92 @@
+package uls
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func dialWebSocket(t *testing.T, e *ULSExporter) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(e.WebSocketHandler())
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketStreamsSubscribedMetrics(t *testing.T) {
+	uls := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(leasesJSON(leaseJSON(1, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"))))
+	})
+	e := newTestExporter(t, uls.URL, ExporterOptions{WSIdleTimeout: time.Minute})
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(e)
+	gatherer := e.SnapshotGatherer(reg)
+	conn := dialWebSocket(t, e)
+
+	err := conn.WriteJSON(wsSubscription{Subscribe: []string{"uls_leases", "uls_websocket_clients"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply wsReply
+	err = conn.ReadJSON(&reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Subscribed) != 2 {
+		t.Fatalf("got reply %+v, want two subscriptions", reply)
+	}
+
+	_, err = gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot MetricsSnapshot
+	err = conn.ReadJSON(&snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Time.IsZero() {
+		t.Error("snapshot time not set")
+	}
+	got := map[string]float64{}
+	for _, m := range snapshot.Metrics {
+		got[m.Name] = m.Value
+	}
+	want := map[string]float64{"uls_leases": 1, "uls_websocket_clients": 1}
+	if len(got) != len(want) {
+		t.Fatalf("got metrics %v, want %v", got, want)
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("got %s %v, want %v", name, got[name], v)
+		}
+	}
+}
+
+func TestWebSocketClosesIdleClients(t *testing.T) {
+	e := newTestExporter(t, "http://127.0.0.1:0", ExporterOptions{WSIdleTimeout: 100 * time.Millisecond})
+	conn := dialWebSocket(t, e)
+	conn.SetPingHandler(func(string) error { return nil })
+
+	_, _, err := conn.ReadMessage()
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("got %v, want going away close", err)
+	}
+	if n := e.ws.Clients(); n != 0 {
+		t.Errorf("got %d clients after idle close, want 0", n)
+	}
+}